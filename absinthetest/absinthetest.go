@@ -0,0 +1,126 @@
+// Package absinthetest provides helpers for testing absinthe services and
+// gateways. Clusters of clients are connected through an in-memory transport,
+// so no nats server is needed.
+package absinthetest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	absinthe "github.com/RobertWHurst/Absinthe"
+	"github.com/RobertWHurst/Absinthe/memory"
+)
+
+// DefaultIndexingInterval is the indexing interval used by clients connected
+// to a Cluster, so peers discover each other quickly
+const DefaultIndexingInterval = 20 * time.Millisecond
+
+// DefaultWaitTimeout is how long the Wait methods of a Cluster wait for
+// discovery before failing the test
+const DefaultWaitTimeout = 5 * time.Second
+
+// Cluster is a set of absinthe clients connected to each other through an
+// in-memory network. Clients are closed automatically when the test ends.
+type Cluster struct {
+	Network *memory.Network
+
+	t       testing.TB
+	clients []*absinthe.Client
+}
+
+// NewCluster creates an empty cluster. Clients connected to it are closed by
+// t.Cleanup.
+func NewCluster(t testing.TB) *Cluster {
+	c := &Cluster{
+		Network: memory.NewNetwork(),
+		t:       t,
+	}
+	t.Cleanup(c.close)
+	return c
+}
+
+// Connect connects a new client to the cluster. The options are applied after
+// the cluster defaults, so they can override the indexing interval.
+func (c *Cluster) Connect(name string, options ...absinthe.Option) *absinthe.Client {
+	c.t.Helper()
+
+	options = append([]absinthe.Option{
+		absinthe.Name(name),
+		absinthe.IndexingInterval(DefaultIndexingInterval),
+		absinthe.UseTransport(c.Network.NewTransport()),
+	}, options...)
+
+	client, err := absinthe.Connect("", options...)
+	if err != nil {
+		c.t.Fatalf("absinthetest: failed to connect client %q: %v", name, err)
+	}
+	c.clients = append(c.clients, client)
+	return client
+}
+
+// WaitForREST waits until the client knows of a peer handling the given
+// method and path, failing the test if it does not within DefaultWaitTimeout
+func (c *Cluster) WaitForREST(client *absinthe.Client, method, path string) {
+	c.t.Helper()
+	c.waitFor(func() bool {
+		return client.Indexer().HasRestHandlerFor(method, path)
+	}, "REST handler for %s %s", method, path)
+}
+
+// WaitForRPC waits until the client knows of a peer handling the given rpc
+// path, failing the test if it does not within DefaultWaitTimeout
+func (c *Cluster) WaitForRPC(client *absinthe.Client, path string) {
+	c.t.Helper()
+	c.waitFor(func() bool {
+		return client.Indexer().HasRPCHandlerFor(path)
+	}, "RPC handler for %s", path)
+}
+
+func (c *Cluster) waitFor(condition func() bool, format string, args ...interface{}) {
+	c.t.Helper()
+	WaitFor(c.t, condition, format, args...)
+}
+
+// WaitFor polls condition until it returns true, failing the test if it does
+// not within DefaultWaitTimeout. The format and args describe what is waited
+// for in the failure message.
+func WaitFor(t testing.TB, condition func() bool, format string, args ...interface{}) {
+	t.Helper()
+	deadline := time.Now().Add(DefaultWaitTimeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("absinthetest: timed out waiting for "+format, args...)
+		}
+		time.Sleep(DefaultIndexingInterval / 2)
+	}
+}
+
+func (c *Cluster) close() {
+	for _, client := range c.clients {
+		client.Close()
+	}
+}
+
+// ServeREST runs a router in process against an HTTP request and returns the
+// recorded response. No transport is involved. To call handlers protected by
+// policies, attach an identity with absinthe.WithIdentity.
+func ServeREST(router *absinthe.RESTRouter, r *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, r)
+	return recorder
+}
+
+// CallRPC runs a router in process against an RPC call. No transport is
+// involved.
+func CallRPC(router *absinthe.RPCRouter, path string, data []byte) ([]byte, error) {
+	return router.Invoke(context.Background(), path, data)
+}
+
+// CallRPCAs runs a router in process against an RPC call made by the given
+// identity. No transport is involved.
+func CallRPCAs(router *absinthe.RPCRouter, identity *absinthe.Identity, path string, data []byte) ([]byte, error) {
+	return router.Invoke(absinthe.WithIdentity(context.Background(), identity), path, data)
+}
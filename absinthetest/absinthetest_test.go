@@ -0,0 +1,87 @@
+package absinthetest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	absinthe "github.com/RobertWHurst/Absinthe"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCluster(t *testing.T) {
+	cluster := NewCluster(t)
+	gateway := cluster.Connect("gateway")
+	service := cluster.Connect("service")
+
+	assert.NoError(t, service.Get("/users/:id", func(c *absinthe.RESTContext) {
+		c.Write([]byte("user " + c.Params["id"]))
+		c.End()
+	}))
+	assert.NoError(t, service.Handle("user.$id.get", func(c *absinthe.RPCContext) {
+		c.Respond([]byte("user " + c.Params["id"]))
+	}))
+
+	cluster.WaitForREST(gateway, "GET", "/users/1")
+	recorder := httptest.NewRecorder()
+	gateway.ServeHTTP(recorder, httptest.NewRequest("GET", "/users/1", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "user 1", recorder.Body.String())
+
+	cluster.WaitForRPC(gateway, "user.2.get")
+	data, err := gateway.Call("user.2.get", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("user 2"), data)
+}
+
+func TestServeREST(t *testing.T) {
+	router := absinthe.NewRESTRouter()
+	assert.NoError(t, router.Get("/users/:id", func(c *absinthe.RESTContext) {
+		c.Status(http.StatusAccepted).Write([]byte(c.Identity.Subject + " " + c.Params["id"]))
+		c.End()
+	}, absinthe.RequireRoles("admin")))
+
+	recorder := ServeREST(router, httptest.NewRequest("GET", "/users/1", nil))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	request := httptest.NewRequest("GET", "/users/1", nil)
+	request = request.WithContext(absinthe.WithIdentity(request.Context(), &absinthe.Identity{
+		Subject: "user-1",
+		Claims:  map[string]interface{}{"roles": []interface{}{"admin"}},
+	}))
+	recorder = ServeREST(router, request)
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.Equal(t, "user-1 1", recorder.Body.String())
+
+	recorder = ServeREST(router, httptest.NewRequest("GET", "/posts/1", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestCallRPC(t *testing.T) {
+	router := absinthe.NewRPCRouter()
+	assert.NoError(t, router.Handle("user.$id.delete", func(c *absinthe.RPCContext) {
+		c.Respond([]byte("deleted " + c.Params["id"]))
+	}, absinthe.RequireRoles("admin")))
+
+	_, err := CallRPC(router, "user.1.delete", nil)
+	assert.Equal(t, absinthe.ErrUnauthenticated.Error(), err.Error())
+
+	data, err := CallRPCAs(router, &absinthe.Identity{
+		Subject: "user-1",
+		Claims:  map[string]interface{}{"roles": []interface{}{"admin"}},
+	}, "user.1.delete", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("deleted 1"), data)
+
+	_, err = CallRPC(router, "user.1.create", nil)
+	assert.Equal(t, absinthe.ErrNoRPCHandler.Error(), err.Error())
+}
+
+func TestWaitFor(t *testing.T) {
+	polls := 0
+	WaitFor(t, func() bool {
+		polls++
+		return polls == 3
+	}, "three polls")
+	assert.Equal(t, 3, polls)
+}
@@ -0,0 +1,332 @@
+package absinthetest
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	absinthe "github.com/RobertWHurst/Absinthe"
+)
+
+// ErrUnexpectedCall is returned to RPC callers of a MockPeer expectation that
+// has already been called the expected number of times
+var ErrUnexpectedCall = errors.New("absinthetest: unexpected call")
+
+// MockCall records a request received by a MockPeer
+type MockCall struct {
+	// Method and URL are set for REST requests
+	Method string
+	URL    string
+
+	// Path is set for RPC calls
+	Path string
+
+	Params   map[string]string
+	Data     []byte
+	Identity *absinthe.Identity
+}
+
+// MockPeer is a peer with scripted responses. It announces its routes and
+// patterns like any other peer, records the requests it receives, and checks
+// that its expectations were met when the test ends.
+type MockPeer struct {
+	*absinthe.Client
+
+	t            testing.TB
+	mu           sync.Mutex
+	expectations []*Expectation
+	calls        []MockCall
+}
+
+// MockPeer connects a MockPeer to the cluster. Its expectations are verified
+// by t.Cleanup.
+func (c *Cluster) MockPeer(name string, options ...absinthe.Option) *MockPeer {
+	c.t.Helper()
+	m := &MockPeer{
+		Client: c.Connect(name, options...),
+		t:      c.t,
+	}
+	c.t.Cleanup(m.AssertExpectations)
+	return m
+}
+
+// ExpectREST advertises a REST route on the mock peer and returns an
+// expectation used to script its response. By default the route responds
+// with an empty 200 and may be called any number of times.
+func (m *MockPeer) ExpectREST(method, path string) *Expectation {
+	m.t.Helper()
+	route, err := absinthe.NewRESTRoute(method, path)
+	if err != nil {
+		m.t.Fatalf("absinthetest: invalid route %s %s: %v", method, path, err)
+	}
+	e := m.newExpectation(method + " " + path)
+	e.route = route
+	err = m.Route(method, path, func(c *absinthe.RESTContext) {
+		if !e.take() {
+			if !m.fallsThrough(e, c.Method, c.URL) {
+				e.reject()
+			}
+			c.Next()
+			return
+		}
+		m.record(e, MockCall{
+			Method:   c.Method,
+			URL:      c.URL,
+			Params:   c.Params,
+			Data:     c.Body(),
+			Identity: c.Identity,
+		})
+		e.respondREST(c)
+	})
+	if err != nil {
+		m.t.Fatalf("absinthetest: invalid route %s %s: %v", method, path, err)
+	}
+	return e
+}
+
+// ExpectRPC advertises an RPC pattern on the mock peer and returns an
+// expectation used to script its response. By default the pattern responds
+// with no data and may be called any number of times.
+func (m *MockPeer) ExpectRPC(pattern string) *Expectation {
+	m.t.Helper()
+	e := m.newExpectation(pattern)
+	err := m.Handle(pattern, func(c *absinthe.RPCContext) {
+		if !e.take() {
+			e.reject()
+			c.Error(ErrUnexpectedCall)
+			return
+		}
+		m.record(e, MockCall{
+			Path:     c.Path,
+			Params:   c.Params,
+			Data:     c.Data,
+			Identity: c.Identity,
+		})
+		e.respondRPC(c)
+	})
+	if err != nil {
+		m.t.Fatalf("absinthetest: invalid pattern %s: %v", pattern, err)
+	}
+	return e
+}
+
+// Calls returns every request received by the mock peer, in order
+func (m *MockPeer) Calls() []MockCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MockCall(nil), m.calls...)
+}
+
+// AssertExpectations fails the test if any expectation with a set number of
+// calls was not called exactly that many times. Calls rejected once the
+// expectation was exhausted count too, unless a later REST expectation took
+// them. It is called automatically when the test ends.
+func (m *MockPeer) AssertExpectations() {
+	m.t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.expectations {
+		e.mu.Lock()
+		if called := len(e.calls) + e.rejected; e.times >= 0 && called != e.times {
+			m.t.Errorf("absinthetest: expected %s to be called %d times, but it was called %d times", e.name, e.times, called)
+		}
+		e.mu.Unlock()
+	}
+}
+
+// fallsThrough reports whether a REST request rejected by e will be taken by
+// a later expectation
+func (m *MockPeer) fallsThrough(e *Expectation, method, url string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	later := false
+	for _, other := range m.expectations {
+		if other == e {
+			later = true
+			continue
+		}
+		if !later || other.route == nil {
+			continue
+		}
+		if _, ok := other.route.FindParams(method, url); ok && other.available() {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MockPeer) newExpectation(name string) *Expectation {
+	e := &Expectation{
+		name:   name,
+		status: http.StatusOK,
+		header: make(http.Header),
+		times:  -1,
+	}
+	m.mu.Lock()
+	m.expectations = append(m.expectations, e)
+	m.mu.Unlock()
+	return e
+}
+
+func (m *MockPeer) record(e *Expectation, call MockCall) {
+	m.mu.Lock()
+	m.calls = append(m.calls, call)
+	m.mu.Unlock()
+	e.mu.Lock()
+	e.calls = append(e.calls, call)
+	e.mu.Unlock()
+}
+
+// Expectation scripts how a MockPeer responds to a route or pattern
+type Expectation struct {
+	name  string
+	route *absinthe.RESTRoute
+
+	mu         sync.Mutex
+	status     int
+	header     http.Header
+	data       []byte
+	err        error
+	latency    time.Duration
+	noResponse bool
+	times      int
+	taken      int
+	rejected   int
+	calls      []MockCall
+}
+
+// Status sets the status code of REST responses
+func (e *Expectation) Status(status int) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.status = status
+	return e
+}
+
+// Header sets a header on REST responses
+func (e *Expectation) Header(name, value string) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.header.Set(name, value)
+	return e
+}
+
+// Return sets the body of REST responses, or the data of RPC responses
+func (e *Expectation) Return(data []byte) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.data = data
+	return e
+}
+
+// Fail makes RPC calls fail with err, and REST requests fail with a 500
+// carrying the error message
+func (e *Expectation) Fail(err error) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.err = err
+	return e
+}
+
+// Latency delays each response by d
+func (e *Expectation) Latency(d time.Duration) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.latency = d
+	return e
+}
+
+// NoResponse makes the mock peer never respond, so callers time out
+func (e *Expectation) NoResponse() *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.noResponse = true
+	return e
+}
+
+// Times sets the exact number of times the expectation must be called. Once
+// it has been called n times, further REST requests fall through to the next
+// matching expectation and further RPC calls fail with ErrUnexpectedCall.
+// Calls no other expectation takes fail AssertExpectations.
+func (e *Expectation) Times(n int) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.times = n
+	return e
+}
+
+// Once is shorthand for Times(1)
+func (e *Expectation) Once() *Expectation {
+	return e.Times(1)
+}
+
+// Calls returns the requests received by this expectation, in order
+func (e *Expectation) Calls() []MockCall {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]MockCall(nil), e.calls...)
+}
+
+func (e *Expectation) take() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.times >= 0 && e.taken >= e.times {
+		return false
+	}
+	e.taken++
+	return true
+}
+
+func (e *Expectation) available() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.times < 0 || e.taken < e.times
+}
+
+func (e *Expectation) reject() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rejected++
+}
+
+func (e *Expectation) wait() bool {
+	e.mu.Lock()
+	latency, noResponse := e.latency, e.noResponse
+	e.mu.Unlock()
+	time.Sleep(latency)
+	return !noResponse
+}
+
+func (e *Expectation) respondREST(c *absinthe.RESTContext) {
+	if !e.wait() {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for name, values := range e.header {
+		for _, value := range values {
+			c.SetHeader(name, value)
+		}
+	}
+	if e.err != nil {
+		c.Status(http.StatusInternalServerError).Write([]byte(e.err.Error()))
+	} else {
+		c.Status(e.status).Write(e.data)
+	}
+	c.End()
+}
+
+func (e *Expectation) respondRPC(c *absinthe.RPCContext) {
+	if !e.wait() {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err != nil {
+		c.Error(e.err)
+	} else {
+		c.Respond(e.data)
+	}
+}
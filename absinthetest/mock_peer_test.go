@@ -0,0 +1,119 @@
+package absinthetest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingTB records the failures reported through it instead of failing
+// the test
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingTB) Helper() {}
+
+func (t *recordingTB) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+// recordedMockPeer connects a MockPeer whose failures are recorded by the
+// returned recordingTB rather than failing the test
+func recordedMockPeer(t *testing.T, cluster *Cluster, name string) (*MockPeer, *recordingTB) {
+	tb := &recordingTB{TB: t}
+	return &MockPeer{Client: cluster.Connect(name), t: tb}, tb
+}
+
+func TestMockPeerREST(t *testing.T) {
+	cluster := NewCluster(t)
+	gateway := cluster.Connect("gateway")
+	users := cluster.MockPeer("users")
+
+	created := users.ExpectREST("post", "/users").Status(http.StatusCreated).Header("Location", "/users/1").Once()
+	users.ExpectREST("post", "/users").Fail(errors.New("duplicate user"))
+	users.ExpectREST("get", "/users/:id").Return([]byte("user")).Latency(10 * time.Millisecond)
+
+	cluster.WaitForREST(gateway, "POST", "/users")
+	cluster.WaitForREST(gateway, "GET", "/users/1")
+
+	recorder := httptest.NewRecorder()
+	gateway.ServeHTTP(recorder, httptest.NewRequest("POST", "/users", strings.NewReader(`{"name":"alice"}`)))
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	assert.Equal(t, "/users/1", recorder.Header().Get("Location"))
+
+	recorder = httptest.NewRecorder()
+	gateway.ServeHTTP(recorder, httptest.NewRequest("POST", "/users", strings.NewReader(`{"name":"alice"}`)))
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.Equal(t, "duplicate user", recorder.Body.String())
+
+	start := time.Now()
+	recorder = httptest.NewRecorder()
+	gateway.ServeHTTP(recorder, httptest.NewRequest("GET", "/users/7", nil))
+	assert.Equal(t, "user", recorder.Body.String())
+	assert.True(t, time.Since(start) >= 10*time.Millisecond)
+
+	calls := created.Calls()
+	assert.Len(t, calls, 1)
+	assert.Equal(t, []byte(`{"name":"alice"}`), calls[0].Data)
+
+	calls = users.Calls()
+	assert.Len(t, calls, 3)
+	assert.Equal(t, "7", calls[2].Params["id"])
+}
+
+func TestMockPeerRPC(t *testing.T) {
+	cluster := NewCluster(t)
+	caller := cluster.Connect("caller")
+	users, tb := recordedMockPeer(t, cluster, "users")
+
+	users.ExpectRPC("user.$id.get").Return([]byte("user")).Times(2)
+	users.ExpectRPC("user.$id.delete").Fail(errors.New("forbidden"))
+
+	cluster.WaitForRPC(caller, "user.1.get")
+	cluster.WaitForRPC(caller, "user.1.delete")
+
+	for i := 0; i < 2; i++ {
+		data, err := caller.Call("user.1.get", []byte("request"))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("user"), data)
+	}
+	_, err := caller.Call("user.1.get", nil)
+	assert.EqualError(t, err, ErrUnexpectedCall.Error())
+
+	_, err = caller.Call("user.1.delete", nil)
+	assert.EqualError(t, err, "forbidden")
+
+	calls := users.Calls()
+	assert.Len(t, calls, 3)
+	assert.Equal(t, "user.1.get", calls[0].Path)
+	assert.Equal(t, []byte("request"), calls[0].Data)
+
+	users.AssertExpectations()
+	assert.Equal(t, []string{"absinthetest: expected user.$id.get to be called 2 times, but it was called 3 times"}, tb.errors)
+}
+
+func TestMockPeerUnexpectedREST(t *testing.T) {
+	cluster := NewCluster(t)
+	gateway := cluster.Connect("gateway")
+	users, tb := recordedMockPeer(t, cluster, "users")
+
+	users.ExpectREST("delete", "/users/:id").Status(http.StatusNoContent).Once()
+	cluster.WaitForREST(gateway, "DELETE", "/users/1")
+
+	for _, status := range []int{http.StatusNoContent, http.StatusNotFound} {
+		recorder := httptest.NewRecorder()
+		gateway.ServeHTTP(recorder, httptest.NewRequest("DELETE", "/users/1", nil))
+		assert.Equal(t, status, recorder.Code)
+	}
+
+	users.AssertExpectations()
+	assert.Equal(t, []string{"absinthetest: expected delete /users/:id to be called 1 times, but it was called 2 times"}, tb.errors)
+}
@@ -0,0 +1,346 @@
+package absinthe
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// AdminPeer describes a peer in the responses of the admin API
+type AdminPeer struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Version     string   `json:"version"`
+	Self        bool     `json:"self,omitempty"`
+	RESTRoutes  []string `json:"restRoutes"`
+	RPCPatterns []string `json:"rpcPatterns"`
+	Health      *Health  `json:"health,omitempty"`
+
+	// Breaker is reserved for the state of a circuit breaker guarding requests
+	// to the peer. Clients do not have circuit breakers yet, so it is always
+	// empty and omitted.
+	Breaker string `json:"breaker,omitempty"`
+}
+
+// AdminRoute describes a REST route or RPC pattern in the responses of the
+// admin API, along with the IDs of the peers serving it
+type AdminRoute struct {
+	Kind     string   `json:"kind"`
+	Method   string   `json:"method,omitempty"`
+	Pattern  string   `json:"pattern"`
+	Policies []string `json:"policies,omitempty"`
+	Peers    []string `json:"peers"`
+}
+
+// AdminConflict describes a RouteConflict in the responses of the admin API
+type AdminConflict struct {
+	Kind   string       `json:"kind"`
+	Claims []AdminClaim `json:"claims"`
+}
+
+// AdminClaim describes a RouteClaim in the responses of the admin API
+type AdminClaim struct {
+	Name    string      `json:"name"`
+	Method  string      `json:"method,omitempty"`
+	Pattern string      `json:"pattern"`
+	Peers   []AdminPeer `json:"peers"`
+}
+
+// AdminMatch is the result of matching a request against the routes of the
+// known peers. Peer is the peer the request would be dispatched to, and is nil
+// if no peer serves the request. Candidates lists every peer with a matching
+// route.
+type AdminMatch struct {
+	Method     string              `json:"method"`
+	Path       string              `json:"path"`
+	Peer       *AdminPeer          `json:"peer"`
+	Route      string              `json:"route,omitempty"`
+	Params     map[string]string   `json:"params,omitempty"`
+	Candidates []AdminMatchOutcome `json:"candidates"`
+}
+
+// AdminMatchOutcome is a peer with a route matching the request of an
+// AdminMatch
+type AdminMatchOutcome struct {
+	PeerID string            `json:"peerId"`
+	Name   string            `json:"name"`
+	Route  string            `json:"route"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// AdminHandler returns an http.Handler serving an introspection API and
+// dashboard for the client and the peers known to it. Mount it with
+// http.StripPrefix when serving it under a path. It serves:
+//
+//	GET /                 an HTML dashboard of everything below
+//	GET /api/peers        known peers with their versions, routes and health
+//	GET /api/routes       every REST route and RPC pattern, and the peers serving it
+//	GET /api/conflicts    overlapping routes served by peers with different names
+//	GET /api/rates        request rates of the client over the last RateWindow
+//	GET /api/match        the peer a request would be dispatched to, given the
+//	                      method and path query params, such as
+//	                      /api/match?method=GET&path=/users/1
+//
+// The handler exposes the topology of the cluster, so it should only be
+// reachable by operators.
+func (c *Client) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/peers", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, c.adminPeers())
+	})
+	mux.HandleFunc("/api/routes", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, c.adminRoutes())
+	})
+	mux.HandleFunc("/api/conflicts", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, c.adminConflicts())
+	})
+	mux.HandleFunc("/api/rates", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, c.RequestRates())
+	})
+	mux.HandleFunc("/api/match", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("path") == "" {
+			http.Error(w, "absinthe: path query param is required", http.StatusBadRequest)
+			return
+		}
+		writeAdminJSON(w, c.adminMatch(query.Get("method"), query.Get("path")))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" && r.URL.Path != "" {
+			http.NotFound(w, r)
+			return
+		}
+		query := r.URL.Query()
+		peers := c.adminPeers()
+		page := adminPage{
+			Self:      peers[0],
+			Peers:     peers,
+			Routes:    c.adminRoutes(),
+			Conflicts: c.adminConflicts(),
+			Rates:     c.RequestRates(),
+		}
+		if query.Get("path") != "" {
+			match := c.adminMatch(query.Get("method"), query.Get("path"))
+			page.Match = &match
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		adminTemplate.Execute(w, page)
+	})
+	return mux
+}
+
+func writeAdminJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(v)
+}
+
+func newAdminPeer(peer Peer, self bool) AdminPeer {
+	adminPeer := AdminPeer{
+		ID:          peer.ID,
+		Name:        peer.Name,
+		Version:     versionLabel(peer),
+		Self:        self,
+		RESTRoutes:  make([]string, 0, len(peer.RESTRoutes)),
+		RPCPatterns: make([]string, 0, len(peer.RPCPatterns)),
+		Health:      peer.Health,
+	}
+	for _, route := range peer.RESTRoutes {
+		adminPeer.RESTRoutes = append(adminPeer.RESTRoutes, strings.ToUpper(route.Method)+" "+route.PatternSrc)
+	}
+	for _, pattern := range peer.RPCPatterns {
+		adminPeer.RPCPatterns = append(adminPeer.RPCPatterns, pattern.PatternSrc)
+	}
+	sort.Strings(adminPeer.RESTRoutes)
+	sort.Strings(adminPeer.RPCPatterns)
+	return adminPeer
+}
+
+// adminPeers returns the client itself followed by the peers known to it
+func (c *Client) adminPeers() []AdminPeer {
+	c.peerMu.RLock()
+	peers := []AdminPeer{newAdminPeer(c.Peer, true)}
+	c.peerMu.RUnlock()
+	for _, peer := range c.indexer.Peers() {
+		peers = append(peers, newAdminPeer(peer, false))
+	}
+	return peers
+}
+
+func (c *Client) adminRoutes() []AdminRoute {
+	routes := make(map[string]*AdminRoute)
+	for _, peer := range c.indexer.Peers() {
+		for key, route := range peer.RESTRoutes {
+			if _, ok := routes[key]; !ok {
+				routes[key] = &AdminRoute{
+					Kind:     RouteKindREST,
+					Method:   strings.ToUpper(route.Method),
+					Pattern:  route.PatternSrc,
+					Policies: policyStrings(route.Policies),
+				}
+			}
+			routes[key].Peers = append(routes[key].Peers, peer.ID)
+		}
+		for key, pattern := range peer.RPCPatterns {
+			if _, ok := routes[key]; !ok {
+				routes[key] = &AdminRoute{
+					Kind:     RouteKindRPC,
+					Pattern:  pattern.PatternSrc,
+					Policies: policyStrings(pattern.Policies),
+				}
+			}
+			routes[key].Peers = append(routes[key].Peers, peer.ID)
+		}
+	}
+
+	sortedRoutes := make([]AdminRoute, 0, len(routes))
+	for _, route := range routes {
+		sortedRoutes = append(sortedRoutes, *route)
+	}
+	sort.Slice(sortedRoutes, func(a, b int) bool {
+		if sortedRoutes[a].Kind != sortedRoutes[b].Kind {
+			return sortedRoutes[a].Kind == RouteKindREST
+		}
+		if sortedRoutes[a].Pattern != sortedRoutes[b].Pattern {
+			return sortedRoutes[a].Pattern < sortedRoutes[b].Pattern
+		}
+		return sortedRoutes[a].Method < sortedRoutes[b].Method
+	})
+	return sortedRoutes
+}
+
+func (c *Client) adminConflicts() []AdminConflict {
+	conflicts := make([]AdminConflict, 0)
+	for _, conflict := range c.indexer.Conflicts() {
+		adminConflict := AdminConflict{
+			Kind:   conflict.Kind,
+			Claims: make([]AdminClaim, 0, len(conflict.Claims)),
+		}
+		for _, claim := range conflict.Claims {
+			adminClaim := AdminClaim{
+				Name:    claim.Name,
+				Method:  strings.ToUpper(claim.Method),
+				Pattern: claim.Pattern,
+				Peers:   make([]AdminPeer, 0, len(claim.Peers)),
+			}
+			for _, peer := range claim.Peers {
+				adminClaim.Peers = append(adminClaim.Peers, newAdminPeer(peer, false))
+			}
+			adminConflict.Claims = append(adminConflict.Claims, adminClaim)
+		}
+		conflicts = append(conflicts, adminConflict)
+	}
+	return conflicts
+}
+
+// adminMatch resolves the peer a request would be dispatched to the same way
+// the gateway does, and lists every peer with a route matching the request
+func (c *Client) adminMatch(method, path string) AdminMatch {
+	method = strings.ToUpper(method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	match := AdminMatch{
+		Method:     method,
+		Path:       path,
+		Candidates: make([]AdminMatchOutcome, 0),
+	}
+	if peer, route, ok := c.indexer.FindRESTPeer(method, path); ok {
+		adminPeer := newAdminPeer(peer, false)
+		match.Peer = &adminPeer
+		match.Route = route.PatternSrc
+		match.Params, _ = route.FindParams(method, path)
+	}
+	for _, peer := range c.indexer.Peers() {
+		if route, ok := peer.FindRESTRoute(method, path); ok {
+			params, _ := route.FindParams(method, path)
+			match.Candidates = append(match.Candidates, AdminMatchOutcome{
+				PeerID: peer.ID,
+				Name:   peer.Name,
+				Route:  route.PatternSrc,
+				Params: params,
+			})
+		}
+	}
+	return match
+}
+
+func policyStrings(policies []Policy) []string {
+	strs := make([]string, 0, len(policies))
+	for _, policy := range policies {
+		strs = append(strs, policy.String())
+	}
+	return strs
+}
+
+type adminPage struct {
+	Self      AdminPeer
+	Peers     []AdminPeer
+	Routes    []AdminRoute
+	Conflicts []AdminConflict
+	Rates     []RequestRate
+	Match     *AdminMatch
+}
+
+var adminTemplate = template.Must(template.New("admin").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Absinthe - {{.Self.Name}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+th { background: #eee; }
+code { font-size: 0.9em; }
+.conflict { color: #b00; }
+</style>
+</head>
+<body>
+<h1>{{.Self.Name}} <small>{{.Self.Version}} {{.Self.ID}}</small></h1>
+
+<h2>Which peer would serve</h2>
+<form method="get">
+<input name="method" value="{{if .Match}}{{.Match.Method}}{{else}}GET{{end}}" size="7">
+<input name="path" value="{{if .Match}}{{.Match.Path}}{{end}}" placeholder="/users/1" size="40">
+<button type="submit">Match</button>
+</form>
+{{with .Match}}
+{{if .Peer}}<p>{{.Method}} <code>{{.Path}}</code> is served by <b>{{.Peer.Name}}</b> ({{.Peer.ID}}) with route <code>{{.Route}}</code>{{range $k, $v := .Params}} {{$k}}={{$v}}{{end}}</p>
+{{else}}<p>No peer serves {{.Method}} <code>{{.Path}}</code></p>{{end}}
+{{if .Candidates}}<table><tr><th>Candidate peer</th><th>Name</th><th>Route</th></tr>
+{{range .Candidates}}<tr><td>{{.PeerID}}</td><td>{{.Name}}</td><td><code>{{.Route}}</code></td></tr>
+{{end}}</table>{{end}}
+{{end}}
+
+<h2>Peers</h2>
+<table><tr><th>ID</th><th>Name</th><th>Version</th><th>REST routes</th><th>RPC patterns</th><th>Health</th></tr>
+{{range .Peers}}<tr><td>{{.ID}}{{if .Self}} (self){{end}}</td><td>{{.Name}}</td><td>{{.Version}}</td>
+<td>{{range .RESTRoutes}}<code>{{.}}</code><br>{{end}}</td>
+<td>{{range .RPCPatterns}}<code>{{.}}</code><br>{{end}}</td>
+<td>{{with .Health}}{{.Status}}{{else}}unchecked{{end}}</td></tr>
+{{end}}</table>
+
+<h2>Routes</h2>
+<table><tr><th>Kind</th><th>Method</th><th>Pattern</th><th>Policies</th><th>Peers</th></tr>
+{{range .Routes}}<tr><td>{{.Kind}}</td><td>{{.Method}}</td><td><code>{{.Pattern}}</code></td>
+<td>{{range .Policies}}{{.}}<br>{{end}}</td><td>{{range .Peers}}{{.}}<br>{{end}}</td></tr>
+{{end}}</table>
+
+<h2>Conflicts</h2>
+{{if .Conflicts}}<table class="conflict"><tr><th>Kind</th><th>Service</th><th>Route</th><th>Conflicts with</th><th>Route</th></tr>
+{{range .Conflicts}}<tr><td>{{.Kind}}</td>{{range .Claims}}<td>{{.Name}}<br>{{range .Peers}}<small>{{.Version}} {{.ID}}</small><br>{{end}}</td>
+<td><code>{{.Method}} {{.Pattern}}</code></td>{{end}}</tr>
+{{end}}</table>{{else}}<p>No conflicts</p>{{end}}
+
+<h2>Request rates</h2>
+{{if .Rates}}<table><tr><th>Direction</th><th>Kind</th><th>Method</th><th>Route</th><th>Requests/s</th><th>Errors/s</th></tr>
+{{range .Rates}}<tr><td>{{.Direction}}</td><td>{{.Kind}}</td><td>{{.Method}}</td><td><code>{{.Route}}</code></td>
+<td>{{printf "%.2f" .RequestsPerSecond}}</td><td>{{printf "%.2f" .ErrorsPerSecond}}</td></tr>
+{{end}}</table>{{else}}<p>No requests in the last minute</p>{{end}}
+</body>
+</html>
+`))
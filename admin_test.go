@@ -0,0 +1,107 @@
+package absinthe_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	absinthe "github.com/RobertWHurst/Absinthe"
+	"github.com/RobertWHurst/Absinthe/absinthetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminHandler(t *testing.T) {
+	cluster := absinthetest.NewCluster(t)
+	connect := func(name string) *absinthe.Client {
+		return cluster.Connect(name, absinthe.Version("1.0.0"))
+	}
+	gateway := connect("gateway")
+	users := connect("users")
+	accounts := connect("accounts")
+
+	assert.NoError(t, users.Get("/users/:id", func(c *absinthe.RESTContext) {
+		c.End()
+	}))
+	assert.NoError(t, users.Handle("user.$id.get", func(c *absinthe.RPCContext) {
+		c.Respond(nil)
+	}))
+	assert.NoError(t, accounts.Get("/users/:id", func(c *absinthe.RESTContext) {
+		c.End()
+	}))
+
+	absinthetest.WaitFor(t, func() bool {
+		return len(gateway.Indexer().Conflicts()) != 0
+	}, "route conflicts")
+	gateway.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/1", nil))
+
+	admin := gateway.AdminHandler()
+	get := func(path string, v interface{}) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if v != nil {
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), v))
+		}
+		return w
+	}
+
+	peers := []absinthe.AdminPeer{}
+	get("/api/peers", &peers)
+	if assert.Len(t, peers, 3) {
+		assert.Equal(t, gateway.ID, peers[0].ID)
+		assert.True(t, peers[0].Self)
+		for _, peer := range peers[1:] {
+			assert.Equal(t, "1.0.0", peer.Version)
+			assert.Contains(t, peer.RESTRoutes, "GET /users/:id")
+		}
+	}
+
+	routes := []absinthe.AdminRoute{}
+	get("/api/routes", &routes)
+	if assert.Len(t, routes, 2) {
+		assert.Equal(t, absinthe.AdminRoute{Kind: "rest", Method: "GET", Pattern: "/users/:id", Peers: routes[0].Peers}, routes[0])
+		assert.ElementsMatch(t, []string{users.ID, accounts.ID}, routes[0].Peers)
+		assert.Equal(t, absinthe.AdminRoute{Kind: "rpc", Pattern: "user.$id.get", Peers: []string{users.ID}}, routes[1])
+	}
+
+	conflicts := []absinthe.AdminConflict{}
+	get("/api/conflicts", &conflicts)
+	if assert.Len(t, conflicts, 1) && assert.Len(t, conflicts[0].Claims, 2) {
+		assert.Equal(t, "accounts", conflicts[0].Claims[0].Name)
+		assert.Equal(t, "users", conflicts[0].Claims[1].Name)
+		assert.Equal(t, "/users/:id", conflicts[0].Claims[1].Pattern)
+		assert.Equal(t, users.ID, conflicts[0].Claims[1].Peers[0].ID)
+	}
+
+	rates := []absinthe.RequestRate{}
+	get("/api/rates", &rates)
+	if assert.Len(t, rates, 1) {
+		assert.Equal(t, "dispatch", rates[0].Direction)
+		assert.Equal(t, "/users/:id", rates[0].Route)
+		assert.InDelta(t, 1/absinthe.RateWindow.Seconds(), rates[0].RequestsPerSecond, 0.0001)
+	}
+
+	match := absinthe.AdminMatch{}
+	get("/api/match?method=GET&path=/users/7", &match)
+	if assert.NotNil(t, match.Peer) {
+		assert.Contains(t, []string{users.ID, accounts.ID}, match.Peer.ID)
+		assert.Equal(t, "/users/:id", match.Route)
+		assert.Equal(t, map[string]string{"id": "7"}, match.Params)
+	}
+	assert.Len(t, match.Candidates, 2)
+
+	match = absinthe.AdminMatch{}
+	get("/api/match?path=/accounts", &match)
+	assert.Nil(t, match.Peer)
+	assert.Empty(t, match.Candidates)
+
+	assert.Equal(t, http.StatusBadRequest, get("/api/match", nil).Code)
+	assert.Equal(t, http.StatusNotFound, get("/missing", nil).Code)
+
+	w := get("/?method=GET&path=/users/7", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "user.$id.get")
+	assert.Contains(t, w.Body.String(), "Conflicts")
+	assert.Contains(t, w.Body.String(), "id=7")
+}
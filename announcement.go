@@ -0,0 +1,117 @@
+package absinthe
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"time"
+)
+
+// MaxAnnouncementAge is the maximum age of a signed announcement before it is
+// rejected as stale
+const MaxAnnouncementAge = 10 * time.Second
+
+// ErrUntrustedAnnouncement is returned when an announcement is unsigned, or is
+// signed by a key outside of the trusted key set
+var ErrUntrustedAnnouncement = errors.New("absinthe: announcement is not signed by a trusted key")
+
+// ErrInvalidAnnouncementSignature is returned when the signature of an
+// announcement does not match its contents
+var ErrInvalidAnnouncementSignature = errors.New("absinthe: invalid announcement signature")
+
+// ErrStaleAnnouncement is returned when an announcement is older than
+// MaxAnnouncementAge, or claims to be from the future
+var ErrStaleAnnouncement = errors.New("absinthe: stale announcement")
+
+// ErrReplayedAnnouncement is returned when an announcement has already been
+// accepted once
+var ErrReplayedAnnouncement = errors.New("absinthe: replayed announcement")
+
+// ErrMisdirectedAnnouncement is returned when an announcement was signed for
+// a different recipient
+var ErrMisdirectedAnnouncement = errors.New("absinthe: announcement was addressed to another peer")
+
+// Announcement is published by a peer in response to a PING. It carries the
+// encoded peer, and when a SigningKey is configured, an Ed25519 signature
+// covering the peer, the recipient, a timestamp, and a nonce.
+type Announcement struct {
+	RecipientID string
+	PeerData    []byte
+	Timestamp   int64
+	Nonce       []byte
+	PublicKey   []byte
+	Signature   []byte
+}
+
+func newAnnouncement(peer *Peer, recipientID string, key ed25519.PrivateKey) (*Announcement, error) {
+	peerData := &bytes.Buffer{}
+	if err := gob.NewEncoder(peerData).Encode(peer); err != nil {
+		return nil, err
+	}
+
+	announcement := &Announcement{
+		RecipientID: recipientID,
+		PeerData:    peerData.Bytes(),
+		Timestamp:   time.Now().UnixNano(),
+	}
+	if key == nil {
+		return announcement, nil
+	}
+
+	announcement.Nonce = make([]byte, 16)
+	if _, err := rand.Read(announcement.Nonce); err != nil {
+		return nil, err
+	}
+	announcement.PublicKey = key.Public().(ed25519.PublicKey)
+	announcement.Signature = ed25519.Sign(key, announcement.signedData())
+	return announcement, nil
+}
+
+func (a *Announcement) signedData() []byte {
+	data := &bytes.Buffer{}
+	data.WriteString(a.RecipientID)
+	data.WriteByte(0)
+	binary.Write(data, binary.BigEndian, a.Timestamp)
+	data.Write(a.Nonce)
+	data.Write(a.PeerData)
+	return data.Bytes()
+}
+
+// Verify checks that the announcement is addressed to recipientID, is signed
+// by one of the trusted keys, and is not stale
+func (a *Announcement) Verify(trustedKeys []ed25519.PublicKey, recipientID string, now time.Time) error {
+	if len(a.Signature) == 0 || len(a.PublicKey) != ed25519.PublicKeySize {
+		return ErrUntrustedAnnouncement
+	}
+	trusted := false
+	for _, key := range trustedKeys {
+		if bytes.Equal(key, a.PublicKey) {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return ErrUntrustedAnnouncement
+	}
+	if !ed25519.Verify(ed25519.PublicKey(a.PublicKey), a.signedData(), a.Signature) {
+		return ErrInvalidAnnouncementSignature
+	}
+	if a.RecipientID != recipientID {
+		return ErrMisdirectedAnnouncement
+	}
+	age := now.Sub(time.Unix(0, a.Timestamp))
+	if age > MaxAnnouncementAge || age < -MaxAnnouncementAge {
+		return ErrStaleAnnouncement
+	}
+	return nil
+}
+
+// Peer decodes the peer carried by the announcement
+func (a *Announcement) Peer() (Peer, error) {
+	peer := Peer{}
+	err := gob.NewDecoder(bytes.NewReader(a.PeerData)).Decode(&peer)
+	return peer, err
+}
@@ -0,0 +1,64 @@
+package absinthe
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAnnouncementKeys(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	return publicKey, privateKey
+}
+
+func TestAnnouncementVerify(t *testing.T) {
+	publicKey, privateKey := newTestAnnouncementKeys(t)
+	otherPublicKey, _ := newTestAnnouncementKeys(t)
+	peer, err := NewPeer("service", nil, "")
+	assert.NoError(t, err)
+
+	announcement, err := newAnnouncement(peer, "recipient", privateKey)
+	assert.NoError(t, err)
+	now := time.Now()
+
+	assert.NoError(t, announcement.Verify([]ed25519.PublicKey{publicKey}, "recipient", now))
+	assert.Equal(t, ErrUntrustedAnnouncement, announcement.Verify([]ed25519.PublicKey{otherPublicKey}, "recipient", now))
+	assert.Equal(t, ErrMisdirectedAnnouncement, announcement.Verify([]ed25519.PublicKey{publicKey}, "other", now))
+	assert.Equal(t, ErrStaleAnnouncement, announcement.Verify([]ed25519.PublicKey{publicKey}, "recipient", now.Add(2*MaxAnnouncementAge)))
+
+	decodedPeer, err := announcement.Peer()
+	assert.NoError(t, err)
+	assert.Equal(t, peer.ID, decodedPeer.ID)
+
+	announcement.PeerData = append(announcement.PeerData, 0)
+	assert.Equal(t, ErrInvalidAnnouncementSignature, announcement.Verify([]ed25519.PublicKey{publicKey}, "recipient", now))
+
+	unsignedAnnouncement, err := newAnnouncement(peer, "recipient", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrUntrustedAnnouncement, unsignedAnnouncement.Verify([]ed25519.PublicKey{publicKey}, "recipient", now))
+}
+
+func TestIndexerRejectsReplayedAnnouncements(t *testing.T) {
+	publicKey, privateKey := newTestAnnouncementKeys(t)
+	peer, err := NewPeer("service", nil, "")
+	assert.NoError(t, err)
+
+	client := &Client{options: GetDefaultOptions()}
+	client.ID = "recipient"
+	client.options.TrustedKeys = []ed25519.PublicKey{publicKey}
+	indexer := NewIndexer(client)
+
+	announcement, err := newAnnouncement(peer, "recipient", privateKey)
+	assert.NoError(t, err)
+
+	acceptedPeer, err := indexer.acceptAnnouncement(announcement, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, peer.ID, acceptedPeer.ID)
+
+	_, err = indexer.acceptAnnouncement(announcement, time.Now())
+	assert.Equal(t, ErrReplayedAnnouncement, err)
+}
@@ -0,0 +1,187 @@
+package absinthe
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request carries
+// no credentials it understands, allowing the next Authenticator to try
+var ErrNoCredentials = errors.New("absinthe: no credentials presented")
+
+// ErrMissingIdentityKey is returned when an identity must be signed or
+// verified but no IdentityKey has been configured
+var ErrMissingIdentityKey = errors.New("absinthe: identity key is not configured")
+
+// ErrInvalidIdentitySignature is returned when a forwarded identity does not
+// match its signature
+var ErrInvalidIdentitySignature = errors.New("absinthe: invalid identity signature")
+
+// ErrStaleIdentity is returned when a forwarded identity has expired, or
+// carries a token whose exp claim has passed
+var ErrStaleIdentity = errors.New("absinthe: forwarded identity has expired")
+
+// CredentialHeaders are the headers a gateway removes from an authenticated
+// request before forwarding it, so credentials it has already verified do not
+// reach services. The header read by an APIKeyAuthenticator is removed too.
+var CredentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", DefaultAPIKeyHeader}
+
+// identityClockSkew is the difference tolerated between the clocks of the
+// peer forwarding an identity and the peer verifying it
+const identityClockSkew = 5 * time.Second
+
+// Identity describes an authenticated caller. Gateways attach it to requests
+// they dispatch, and services receive it on RESTContext and RPCContext.
+type Identity struct {
+	// Subject identifies the caller, such as the sub claim of a JWT or the
+	// owner of an API key
+	Subject string
+
+	// Method is the authentication method used, such as "jwt" or "apikey"
+	Method string
+
+	// Claims holds the verified claims of the caller
+	Claims map[string]interface{}
+}
+
+// Authenticator verifies the credentials of an HTTP request
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+type identityContextKey struct{}
+
+type credentialHeaderContextKey struct{}
+
+// credentialHeaderReader is implemented by authenticators reading credentials
+// from a header which may not be one of the CredentialHeaders
+type credentialHeaderReader interface {
+	credentialHeader() string
+}
+
+// WithIdentity returns a copy of ctx carrying the given identity
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, identity)
+}
+
+// IdentityFromContext returns the identity carried by ctx, or nil if there is
+// none
+func IdentityFromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityContextKey{}).(*Identity)
+	return identity
+}
+
+// Authenticate wraps a gateway handler so requests are rejected with a 401
+// unless one of the given authenticators accepts their credentials. The
+// verified identity is forwarded to the peer handling the request.
+func Authenticate(next http.Handler, authenticators ...Authenticator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, authenticator := range authenticators {
+			identity, err := authenticator.Authenticate(r)
+			if err == ErrNoCredentials {
+				continue
+			}
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			ctx := WithIdentity(r.Context(), identity)
+			if reader, ok := authenticator.(credentialHeaderReader); ok {
+				ctx = context.WithValue(ctx, credentialHeaderContextKey{}, reader.credentialHeader())
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
+
+// withoutCredentials returns a copy of the headers of an authenticated request
+// with the CredentialHeaders, and the header its credentials were read from,
+// removed
+func withoutCredentials(ctx context.Context, header http.Header) http.Header {
+	header = header.Clone()
+	for _, name := range CredentialHeaders {
+		header.Del(name)
+	}
+	if name, ok := ctx.Value(credentialHeaderContextKey{}).(string); ok {
+		header.Del(name)
+	}
+	return header
+}
+
+// identityGrant is the signed form of a forwarded identity. It is bound to the
+// request it is forwarded with, and expires once the request has timed out, so
+// it cannot be replayed against other routes or after the fact.
+type identityGrant struct {
+	Identity  *Identity
+	RequestID string
+	Target    string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// restIdentityTarget returns the target an identity forwarded with a REST
+// request is bound to
+func restIdentityTarget(method, url string) string {
+	return "REST " + strings.ToUpper(method) + " " + url
+}
+
+// rpcIdentityTarget returns the target an identity forwarded with an RPC call
+// is bound to
+func rpcIdentityTarget(path string) string {
+	return "RPC " + path
+}
+
+func signIdentity(key []byte, identity *Identity, requestID, target string, now time.Time, lifetime time.Duration) ([]byte, []byte, error) {
+	if len(key) == 0 {
+		return nil, nil, ErrMissingIdentityKey
+	}
+	data, err := json.Marshal(identityGrant{
+		Identity:  identity,
+		RequestID: requestID,
+		Target:    target,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(lifetime),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return data, mac.Sum(nil), nil
+}
+
+// verifyIdentity verifies a forwarded identity was signed for the given
+// request and target, and has not expired. The exp claim of the identity, if
+// any, is checked as well.
+func verifyIdentity(key, data, signature []byte, requestID, target string, now time.Time) (*Identity, error) {
+	if len(key) == 0 {
+		return nil, ErrMissingIdentityKey
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	if !hmac.Equal(mac.Sum(nil), signature) {
+		return nil, ErrInvalidIdentitySignature
+	}
+	grant := identityGrant{}
+	if err := json.Unmarshal(data, &grant); err != nil {
+		return nil, err
+	}
+	if grant.Identity == nil || grant.RequestID != requestID || grant.Target != target {
+		return nil, ErrInvalidIdentitySignature
+	}
+	if now.Add(-identityClockSkew).After(grant.ExpiresAt) || now.Add(identityClockSkew).Before(grant.IssuedAt) {
+		return nil, ErrStaleIdentity
+	}
+	if exp, ok := grant.Identity.Claims["exp"].(float64); ok && now.Add(-identityClockSkew).After(time.Unix(int64(exp), 0)) {
+		return nil, ErrStaleIdentity
+	}
+	return grant.Identity, nil
+}
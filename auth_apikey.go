@@ -0,0 +1,75 @@
+package absinthe
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+)
+
+// ErrInvalidAPIKey is returned when an API key is not known to the store
+var ErrInvalidAPIKey = errors.New("absinthe: invalid api key")
+
+// DefaultAPIKeyHeader is the header API keys are read from unless configured
+// otherwise
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// APIKeyStore looks up the identity owning an API key. Implementations should
+// return ErrInvalidAPIKey for unknown keys.
+type APIKeyStore interface {
+	LookupAPIKey(key string) (*Identity, error)
+}
+
+// StaticAPIKeyStore is an APIKeyStore backed by a fixed map of keys to the
+// subject owning them
+type StaticAPIKeyStore map[string]string
+
+func (s StaticAPIKeyStore) LookupAPIKey(key string) (*Identity, error) {
+	for knownKey, subject := range s {
+		if subtle.ConstantTimeCompare([]byte(knownKey), []byte(key)) == 1 {
+			return &Identity{
+				Subject: subject,
+				Method:  "apikey",
+			}, nil
+		}
+	}
+	return nil, ErrInvalidAPIKey
+}
+
+// APIKeyAuthenticator verifies API keys presented in a request header against
+// an APIKeyStore
+type APIKeyAuthenticator struct {
+	Store  APIKeyStore
+	Header string
+}
+
+// NewAPIKeyAuthenticator creates an APIKeyAuthenticator reading keys from the
+// DefaultAPIKeyHeader
+func NewAPIKeyAuthenticator(store APIKeyStore) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{
+		Store:  store,
+		Header: DefaultAPIKeyHeader,
+	}
+}
+
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	key := r.Header.Get(a.credentialHeader())
+	if len(key) == 0 {
+		return nil, ErrNoCredentials
+	}
+	identity, err := a.Store.LookupAPIKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(identity.Method) == 0 {
+		identity.Method = "apikey"
+	}
+	return identity, nil
+}
+
+// credentialHeader returns the header API keys are read from
+func (a *APIKeyAuthenticator) credentialHeader() string {
+	if len(a.Header) == 0 {
+		return DefaultAPIKeyHeader
+	}
+	return a.Header
+}
@@ -0,0 +1,342 @@
+package absinthe
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned when a JWT is malformed, has an invalid
+// signature, or has claims that are not currently valid
+var ErrInvalidToken = errors.New("absinthe: invalid token")
+
+type jwtAlgorithm struct {
+	hash     crypto.Hash
+	newHash  func() hash.Hash
+	keyType  string
+	keyBytes int
+}
+
+var jwtAlgorithms = map[string]jwtAlgorithm{
+	"HS256": {crypto.SHA256, sha256.New, "oct", 0},
+	"HS384": {crypto.SHA384, sha512.New384, "oct", 0},
+	"HS512": {crypto.SHA512, sha512.New, "oct", 0},
+	"RS256": {crypto.SHA256, sha256.New, "RSA", 0},
+	"RS384": {crypto.SHA384, sha512.New384, "RSA", 0},
+	"RS512": {crypto.SHA512, sha512.New, "RSA", 0},
+	"ES256": {crypto.SHA256, sha256.New, "EC", 32},
+	"ES384": {crypto.SHA384, sha512.New384, "EC", 48},
+	"ES512": {crypto.SHA512, sha512.New, "EC", 66},
+}
+
+type jwtKey struct {
+	id        string
+	algorithm string
+	key       interface{}
+}
+
+// JWTAuthenticator verifies JWT bearer tokens signed with HMAC (HS*), RSA
+// (RS*), or ECDSA (ES*) keys loaded from local JWKS files
+type JWTAuthenticator struct {
+	// Issuer, if set, must match the iss claim of the token
+	Issuer string
+
+	// Audience, if set, must be contained in the aud claim of the token
+	Audience string
+
+	// Leeway is the amount of clock skew tolerated when checking the exp and
+	// nbf claims
+	Leeway time.Duration
+
+	keys []jwtKey
+}
+
+// NewJWTAuthenticator creates a JWTAuthenticator trusting the keys found in
+// the given JWKS files
+func NewJWTAuthenticator(jwksFiles ...string) (*JWTAuthenticator, error) {
+	a := &JWTAuthenticator{}
+	for _, file := range jwksFiles {
+		if err := a.LoadJWKS(file); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+type jwksDocument struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Alg string `json:"alg"`
+		Crv string `json:"crv"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+		K   string `json:"k"`
+	} `json:"keys"`
+}
+
+// LoadJWKS adds the keys found in a JWKS file to the trusted key set
+func (a *JWTAuthenticator) LoadJWKS(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("absinthe: error loading jwks file: %v", err)
+	}
+	document := jwksDocument{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return fmt.Errorf("absinthe: error parsing jwks file %q: %v", file, err)
+	}
+
+	for _, k := range document.Keys {
+		var key interface{}
+		switch k.Kty {
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				return fmt.Errorf("absinthe: invalid oct key %q in %q: %v", k.Kid, file, err)
+			}
+			key = secret
+
+		case "RSA":
+			n, err := decodeJWKInt(k.N)
+			if err != nil {
+				return fmt.Errorf("absinthe: invalid RSA key %q in %q: %v", k.Kid, file, err)
+			}
+			e, err := decodeJWKInt(k.E)
+			if err != nil {
+				return fmt.Errorf("absinthe: invalid RSA key %q in %q: %v", k.Kid, file, err)
+			}
+			key = &rsa.PublicKey{N: n, E: int(e.Int64())}
+
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				return fmt.Errorf("absinthe: unsupported curve %q for key %q in %q", k.Crv, k.Kid, file)
+			}
+			x, err := decodeJWKInt(k.X)
+			if err != nil {
+				return fmt.Errorf("absinthe: invalid EC key %q in %q: %v", k.Kid, file, err)
+			}
+			y, err := decodeJWKInt(k.Y)
+			if err != nil {
+				return fmt.Errorf("absinthe: invalid EC key %q in %q: %v", k.Kid, file, err)
+			}
+			key = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+
+		default:
+			return fmt.Errorf("absinthe: unsupported key type %q for key %q in %q", k.Kty, k.Kid, file)
+		}
+
+		if err := a.AddKey(k.Kid, k.Alg, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddKey adds a key to the trusted key set. The key must be a []byte secret,
+// an *rsa.PublicKey, or an *ecdsa.PublicKey. If algorithm is empty the key can
+// be used with any algorithm of its type.
+func (a *JWTAuthenticator) AddKey(id, algorithm string, key interface{}) error {
+	if len(algorithm) != 0 {
+		alg, ok := jwtAlgorithms[algorithm]
+		if !ok {
+			return fmt.Errorf("absinthe: unsupported jwt algorithm %q", algorithm)
+		}
+		if alg.keyType != jwtKeyType(key) {
+			return fmt.Errorf("absinthe: key %q cannot be used with algorithm %q", id, algorithm)
+		}
+	} else if len(jwtKeyType(key)) == 0 {
+		return fmt.Errorf("absinthe: unsupported key type %T for key %q", key, id)
+	}
+	a.keys = append(a.keys, jwtKey{
+		id:        id,
+		algorithm: algorithm,
+		key:       key,
+	})
+	return nil
+}
+
+// Authenticate verifies the bearer token found in the Authorization header of
+// the request
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) < 7 || !strings.EqualFold(authorization[:7], "bearer ") {
+		return nil, ErrNoCredentials
+	}
+	return a.Verify(strings.TrimSpace(authorization[7:]))
+}
+
+// Verify checks the signature and claims of a token, returning the identity
+// it describes
+func (a *JWTAuthenticator) Verify(token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	headerData, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := json.Unmarshal(headerData, &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+	alg, ok := jwtAlgorithms[header.Alg]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	verified := false
+	for _, key := range a.keys {
+		if len(header.Kid) != 0 && key.id != header.Kid {
+			continue
+		}
+		if len(key.algorithm) != 0 && key.algorithm != header.Alg {
+			continue
+		}
+		if jwtKeyType(key.key) != alg.keyType {
+			continue
+		}
+		if verifyJWTSignature(alg, key.key, signed, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrInvalidToken
+	}
+
+	claimsData, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	claims := make(map[string]interface{})
+	if err := json.Unmarshal(claimsData, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if err := a.validateClaims(claims); err != nil {
+		return nil, err
+	}
+
+	subject, _ := claims["sub"].(string)
+	return &Identity{
+		Subject: subject,
+		Method:  "jwt",
+		Claims:  claims,
+	}, nil
+}
+
+func (a *JWTAuthenticator) validateClaims(claims map[string]interface{}) error {
+	now := time.Now()
+	if exp, ok := claims["exp"].(float64); ok {
+		if now.Add(-a.Leeway).After(time.Unix(int64(exp), 0)) {
+			return ErrInvalidToken
+		}
+	}
+	if nbf, ok := claims["nbf"].(float64); ok {
+		if now.Add(a.Leeway).Before(time.Unix(int64(nbf), 0)) {
+			return ErrInvalidToken
+		}
+	}
+	if len(a.Issuer) != 0 {
+		if iss, _ := claims["iss"].(string); iss != a.Issuer {
+			return ErrInvalidToken
+		}
+	}
+	if len(a.Audience) != 0 {
+		found := false
+		switch aud := claims["aud"].(type) {
+		case string:
+			found = aud == a.Audience
+		case []interface{}:
+			for _, v := range aud {
+				if s, _ := v.(string); s == a.Audience {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			return ErrInvalidToken
+		}
+	}
+	return nil
+}
+
+func verifyJWTSignature(alg jwtAlgorithm, key interface{}, signed, signature []byte) bool {
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(alg.newHash, key)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), signature)
+
+	case *rsa.PublicKey:
+		h := alg.newHash()
+		h.Write(signed)
+		return rsa.VerifyPKCS1v15(key, alg.hash, h.Sum(nil), signature) == nil
+
+	case *ecdsa.PublicKey:
+		if len(signature) != 2*alg.keyBytes {
+			return false
+		}
+		h := alg.newHash()
+		h.Write(signed)
+		r := new(big.Int).SetBytes(signature[:alg.keyBytes])
+		s := new(big.Int).SetBytes(signature[alg.keyBytes:])
+		return ecdsa.Verify(key, h.Sum(nil), r, s)
+	}
+	return false
+}
+
+func jwtKeyType(key interface{}) string {
+	switch key.(type) {
+	case []byte:
+		return "oct"
+	case *rsa.PublicKey:
+		return "RSA"
+	case *ecdsa.PublicKey:
+		return "EC"
+	}
+	return ""
+}
+
+func decodeJWKInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,230 @@
+package absinthe
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeTestJWT(t *testing.T, header, claims map[string]interface{}, sign func([]byte) []byte) string {
+	headerData, err := json.Marshal(header)
+	assert.NoError(t, err)
+	claimsData, err := json.Marshal(claims)
+	assert.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(headerData) + "." + base64.RawURLEncoding.EncodeToString(claimsData)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func writeTestJWKS(t *testing.T, keys ...map[string]string) string {
+	data, err := json.Marshal(map[string]interface{}{"keys": keys})
+	assert.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, ioutil.WriteFile(file, data, 0600))
+	return file
+}
+
+func TestJWTAuthenticatorHS256(t *testing.T) {
+	secret := []byte("secret")
+	file := writeTestJWKS(t, map[string]string{
+		"kty": "oct",
+		"kid": "hs",
+		"alg": "HS256",
+		"k":   base64.RawURLEncoding.EncodeToString(secret),
+	})
+	authenticator, err := NewJWTAuthenticator(file)
+	assert.NoError(t, err)
+
+	sign := func(data []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(data)
+		return mac.Sum(nil)
+	}
+	header := map[string]interface{}{"alg": "HS256", "kid": "hs"}
+
+	token := encodeTestJWT(t, header, map[string]interface{}{
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}, sign)
+	identity, err := authenticator.Verify(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", identity.Subject)
+	assert.Equal(t, "jwt", identity.Method)
+
+	expiredToken := encodeTestJWT(t, header, map[string]interface{}{
+		"sub": "user-1",
+		"exp": time.Now().Add(-time.Minute).Unix(),
+	}, sign)
+	_, err = authenticator.Verify(expiredToken)
+	assert.Equal(t, ErrInvalidToken, err)
+
+	forgedToken := encodeTestJWT(t, header, map[string]interface{}{"sub": "user-1"}, func(data []byte) []byte {
+		mac := hmac.New(sha256.New, []byte("wrong"))
+		mac.Write(data)
+		return mac.Sum(nil)
+	})
+	_, err = authenticator.Verify(forgedToken)
+	assert.Equal(t, ErrInvalidToken, err)
+
+	noneToken := encodeTestJWT(t, map[string]interface{}{"alg": "none"}, map[string]interface{}{"sub": "user-1"}, func([]byte) []byte {
+		return nil
+	})
+	_, err = authenticator.Verify(noneToken)
+	assert.Equal(t, ErrInvalidToken, err)
+}
+
+func TestJWTAuthenticatorRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	file := writeTestJWKS(t, map[string]string{
+		"kty": "RSA",
+		"kid": "rs",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	})
+	authenticator, err := NewJWTAuthenticator(file)
+	assert.NoError(t, err)
+	authenticator.Issuer = "issuer"
+
+	sign := func(data []byte) []byte {
+		digest := sha256.Sum256(data)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		assert.NoError(t, err)
+		return signature
+	}
+	header := map[string]interface{}{"alg": "RS256", "kid": "rs"}
+
+	identity, err := authenticator.Verify(encodeTestJWT(t, header, map[string]interface{}{
+		"sub": "user-2",
+		"iss": "issuer",
+	}, sign))
+	assert.NoError(t, err)
+	assert.Equal(t, "user-2", identity.Subject)
+
+	_, err = authenticator.Verify(encodeTestJWT(t, header, map[string]interface{}{
+		"sub": "user-2",
+		"iss": "someone-else",
+	}, sign))
+	assert.Equal(t, ErrInvalidToken, err)
+}
+
+func TestJWTAuthenticatorES256(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	authenticator, err := NewJWTAuthenticator()
+	assert.NoError(t, err)
+	assert.NoError(t, authenticator.AddKey("es", "ES256", &key.PublicKey))
+	authenticator.Audience = "api"
+
+	token := encodeTestJWT(t, map[string]interface{}{"alg": "ES256"}, map[string]interface{}{
+		"sub": "user-3",
+		"aud": []string{"web", "api"},
+	}, func(data []byte) []byte {
+		digest := sha256.Sum256(data)
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		assert.NoError(t, err)
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return signature
+	})
+	identity, err := authenticator.Verify(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-3", identity.Subject)
+}
+
+func TestAuthenticate(t *testing.T) {
+	keys := NewAPIKeyAuthenticator(StaticAPIKeyStore{"key-1": "service-a"})
+
+	var identity *Identity
+	handler := Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity = IdentityFromContext(r.Context())
+	}), keys)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set(DefaultAPIKeyHeader, "key-2")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	request = httptest.NewRequest("GET", "/", nil)
+	request.Header.Set(DefaultAPIKeyHeader, "key-1")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "service-a", identity.Subject)
+	assert.Equal(t, "apikey", identity.Method)
+}
+
+func TestAuthenticateWithoutCredentials(t *testing.T) {
+	keys := &APIKeyAuthenticator{Store: StaticAPIKeyStore{"key-1": "service-a"}, Header: "X-Service-Key"}
+
+	var header http.Header
+	handler := Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = withoutCredentials(r.Context(), r.Header)
+	}), keys)
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("X-Service-Key", "key-1")
+	request.Header.Set("Authorization", "Bearer token")
+	request.Header.Set("Cookie", "session=s1")
+	request.Header.Set("Accept", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	assert.Equal(t, http.Header{"Accept": []string{"application/json"}}, header)
+	assert.Equal(t, "key-1", request.Header.Get("X-Service-Key"))
+}
+
+func TestSignedIdentity(t *testing.T) {
+	key := []byte("identity-key")
+	now := time.Now()
+	target := restIdentityTarget("get", "/users/1")
+	data, signature, err := signIdentity(key, &Identity{Subject: "user-1", Method: "jwt"}, "req-1", target, now, time.Minute)
+	assert.NoError(t, err)
+
+	identity, err := verifyIdentity(key, data, signature, "req-1", target, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", identity.Subject)
+
+	_, err = verifyIdentity([]byte("other-key"), data, signature, "req-1", target, now)
+	assert.Equal(t, ErrInvalidIdentitySignature, err)
+
+	_, err = verifyIdentity(key, data, signature, "req-2", target, now)
+	assert.Equal(t, ErrInvalidIdentitySignature, err)
+	_, err = verifyIdentity(key, data, signature, "req-1", restIdentityTarget("delete", "/users/1"), now)
+	assert.Equal(t, ErrInvalidIdentitySignature, err)
+	_, err = verifyIdentity(key, data, signature, "req-1", rpcIdentityTarget("user.1.get"), now)
+	assert.Equal(t, ErrInvalidIdentitySignature, err)
+
+	_, err = verifyIdentity(key, data, signature, "req-1", target, now.Add(time.Minute+identityClockSkew+time.Second))
+	assert.Equal(t, ErrStaleIdentity, err)
+	_, err = verifyIdentity(key, data, signature, "req-1", target, now.Add(-identityClockSkew-time.Second))
+	assert.Equal(t, ErrStaleIdentity, err)
+
+	expired := &Identity{Subject: "user-1", Claims: map[string]interface{}{"exp": float64(now.Add(-time.Hour).Unix())}}
+	data, signature, err = signIdentity(key, expired, "req-1", target, now, time.Minute)
+	assert.NoError(t, err)
+	_, err = verifyIdentity(key, data, signature, "req-1", target, now)
+	assert.Equal(t, ErrStaleIdentity, err)
+
+	_, _, err = signIdentity(nil, &Identity{}, "req-1", target, now, time.Minute)
+	assert.Equal(t, ErrMissingIdentityKey, err)
+}
@@ -1,9 +1,29 @@
 package absinthe
 
 import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"log/slog"
+	"net/http"
 	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// ErrNoRPCHandler is returned by Call when no known peer handles the rpc path
+var ErrNoRPCHandler = errors.New("absinthe: no peer handles the given rpc path")
+
+// ErrNoClient is returned when a context created outside of a client, such as
+// by RESTRouter.ServeHTTP, is used to make calls to other peers
+var ErrNoClient = errors.New("absinthe: context is not attached to a client")
+
 // Client manages the connection to Nats, as well as provides methods for
 // binding routes and handlers, and dispatching HTTP requests and RPC calls
 type Client struct {
@@ -13,6 +33,19 @@ type Client struct {
 	*RPCRouter
 	options Options
 	indexer Indexer
+	logger  *slog.Logger
+
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+
+	healthChecks healthChecks
+	rates        requestRates
+
+	// peerMu guards the routes and patterns of Peer, which are announced
+	// while new handlers may be bound
+	peerMu sync.RWMutex
+
+	encryptionKey *ecdh.PrivateKey
 }
 
 // Connect creates a new Client using the given Nats url, attempts to make a
@@ -34,11 +67,33 @@ func (c *Client) connect() error {
 	peer, _ := NewPeer(c.options.Name, c.options.Version, "")
 	c.Peer = *peer
 
+	logger := c.options.Logger
+	if logger == nil {
+		logger = slog.New(discardHandler{})
+	}
+	c.logger = logger.With("peer_id", c.ID, "namespace", c.options.Namespace)
+	c.setupTracing()
+
+	if c.options.EncryptPayloads {
+		if len(c.options.TrustedKeys) == 0 {
+			return ErrUntrustedEncryptionKeys
+		}
+		key, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		c.encryptionKey = key
+		c.Peer.EncryptionKey = key.PublicKey().Bytes()
+	}
+
 	conn, err := NewConn(&c.options)
 	if err != nil {
 		return err
 	}
 	c.Conn = *conn
+	if c.options.Metrics != nil {
+		c.Conn.transport = c.options.Metrics.wrapTransport(c.Conn.transport, c.Peer)
+	}
 
 	c.indexer = NewIndexer(c)
 	c.RESTRouter = NewRESTRouter()
@@ -46,11 +101,359 @@ func (c *Client) connect() error {
 	c.RPCRouter = NewRPCRouter()
 	c.RPCRouter.client = c
 
+	if _, err := c.Subscribe("REST-"+c.ID, func(subject, reply string, request *RESTRequest) {
+		if !c.acceptReply(reply) {
+			return
+		}
+		go c.handleRESTRequest(reply, request)
+	}); err != nil {
+		return err
+	}
+	if _, err := c.Subscribe("RPC-"+c.ID, func(subject, reply string, request *RPCRequest) {
+		if !c.acceptReply(reply) {
+			return
+		}
+		go c.handleRPCRequest(reply, request)
+	}); err != nil {
+		return err
+	}
+	if _, err := c.Subscribe("HEALTH-"+c.ID, func(subject, reply string, requestingPeerID string) {
+		if !c.acceptReply(reply) {
+			return
+		}
+		go c.handleHealthRequest(reply)
+	}); err != nil {
+		return err
+	}
+
 	go c.indexer.Start()
 
 	return nil
 }
 
+// acceptReply reports whether a request with the given reply subject should be
+// handled. Requests whose reply subject is outside the inbox of the namespace
+// are dropped.
+func (c *Client) acceptReply(reply string) bool {
+	if err := c.validateReply(reply); err != nil {
+		c.logger.Warn("dropped request with invalid reply subject", "error", err)
+		return false
+	}
+	return true
+}
+
+// Indexer returns the indexer tracking the peers known to the client
+func (c *Client) Indexer() *Indexer {
+	return &c.indexer
+}
+
+// Close stops indexing and closes the connection of the client
+func (c *Client) Close() error {
+	c.indexer.Stop()
+	return c.Conn.Close()
+}
+
+// Call makes an RPC call to a peer with a handler matching the given path, and
+// returns the data it responds with
+func (c *Client) Call(path string, data []byte) ([]byte, error) {
+	return c.CallWithContext(context.Background(), path, data)
+}
+
+// CallWithContext is like Call, but traces the call as a child of the span
+// carried by ctx, and gives up once ctx is done
+func (c *Client) CallWithContext(ctx context.Context, path string, data []byte) ([]byte, error) {
+	return c.call(ctx, path, data, newRequestID(), nil)
+}
+
+// Codec returns the codec typed handlers and calls of the client use
+func (c *Client) Codec() Codec {
+	if c.options.Codec == nil {
+		return JSONCodec{}
+	}
+	return c.options.Codec
+}
+
+// Logger returns the logger of the client. Its records carry the ID of the
+// peer and the namespace of the client.
+func (c *Client) Logger() *slog.Logger {
+	return c.logger
+}
+
+// call makes an RPC call, forwarding the identity of the caller if there is
+// one. The identity is signed anew for the call, so it is bound to its path
+// and request ID.
+func (c *Client) call(ctx context.Context, path string, data []byte, requestID string, identity *Identity) ([]byte, error) {
+	logger := c.logger.With("request_id", requestID, "path", path)
+
+	peer, pattern, ok := c.indexer.FindRPCPeer(path)
+	if !ok {
+		logger.Debug("no peer handles rpc path")
+		return nil, ErrNoRPCHandler
+	}
+	logger = logger.With("route", pattern.PatternSrc, "remote_peer_id", peer.ID)
+
+	if len(pattern.Policies) != 0 {
+		params, _ := pattern.FindParams(path)
+		if err := authorize(pattern.Policies, identity, params); err != nil {
+			return nil, err
+		}
+	}
+
+	request := &RPCRequest{
+		Path:      path,
+		RequestID: requestID,
+		Data:      data,
+	}
+	identityData, identitySignature, err := c.signForwardedIdentity(identity, requestID, rpcIdentityTarget(path))
+	if err != nil {
+		logger.Error("failed to sign identity", "error", err)
+		return nil, err
+	}
+	request.Identity, request.IdentitySignature = identityData, identitySignature
+	response, payloadKey, err := c.dispatchRPC(ctx, peer, pattern, request)
+	if err != nil {
+		logger.Warn("failed to dispatch rpc call", "error", err)
+		return nil, err
+	}
+	if payloadKey != nil {
+		if len(response.Sealed) == 0 {
+			logger.Warn("rejected plaintext rpc response")
+			return nil, ErrPlaintextPayload
+		}
+		if err := response.open(payloadKey); err != nil {
+			logger.Warn("failed to open rpc response", "error", err)
+			return nil, err
+		}
+	}
+	if err := response.err(); err != nil {
+		return nil, err
+	}
+	return response.Data, nil
+}
+
+// dispatchRPC sends a call to a peer within a client span, carrying the trace
+// context of the span in the request. The request is sealed once its trace
+// context is set, as the trace context is bound to the sealed payload, and the
+// key the response is sealed with is returned.
+func (c *Client) dispatchRPC(ctx context.Context, peer Peer, pattern RPCPattern, request *RPCRequest) (*RPCResponse, []byte, error) {
+	attrs := append(peerAttributes(peer),
+		attribute.String("rpc.system", "absinthe"),
+		attribute.String("rpc.method", request.Path),
+		AttributeRoute.String(pattern.PatternSrc),
+	)
+	ctx, span := c.startSpan(ctx, pattern.PatternSrc, trace.SpanKindClient, request.RequestID, attrs...)
+	request.TraceContext = c.injectTraceContext(ctx)
+	payloadKey, err := c.sealRPCRequest(peer, request)
+	if err != nil {
+		endSpan(span, err)
+		return nil, nil, err
+	}
+
+	done := c.startDispatchMetrics(MetricsKindRPC)
+
+	ctx, cancel := context.WithTimeout(ctx, c.options.RequestTimeout)
+	defer cancel()
+	response := &RPCResponse{}
+	if err := c.RequestWithContext(ctx, "RPC-"+peer.ID, request, response); err != nil {
+		done("", pattern.PatternSrc, peer, true)
+		endSpan(span, err)
+		return nil, nil, err
+	}
+	done("", pattern.PatternSrc, peer, len(response.Error) != 0)
+	if len(response.Error) != 0 {
+		span.SetStatus(codes.Error, response.Error)
+	}
+	span.End()
+	return response, payloadKey, nil
+}
+
+func (c *Client) handleRESTRequest(reply string, request *RESTRequest) {
+	logger := c.logger.With("request_id", request.RequestID, "method", request.Method, "url", request.URL)
+
+	payloadKey, err := c.payloadKeyFor(request.SenderKey)
+	if err == nil && payloadKey != nil {
+		err = request.open(payloadKey)
+	}
+	if err != nil {
+		logger.Warn("failed to open rest request", "error", err)
+		c.publishReply(reply, &RESTResponse{Status: http.StatusBadRequest})
+		return
+	}
+
+	ctx, span := c.startSpan(c.extractTraceContext(request.TraceContext), request.Method, trace.SpanKindServer, request.RequestID,
+		attribute.String("http.request.method", request.Method),
+		AttributePeerID.String(c.ID),
+	)
+	context := newRESTContext(c, request)
+	context.ctx = ctx
+	done := c.startHandlerMetrics(MetricsKindREST)
+
+	identity, err := c.verifyForwardedIdentity(request.Identity, request.IdentitySignature, request.RequestID, restIdentityTarget(request.Method, request.URL))
+	if err != nil {
+		logger.Warn("rejected forwarded identity", "error", err)
+		context.Status(http.StatusUnauthorized).End()
+	} else {
+		context.Identity = identity
+		go c.RESTRouter.Exec(context)
+	}
+
+	response := context.response
+	route := ""
+	select {
+	case <-context.done:
+		if context.route != nil {
+			route = context.route.PatternSrc
+			span.SetName(request.Method + " " + route)
+			span.SetAttributes(attribute.String("http.route", route), AttributeRoute.String(route))
+		}
+	case <-time.After(c.options.RequestTimeout):
+		logger.Warn("rest handler timed out")
+		response = &RESTResponse{Status: http.StatusGatewayTimeout}
+	}
+	done(request.Method, route, response.Status >= http.StatusInternalServerError)
+	endRESTSpan(span, response.Status)
+	if payloadKey != nil {
+		if err := response.seal(payloadKey); err != nil {
+			logger.Error("failed to seal rest response", "error", err)
+			response = &RESTResponse{Status: http.StatusInternalServerError}
+		}
+	}
+	c.publishReply(reply, response)
+}
+
+func (c *Client) handleRPCRequest(reply string, request *RPCRequest) {
+	logger := c.logger.With("request_id", request.RequestID, "path", request.Path)
+
+	payloadKey, err := c.payloadKeyFor(request.SenderKey)
+	if err == nil && payloadKey != nil {
+		err = request.open(payloadKey)
+	}
+	if err != nil {
+		logger.Warn("failed to open rpc request", "error", err)
+		c.publishReply(reply, &RPCResponse{Error: err.Error()})
+		return
+	}
+
+	ctx, span := c.startSpan(c.extractTraceContext(request.TraceContext), request.Path, trace.SpanKindServer, request.RequestID,
+		attribute.String("rpc.system", "absinthe"),
+		attribute.String("rpc.method", request.Path),
+		AttributePeerID.String(c.ID),
+	)
+	context := newRPCContext(c, request)
+	context.ctx = ctx
+	done := c.startHandlerMetrics(MetricsKindRPC)
+
+	identity, err := c.verifyForwardedIdentity(request.Identity, request.IdentitySignature, request.RequestID, rpcIdentityTarget(request.Path))
+	if err != nil {
+		logger.Warn("rejected forwarded identity", "error", err)
+		context.Error(err)
+	} else {
+		context.Identity = identity
+		go func() {
+			if !c.RPCRouter.Exec(context) {
+				context.Error(ErrNoRPCHandler)
+			}
+		}()
+	}
+
+	route := ""
+	select {
+	case <-context.done:
+		if context.pattern != nil {
+			route = context.pattern.PatternSrc
+			span.SetName(route)
+			span.SetAttributes(AttributeRoute.String(route))
+		}
+	case <-time.After(c.options.RequestTimeout):
+		logger.Warn("rpc handler timed out")
+		context.Error(errors.New("absinthe: rpc handler timed out"))
+	}
+	response := context.response
+	done("", route, len(response.Error) != 0)
+	if len(response.Error) != 0 {
+		span.SetStatus(codes.Error, response.Error)
+	}
+	span.End()
+	if payloadKey != nil {
+		if err := response.seal(payloadKey); err != nil {
+			logger.Error("failed to seal rpc response", "error", err)
+			response = &RPCResponse{Error: err.Error()}
+		}
+	}
+	c.publishReply(reply, response)
+}
+
+// sealRESTRequest encrypts a request for the given peer if it advertises an
+// encryption key, returning the key the response will be encrypted with
+func (c *Client) sealRESTRequest(peer Peer, request *RESTRequest) ([]byte, error) {
+	if len(peer.EncryptionKey) == 0 && !c.options.EncryptPayloads {
+		return nil, nil
+	}
+	payloadKey, senderKey, err := newRequestKey(peer.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	request.SenderKey = senderKey
+	return payloadKey, request.seal(payloadKey)
+}
+
+// sealRPCRequest encrypts a call for the given peer if it advertises an
+// encryption key, returning the key the response will be encrypted with
+func (c *Client) sealRPCRequest(peer Peer, request *RPCRequest) ([]byte, error) {
+	if len(peer.EncryptionKey) == 0 && !c.options.EncryptPayloads {
+		return nil, nil
+	}
+	payloadKey, senderKey, err := newRequestKey(peer.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	request.SenderKey = senderKey
+	return payloadKey, request.seal(payloadKey)
+}
+
+// payloadKeyFor returns the key used to decrypt a request sent with the given
+// sender key. Plaintext requests are refused if payload encryption is enabled.
+func (c *Client) payloadKeyFor(senderKey []byte) ([]byte, error) {
+	if len(senderKey) == 0 {
+		if c.options.EncryptPayloads {
+			return nil, ErrPlaintextPayload
+		}
+		return nil, nil
+	}
+	return openRequestKey(c.encryptionKey, senderKey)
+}
+
+func (c *Client) addRESTRoute(route RESTRoute) {
+	c.peerMu.Lock()
+	c.Peer.AddRESTRoute(route)
+	c.peerMu.Unlock()
+}
+
+func (c *Client) addRPCPattern(pattern RPCPattern) {
+	c.peerMu.Lock()
+	c.Peer.AddRPCPattern(pattern)
+	c.peerMu.Unlock()
+}
+
+// signForwardedIdentity signs an identity to forward with a request to the
+// given target. The signature expires once the request has timed out.
+func (c *Client) signForwardedIdentity(identity *Identity, requestID, target string) ([]byte, []byte, error) {
+	if identity == nil {
+		return nil, nil, nil
+	}
+	return signIdentity(c.options.IdentityKey, identity, requestID, target, time.Now(), c.options.RequestTimeout)
+}
+
+// verifyForwardedIdentity verifies an identity forwarded with a request to the
+// given target, rejecting it if it was signed for another request or target,
+// or has expired
+func (c *Client) verifyForwardedIdentity(data, signature []byte, requestID, target string) (*Identity, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return verifyIdentity(c.options.IdentityKey, data, signature, requestID, target, time.Now())
+}
+
 func processURLString(url string) []string {
 	urls := strings.Split(url, ",")
 	for i, s := range urls {
@@ -0,0 +1,111 @@
+package absinthe_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	absinthe "github.com/RobertWHurst/Absinthe"
+	"github.com/RobertWHurst/Absinthe/absinthetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientMemoryTransport(t *testing.T) {
+	cluster := absinthetest.NewCluster(t)
+	gateway := cluster.Connect("gateway")
+	service := cluster.Connect("service")
+
+	assert.NoError(t, service.Get("/users/:id", func(c *absinthe.RESTContext) {
+		c.Status(http.StatusCreated).Write([]byte("user " + c.Params["id"]))
+		c.End()
+	}))
+	assert.NoError(t, service.Handle("user.$id.get", func(c *absinthe.RPCContext) {
+		c.Respond([]byte("user " + c.Params["id"]))
+	}))
+
+	cluster.WaitForREST(gateway, "GET", "/users/1")
+	cluster.WaitForRPC(gateway, "user.2.get")
+
+	recorder := httptest.NewRecorder()
+	gateway.ServeHTTP(recorder, httptest.NewRequest("GET", "/users/1", nil))
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	assert.Equal(t, "user 1", recorder.Body.String())
+
+	replies := make(chan string, 1)
+	subscription, err := cluster.Network.NewTransport().Subscribe(gateway.Namespace+"."+absinthe.InboxToken+".>", func(msg *absinthe.Message) {
+		select {
+		case replies <- msg.Subject:
+		default:
+		}
+	})
+	assert.NoError(t, err)
+	defer subscription.Unsubscribe()
+
+	data, err := gateway.Call("user.2.get", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("user 2"), data)
+	select {
+	case reply := <-replies:
+		assert.True(t, strings.HasPrefix(reply, gateway.Namespace+"."+absinthe.InboxToken+"."), reply)
+	case <-time.After(absinthetest.DefaultWaitTimeout):
+		t.Error("responses should be sent to an inbox within the namespace")
+	}
+
+	_, err = gateway.Call("user.2.delete", nil)
+	assert.Equal(t, absinthe.ErrNoRPCHandler, err)
+}
+
+func TestClientMiddlewareNotAdvertised(t *testing.T) {
+	cluster := absinthetest.NewCluster(t)
+	gateway := cluster.Connect("gateway")
+	service := cluster.Connect("service")
+
+	assert.NoError(t, service.Use(func(c *absinthe.RESTContext) {
+		c.SetHeader("X-Middleware", "1")
+		c.Next()
+	}))
+	assert.NoError(t, service.Get("/users/:id", func(c *absinthe.RESTContext) {
+		c.End()
+	}))
+	cluster.WaitForREST(gateway, "GET", "/users/1")
+
+	assert.Len(t, service.Peer.RESTRoutes, 1)
+
+	recorder := httptest.NewRecorder()
+	gateway.ServeHTTP(recorder, httptest.NewRequest("GET", "/users/1", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "1", recorder.Header().Get("X-Middleware"))
+
+	recorder = httptest.NewRecorder()
+	gateway.ServeHTTP(recorder, httptest.NewRequest("GET", "/nothing", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestClientRequestID(t *testing.T) {
+	cluster := absinthetest.NewCluster(t)
+	gateway := cluster.Connect("gateway")
+	service := cluster.Connect("service")
+	backend := cluster.Connect("backend")
+
+	assert.NoError(t, service.Get("/users/:id", func(c *absinthe.RESTContext) {
+		data, err := c.Call("user.get", nil)
+		assert.NoError(t, err)
+		c.Write([]byte(c.RequestID + " " + string(data)))
+		c.End()
+	}))
+	assert.NoError(t, backend.Handle("user.get", func(c *absinthe.RPCContext) {
+		c.Respond([]byte(c.RequestID))
+	}))
+
+	cluster.WaitForRPC(service, "user.get")
+	cluster.WaitForREST(gateway, "GET", "/users/1")
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/users/1", nil)
+	req.Header.Set(absinthe.RequestIDHeader, "abc123")
+	gateway.ServeHTTP(recorder, req)
+	assert.Equal(t, "abc123 abc123", recorder.Body.String())
+	assert.Equal(t, "abc123", recorder.Header().Get(absinthe.RequestIDHeader))
+}
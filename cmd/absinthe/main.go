@@ -0,0 +1,515 @@
+// Command absinthe joins an absinthe namespace as a passive observer, to
+// inspect the peers in it and send them requests without running a gateway.
+//
+// Usage:
+//
+//	absinthe [flags] peers
+//	absinthe [flags] routes
+//	absinthe [flags] call <rpc.path> [--data <json>]
+//	absinthe [flags] http <method> <path> [--data <body>] [--header <name: value>]... [--include]
+//	absinthe [flags] watch
+//	absinthe [flags] tap [--route <route>] [--peer <id or name>] [--status <code or class>]
+//	                     [--redact-header <name>]... [--redact-field <name>]... [--output <file>]
+//	absinthe [flags] record <file> [tap flags]
+//	absinthe [flags] replay <file> [--route <route>]... [--ignore-field <field>]... [--header <name>]... [--json]
+//
+// The flags configure the connection the same way the Options of a client do,
+// and must come before the command. Run absinthe -h to list them.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	absinthe "github.com/RobertWHurst/Absinthe"
+)
+
+const usage = `usage: absinthe [flags] <command> [args]
+
+commands:
+  peers                               list peers with their versions and routes
+  routes                              print the route table of the namespace
+  call <rpc.path> [--data <json>]     make an RPC call
+  http <method> <path> [--data <body>] [--header <name: value>]... [--include]
+                                      dispatch a REST request to the peer serving it
+  watch                               stream peers joining and leaving
+  tap [--route <route>] [--peer <id or name>] [--status <code or class>]
+      [--redact-header <name>]... [--redact-field <name>]... [--output <file>]
+                                      write requests and responses as JSON lines
+  record <file> [tap flags]           append requests and responses to a file
+  replay <file> [--route <route>]... [--ignore-field <field>]... [--header <name>]... [--json]
+                                      replay recorded requests and report changed responses
+
+flags:
+`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command given by args, and returns the exit code.
+// extraOptions are applied after the options set by flags.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer, extraOptions ...absinthe.Option) int {
+	flags := flag.NewFlagSet("absinthe", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	servers := flags.String("servers", absinthe.DefaultURL, "comma separated nats server urls")
+	namespace := flags.String("namespace", "absinthe", "namespace to join")
+	secure := flags.Bool("tls", false, "connect with TLS")
+	rootCA := flags.String("tls-ca", "", "root CA file to verify servers with")
+	clientCert := flags.String("tls-cert", "", "client certificate file")
+	clientKey := flags.String("tls-key", "", "client certificate key file")
+	creds := flags.String("creds", "", "user credentials file")
+	user := flags.String("user", "", "user to authenticate with")
+	password := flags.String("password", "", "password to authenticate with")
+	token := flags.String("token", "", "token to authenticate with")
+	timeout := flags.Duration("timeout", absinthe.DefaultRequestTimeout, "time to wait for responses")
+	wait := flags.Duration("wait", 5*time.Second, "time to wait for peers to be discovered")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	options := []absinthe.Option{
+		absinthe.Name("absinthe-cli"),
+		absinthe.Passive(),
+		absinthe.Namespace(*namespace),
+		absinthe.RequestTimeout(*timeout),
+	}
+	if *secure {
+		options = append(options, absinthe.Secure())
+	}
+	if *rootCA != "" {
+		options = append(options, absinthe.RootCAs(*rootCA))
+	}
+	if *clientCert != "" || *clientKey != "" {
+		options = append(options, absinthe.ClientCert(*clientCert, *clientKey))
+	}
+	if *creds != "" {
+		options = append(options, absinthe.UserCredentials(*creds))
+	}
+	if *user != "" || *password != "" {
+		options = append(options, absinthe.UserInfo(*user, *password))
+	}
+	if *token != "" {
+		options = append(options, absinthe.Token(*token))
+	}
+	options = append(options, extraOptions...)
+
+	client, err := absinthe.Connect(*servers, options...)
+	if err != nil {
+		fmt.Fprintln(stderr, "absinthe:", err)
+		return 1
+	}
+	defer client.Close()
+
+	command, commandArgs := flags.Arg(0), flags.Args()[1:]
+	if command == "watch" {
+		err = watch(ctx, client, stdout)
+	} else if command == "tap" {
+		err = tap(ctx, client, commandArgs, stdout, stderr)
+	} else if command == "record" {
+		err = record(ctx, client, commandArgs, stdout, stderr)
+	} else {
+		waitForIndexer(ctx, client, *wait)
+		switch command {
+		case "peers":
+			err = printPeers(client, stdout)
+		case "routes":
+			err = printRoutes(client, stdout)
+		case "call":
+			err = call(ctx, client, commandArgs, stdout, stderr)
+		case "http":
+			err = dispatch(client, commandArgs, stdout, stderr)
+		case "replay":
+			err = replay(ctx, client, commandArgs, stdout, stderr)
+		default:
+			flags.Usage()
+			return 2
+		}
+	}
+
+	if errors.Is(err, errUsage) {
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "absinthe:", err)
+		return 1
+	}
+	return 0
+}
+
+// errUsage is returned by commands given invalid arguments, after printing
+// their usage
+var errUsage = errors.New("invalid usage")
+
+// errChangedResponses is returned by the replay command when replayed
+// responses differ from the recorded ones
+var errChangedResponses = errors.New("responses changed")
+
+// errFailedRequest is returned by the http command when the response has an
+// error status
+var errFailedRequest = errors.New("request failed")
+
+func waitForIndexer(ctx context.Context, client *absinthe.Client, wait time.Duration) {
+	deadline := time.Now().Add(wait)
+	for !client.Indexer().Ready() && time.Now().Before(deadline) && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func printPeers(client *absinthe.Client, stdout io.Writer) error {
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tVERSION\tROUTES")
+	for _, peer := range client.Indexer().Peers() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", peer.ID, peer.Name, peerVersion(peer), strings.Join(peerRoutes(peer), ", "))
+	}
+	return w.Flush()
+}
+
+func printRoutes(client *absinthe.Client, stdout io.Writer) error {
+	type row struct {
+		kind, method, pattern string
+		peers                 []string
+	}
+	rows := make(map[string]*row)
+	for _, peer := range client.Indexer().Peers() {
+		for key, route := range peer.RESTRoutes {
+			if _, ok := rows[key]; !ok {
+				rows[key] = &row{kind: "rest", method: strings.ToUpper(route.Method), pattern: route.PatternSrc}
+			}
+			rows[key].peers = append(rows[key].peers, peer.Name+"@"+peer.ID)
+		}
+		for key, pattern := range peer.RPCPatterns {
+			if _, ok := rows[key]; !ok {
+				rows[key] = &row{kind: "rpc", pattern: pattern.PatternSrc}
+			}
+			rows[key].peers = append(rows[key].peers, peer.Name+"@"+peer.ID)
+		}
+	}
+
+	sortedRows := make([]*row, 0, len(rows))
+	for _, r := range rows {
+		sortedRows = append(sortedRows, r)
+	}
+	sort.Slice(sortedRows, func(a, b int) bool {
+		if sortedRows[a].kind != sortedRows[b].kind {
+			return sortedRows[a].kind == "rest"
+		}
+		if sortedRows[a].pattern != sortedRows[b].pattern {
+			return sortedRows[a].pattern < sortedRows[b].pattern
+		}
+		return sortedRows[a].method < sortedRows[b].method
+	})
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tMETHOD\tPATTERN\tPEERS")
+	for _, r := range sortedRows {
+		sort.Strings(r.peers)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.kind, r.method, r.pattern, strings.Join(r.peers, ", "))
+	}
+	return w.Flush()
+}
+
+func call(ctx context.Context, client *absinthe.Client, args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("call", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	data := flags.String("data", "", "data to call with")
+	positional, err := parseInterspersed(flags, args)
+	if err != nil || len(positional) != 1 {
+		fmt.Fprintln(stderr, "usage: absinthe call <rpc.path> [--data <json>]")
+		return errUsage
+	}
+
+	var payload []byte
+	if *data != "" {
+		payload = []byte(*data)
+	}
+	response, err := client.CallWithContext(ctx, positional[0], payload)
+	if err != nil {
+		return err
+	}
+	stdout.Write(response)
+	if len(response) != 0 && response[len(response)-1] != '\n' {
+		fmt.Fprintln(stdout)
+	}
+	return nil
+}
+
+func dispatch(client *absinthe.Client, args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("http", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	data := flags.String("data", "", "request body")
+	include := flags.Bool("include", false, "print the response status and headers")
+	headers := headerFlags{}
+	flags.Var(&headers, "header", "request header as name: value, may be repeated")
+	positional, err := parseInterspersed(flags, args)
+	if err != nil || len(positional) != 2 {
+		fmt.Fprintln(stderr, "usage: absinthe http <method> <path> [--data <body>] [--header <name: value>]... [--include]")
+		return errUsage
+	}
+
+	req, err := http.NewRequest(strings.ToUpper(positional[0]), positional[1], strings.NewReader(*data))
+	if err != nil {
+		return err
+	}
+	for _, header := range headers {
+		name, value, _ := strings.Cut(header, ":")
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	w := &responseWriter{header: make(http.Header)}
+	client.ServeHTTP(w, req)
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	if *include {
+		fmt.Fprintf(stdout, "%d %s\n", w.status, http.StatusText(w.status))
+		w.header.Write(stdout)
+		fmt.Fprintln(stdout)
+	}
+	stdout.Write(w.body.Bytes())
+	if w.status >= 400 {
+		return fmt.Errorf("%w with status %d", errFailedRequest, w.status)
+	}
+	return nil
+}
+
+func watch(ctx context.Context, client *absinthe.Client, stdout io.Writer) error {
+	stop := client.Indexer().Watch(func(event absinthe.IndexerEvent) {
+		action := "joined"
+		if event.Type == absinthe.IndexerEventPeerLeft {
+			action = "left"
+		}
+		fmt.Fprintf(stdout, "%s %s %s %s %s\n",
+			event.At.Format(time.RFC3339), action, event.Peer.ID, event.Peer.Name, peerVersion(event.Peer))
+	})
+	defer stop()
+	<-ctx.Done()
+	return nil
+}
+
+func tap(ctx context.Context, client *absinthe.Client, args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("tap", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	route := flags.String("route", "", "only capture exchanges matched by the route or pattern")
+	peer := flags.String("peer", "", "only capture exchanges handled by the peer with the ID or name")
+	status := flags.String("status", "", "only capture exchanges with the status code or class, such as 404 or 5xx")
+	output := flags.String("output", "", "file to append records to instead of stdout")
+	redactedHeaders := append(stringFlags{}, absinthe.DefaultRedactedHeaders...)
+	flags.Var(&redactedHeaders, "redact-header", "header to redact, may be repeated")
+	redactedFields := stringFlags{}
+	flags.Var(&redactedFields, "redact-field", "JSON body field to redact, may be repeated")
+	positional, err := parseInterspersed(flags, args)
+	if err != nil || len(positional) != 0 {
+		fmt.Fprintln(stderr, "usage: absinthe tap [--route <route>] [--peer <id or name>] [--status <code or class>]")
+		fmt.Fprintln(stderr, "                    [--redact-header <name>]... [--redact-field <name>]... [--output <file>]")
+		return errUsage
+	}
+
+	w := stdout
+	if *output != "" {
+		file, err := os.OpenFile(*output, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	t, err := client.Tap(absinthe.TapOptions{
+		Route:  *route,
+		Peer:   *peer,
+		Status: *status,
+		Redactors: []absinthe.TapRedactor{
+			absinthe.RedactHeaders(redactedHeaders...),
+			absinthe.RedactFields(redactedFields...),
+		},
+	}, absinthe.TapWriter(w))
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+	<-ctx.Done()
+	return nil
+}
+
+func record(ctx context.Context, client *absinthe.Client, args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(stderr, "usage: absinthe record <file> [tap flags]")
+		return errUsage
+	}
+	return tap(ctx, client, append(args[1:], "--output", args[0]), stdout, stderr)
+}
+
+func replay(ctx context.Context, client *absinthe.Client, args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	routes := stringFlags{}
+	flags.Var(&routes, "route", "only replay records matching the REST route or RPC pattern, may be repeated")
+	ignoreFields := stringFlags{}
+	flags.Var(&ignoreFields, "ignore-field", "JSON body field or dotted path not compared, may be repeated")
+	headers := stringFlags{}
+	flags.Var(&headers, "header", "response header compared, may be repeated")
+	asJSON := flags.Bool("json", false, "write results as JSON lines")
+	positional, err := parseInterspersed(flags, args)
+	if err != nil || len(positional) != 1 {
+		fmt.Fprintln(stderr, "usage: absinthe replay <file> [--route <route>]... [--ignore-field <field>]... [--header <name>]... [--json]")
+		return errUsage
+	}
+
+	file, err := os.Open(positional[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	records, err := absinthe.ReadTapRecords(file)
+	if err != nil {
+		return err
+	}
+
+	results, err := client.Replay(ctx, records, absinthe.ReplayOptions{
+		Routes:       routes,
+		IgnoreFields: ignoreFields,
+		Headers:      headers,
+	})
+	if err != nil {
+		return err
+	}
+
+	changed := 0
+	encoder := json.NewEncoder(stdout)
+	for _, result := range results {
+		if result.Changed() {
+			changed++
+		}
+		if *asJSON {
+			encoder.Encode(result)
+			continue
+		}
+		state := "ok"
+		if result.Changed() {
+			state = "changed"
+		}
+		target := result.Record.Path
+		if result.Record.Kind == "rest" {
+			target = result.Record.Method + " " + result.Record.URL
+		}
+		fmt.Fprintf(stdout, "%-8s %s\n", state, target)
+		for _, diff := range result.Diffs {
+			fmt.Fprintf(stdout, "    %s\n", diff)
+		}
+	}
+	if !*asJSON {
+		fmt.Fprintf(stdout, "%d replayed, %d changed\n", len(results), changed)
+	}
+	if changed != 0 {
+		return fmt.Errorf("%w in %d of %d replayed requests", errChangedResponses, changed, len(results))
+	}
+	return nil
+}
+
+func peerVersion(peer absinthe.Peer) string {
+	if peer.Version == nil {
+		return "-"
+	}
+	return peer.Version.String()
+}
+
+func peerRoutes(peer absinthe.Peer) []string {
+	routes := make([]string, 0, len(peer.RESTRoutes)+len(peer.RPCPatterns))
+	for _, route := range peer.RESTRoutes {
+		routes = append(routes, strings.ToUpper(route.Method)+" "+route.PatternSrc)
+	}
+	for _, pattern := range peer.RPCPatterns {
+		routes = append(routes, pattern.PatternSrc)
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+// parseInterspersed parses flags which may come before, between or after the
+// positional args, and returns the positional args
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+	positional := make([]string, 0)
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
+type stringFlags []string
+
+func (s *stringFlags) String() string {
+	return strings.Join(*s, ", ")
+}
+
+func (s *stringFlags) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return errors.New("header must be given as name: value")
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+// responseWriter holds the response to a dispatched REST request
+type responseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(data)
+}
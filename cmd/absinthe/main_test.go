@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	absinthe "github.com/RobertWHurst/Absinthe"
+	"github.com/RobertWHurst/Absinthe/absinthetest"
+	"github.com/RobertWHurst/Absinthe/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(data []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(data)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestRun(t *testing.T) {
+	network := memory.NewNetwork()
+	connect := func(name string) *absinthe.Client {
+		client, err := absinthe.Connect("",
+			absinthe.Name(name),
+			absinthe.Version("1.0.0"),
+			absinthe.IndexingInterval(20*time.Millisecond),
+			absinthe.UseTransport(network.NewTransport()),
+		)
+		assert.NoError(t, err)
+		t.Cleanup(func() { client.Close() })
+		return client
+	}
+	service := connect("users")
+	assert.NoError(t, service.Get("/users/:id", func(c *absinthe.RESTContext) {
+		c.SetHeader("X-User", c.Params["id"])
+		if c.Params["id"] == "0" {
+			c.Status(404)
+		}
+		c.Write([]byte("user " + c.Params["id"]))
+		c.End()
+	}))
+	assert.NoError(t, service.Handle("user.$id.get", func(c *absinthe.RPCContext) {
+		c.Respond(append([]byte(c.Params["id"]+" "), c.Data...))
+	}))
+
+	exec := func(args ...string) (int, string, string) {
+		stdout, stderr := &syncBuffer{}, &syncBuffer{}
+		code := run(context.Background(), args, stdout, stderr,
+			absinthe.IndexingInterval(100*time.Millisecond),
+			absinthe.UseTransport(network.NewTransport()),
+		)
+		return code, stdout.String(), stderr.String()
+	}
+
+	testCases := []struct {
+		name   string
+		args   []string
+		code   int
+		stdout []string
+	}{
+		{"peers", []string{"peers"}, 0, []string{"NAME", service.ID, "users", "1.0.0", "GET /users/:id, user.$id.get"}},
+		{"routes", []string{"routes"}, 0, []string{"rest  GET", "/users/:id", "rpc", "user.$id.get", "users@" + service.ID}},
+		{"call", []string{"call", "user.1.get", "--data", `{"a":1}`}, 0, []string{`1 {"a":1}`}},
+		{"call with flags first", []string{"call", "--data", "x", "user.2.get"}, 0, []string{"2 x"}},
+		{"http", []string{"http", "get", "/users/3"}, 0, []string{"user 3"}},
+		{"http include", []string{"http", "GET", "/users/4", "--include"}, 0, []string{"200 OK", "X-User: 4", "user 4"}},
+		{"http error status", []string{"http", "GET", "/users/0"}, 1, []string{"user 0"}},
+		{"http no route", []string{"http", "GET", "/accounts"}, 1, []string{}},
+		{"call without path", []string{"call"}, 2, []string{}},
+		{"unknown command", []string{"nope"}, 2, []string{}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			code, stdout, stderr := exec(testCase.args...)
+			assert.Equal(t, testCase.code, code, stderr)
+			for _, s := range testCase.stdout {
+				assert.Contains(t, stdout, s)
+			}
+		})
+	}
+
+	assert.Empty(t, service.Indexer().Peers(), "the cli should not be discovered")
+}
+
+func TestRunWatch(t *testing.T) {
+	network := memory.NewNetwork()
+	ctx, cancel := context.WithCancel(context.Background())
+	stdout := &syncBuffer{}
+	done := make(chan int)
+	go func() {
+		done <- run(ctx, []string{"watch"}, stdout, &syncBuffer{},
+			absinthe.IndexingInterval(20*time.Millisecond),
+			absinthe.UseTransport(network.NewTransport()),
+		)
+	}()
+
+	client, err := absinthe.Connect("",
+		absinthe.Name("users"),
+		absinthe.Version("1.0.0"),
+		absinthe.IndexingInterval(20*time.Millisecond),
+		absinthe.UseTransport(network.NewTransport()),
+	)
+	assert.NoError(t, err)
+
+	absinthetest.WaitFor(t, func() bool {
+		return strings.Contains(stdout.String(), "joined")
+	}, "the peer to join")
+	client.Close()
+	absinthetest.WaitFor(t, func() bool {
+		return strings.Contains(stdout.String(), "left")
+	}, "the peer to leave")
+	cancel()
+
+	assert.Equal(t, 0, <-done)
+	assert.Contains(t, stdout.String(), "joined "+client.ID+" users 1.0.0")
+	assert.Contains(t, stdout.String(), "left "+client.ID+" users 1.0.0")
+}
+
+func TestRunTap(t *testing.T) {
+	network := memory.NewNetwork()
+	service, err := absinthe.Connect("",
+		absinthe.Name("users"),
+		absinthe.IndexingInterval(20*time.Millisecond),
+		absinthe.UseTransport(network.NewTransport()),
+	)
+	assert.NoError(t, err)
+	defer service.Close()
+	assert.NoError(t, service.Handle("user.$id.login", func(c *absinthe.RPCContext) {
+		c.Respond([]byte(`{"token":"abc","id":"` + c.Params["id"] + `"}`))
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stdout := &syncBuffer{}
+	done := make(chan int)
+	go func() {
+		done <- run(ctx, []string{"tap", "--route", "user.$id.login", "--redact-field", "token"}, stdout, &syncBuffer{},
+			absinthe.IndexingInterval(20*time.Millisecond),
+			absinthe.UseTransport(network.NewTransport()),
+		)
+	}()
+
+	absinthetest.WaitFor(t, func() bool {
+		code, _, stderr := runWith(network, "call", "user.1.login", "--data", `{"password":"x"}`)
+		assert.Equal(t, 0, code, stderr)
+		return strings.Contains(stdout.String(), "user.1.login")
+	}, "the tapped call")
+	cancel()
+
+	assert.Equal(t, 0, <-done)
+	line := strings.SplitN(stdout.String(), "\n", 2)[0]
+	assert.Contains(t, line, `"route":"user.$id.login"`)
+	assert.Contains(t, line, `"body":{"id":"1","token":"[REDACTED]"}`)
+	assert.Contains(t, line, `"body":{"password":"x"}`)
+}
+
+func runWith(network *memory.Network, args ...string) (int, string, string) {
+	stdout, stderr := &syncBuffer{}, &syncBuffer{}
+	code := run(context.Background(), args, stdout, stderr,
+		absinthe.IndexingInterval(100*time.Millisecond),
+		absinthe.UseTransport(network.NewTransport()),
+	)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRunReplay(t *testing.T) {
+	network := memory.NewNetwork()
+	service, err := absinthe.Connect("",
+		absinthe.Name("users"),
+		absinthe.IndexingInterval(20*time.Millisecond),
+		absinthe.UseTransport(network.NewTransport()),
+	)
+	assert.NoError(t, err)
+	defer service.Close()
+	name := "Ada"
+	assert.NoError(t, service.Handle("user.$id.get", func(c *absinthe.RPCContext) {
+		c.Respond([]byte(`{"id":"` + c.Params["id"] + `","name":"` + name + `"}`))
+	}))
+
+	file := t.TempDir() + "/traffic.jsonl"
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int)
+	go func() {
+		done <- run(ctx, []string{"record", file, "--route", "user.$id.get"}, &syncBuffer{}, &syncBuffer{},
+			absinthe.IndexingInterval(20*time.Millisecond),
+			absinthe.UseTransport(network.NewTransport()),
+		)
+	}()
+	absinthetest.WaitFor(t, func() bool {
+		runWith(network, "call", "user.1.get")
+		data, _ := os.ReadFile(file)
+		return len(data) != 0
+	}, "the recorded call")
+	cancel()
+	assert.Equal(t, 0, <-done)
+
+	code, stdout, stderr := runWith(network, "replay", file)
+	assert.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "ok       user.1.get")
+
+	name = "Grace"
+	code, stdout, _ = runWith(network, "replay", file)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, "changed  user.1.get")
+	assert.Contains(t, stdout, `body.name: "Ada" -> "Grace"`)
+
+	code, _, _ = runWith(network, "replay", file, "--ignore-field", "name")
+	assert.Equal(t, 0, code)
+}
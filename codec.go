@@ -0,0 +1,24 @@
+package absinthe
+
+import (
+	"encoding/json"
+)
+
+// Codec encodes and decodes the requests and responses of typed RPC handlers
+// and calls
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec is a Codec encoding values as JSON. It is used when no codec is
+// configured.
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,303 @@
+package absinthe
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+)
+
+// Kinds of routes, used as the kind of conflicts, admin routes, and tap
+// records
+const (
+	RouteKindREST = "rest"
+	RouteKindRPC  = "rpc"
+)
+
+// RouteConflict is a set of overlapping REST routes or RPC patterns advertised
+// by peers with different names. Peers sharing a name are instances of the
+// same service, so overlap between them is expected.
+type RouteConflict struct {
+	Kind   string
+	Claims []RouteClaim
+}
+
+// RouteClaim is a route or pattern in a RouteConflict, along with the peers
+// of the service advertising it
+type RouteClaim struct {
+	Name    string
+	Method  string
+	Pattern string
+	Peers   []Peer
+}
+
+// key identifies the conflict regardless of which instances are involved
+func (c *RouteConflict) key() string {
+	parts := make([]string, 0, len(c.Claims))
+	for _, claim := range c.Claims {
+		parts = append(parts, claim.Name+" "+claim.Method+" "+claim.Pattern)
+	}
+	return c.Kind + ": " + strings.Join(parts, " | ")
+}
+
+// Overlaps reports whether a request could be matched by both routes. Custom
+// sub-patterns are compared conservatively, so routes are reported as
+// overlapping unless they are known not to.
+func (r *RESTRoute) Overlaps(other *RESTRoute) bool {
+	if r.Method != other.Method && r.Method != "all" && other.Method != "all" {
+		return false
+	}
+	return chunksOverlap(
+		r.routeChunks(), !r.terminated,
+		other.routeChunks(), !other.terminated,
+	)
+}
+
+// Overlaps reports whether a path could be matched by both patterns. Custom
+// sub-patterns are compared conservatively, so patterns are reported as
+// overlapping unless they are known not to.
+func (p *RPCPattern) Overlaps(other *RPCPattern) bool {
+	return chunksOverlap(
+		p.routeChunks(), !p.terminated,
+		other.routeChunks(), !other.terminated,
+	)
+}
+
+// routeChunk is a segment of a route or pattern. Static chunks match their
+// source, and others match their pattern, or anything if it is nil. Spanning
+// chunks may match across separators, or nothing at all, as may rest chunks,
+// which match the remainder of a path. Optional chunks may be absent from a
+// path. rank orders chunks by precedence.
+type routeChunk struct {
+	static   string
+	isStatic bool
+	pattern  *regexp.Regexp
+	spans    bool
+	optional bool
+	rest     bool
+	rank     int
+}
+
+// routeChunks returns the chunks of the route, parsing them if the route was
+// not created by NewRESTRoute
+func (r *RESTRoute) routeChunks() []routeChunk {
+	if r.chunks == nil {
+		return routeChunks(r.PatternSrc, "/", parseRESTRouteChunk)
+	}
+	return r.chunks
+}
+
+// routeChunks returns the chunks of the pattern, parsing them if the pattern
+// was not created by NewRPCPattern
+func (p *RPCPattern) routeChunks() []routeChunk {
+	if p.chunks == nil {
+		return routeChunks(p.PatternSrc, ".", parseRPCPatternChunk)
+	}
+	return p.chunks
+}
+
+// routeChunks returns the chunks of a route or pattern source. Chunks which
+// cannot be parsed are treated as spanning.
+func routeChunks(patternSrc, separator string, parse chunkParser) []routeChunk {
+	chunks := make([]routeChunk, 0)
+	for _, chunkSrc := range strings.Split(patternSrc, separator) {
+		if len(chunkSrc) == 0 {
+			continue
+		}
+		syntax, err := parse(chunkSrc)
+		if err != nil {
+			chunks = append(chunks, routeChunk{spans: true, rank: chunkRankSpanning})
+			continue
+		}
+		chunks = append(chunks, newRouteChunk(syntax, separator))
+	}
+	return chunks
+}
+
+// newRouteChunks returns the chunks of a route or pattern from its parsed
+// chunks
+func newRouteChunks(syntaxes []chunkSyntax, separator string) []routeChunk {
+	chunks := make([]routeChunk, 0, len(syntaxes))
+	for _, syntax := range syntaxes {
+		chunks = append(chunks, newRouteChunk(syntax, separator))
+	}
+	return chunks
+}
+
+// newRouteChunk returns the chunk of a route or pattern from its parsed chunk
+func newRouteChunk(syntax chunkSyntax, separator string) routeChunk {
+	if syntax.isStatic {
+		return routeChunk{static: syntax.static, isStatic: true, rank: chunkRankStatic}
+	}
+	chunk := routeChunk{optional: syntax.optional, rest: syntax.rest, rank: chunkRankWildCard}
+	if syntax.key != "" {
+		chunk.rank = chunkRankParam
+	}
+	if len(syntax.subPattern) != 0 {
+		if pattern, err := regexp.Compile(`^(?:` + syntax.subPattern + `)$`); err == nil {
+			chunk.pattern = pattern
+			chunk.spans = pattern.MatchString("") || subPatternMatches(syntax.subPattern, separator)
+		} else {
+			chunk.spans = true
+		}
+		chunk.rank++
+	}
+	switch {
+	case chunk.spans || chunk.rest:
+		chunk.spans = true
+		chunk.rank = chunkRankSpanning
+	case chunk.optional:
+		chunk.rank = chunkRankOptional
+	case syntax.alternation:
+		chunk.rank = chunkRankAlternation
+	}
+	return chunk
+}
+
+// chunksOverlap compares routes chunk by chunk. Unterminated routes match any
+// path beginning with their chunks.
+func chunksOverlap(a []routeChunk, aUnterminated bool, b []routeChunk, bUnterminated bool) bool {
+	for i := 0; ; i++ {
+		if i == len(a) && i == len(b) {
+			return true
+		}
+		if i == len(a) {
+			return aUnterminated
+		}
+		if i == len(b) {
+			return bUnterminated
+		}
+		if a[i].spans || b[i].spans || a[i].optional || b[i].optional {
+			return true
+		}
+		if !chunkOverlaps(a[i], b[i]) {
+			return false
+		}
+	}
+}
+
+func chunkOverlaps(a, b routeChunk) bool {
+	switch {
+	case a.isStatic && b.isStatic:
+		return a.static == b.static
+	case a.isStatic:
+		return b.pattern == nil || b.pattern.MatchString(a.static)
+	case b.isStatic:
+		return a.pattern == nil || a.pattern.MatchString(b.static)
+	default:
+		return true
+	}
+}
+
+// subPatternMatches reports whether a sub-pattern could match a string
+// containing the separator. Invalid sub-patterns are assumed to.
+func subPatternMatches(subPattern, separator string) bool {
+	re, err := syntax.Parse(subPattern, syntax.Perl)
+	if err != nil {
+		return true
+	}
+	r := []rune(separator)[0]
+	var matches func(re *syntax.Regexp) bool
+	matches = func(re *syntax.Regexp) bool {
+		switch re.Op {
+		case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+			return true
+		case syntax.OpLiteral:
+			for _, literal := range re.Rune {
+				if literal == r {
+					return true
+				}
+			}
+		case syntax.OpCharClass:
+			for n := 0; n+1 < len(re.Rune); n += 2 {
+				if re.Rune[n] <= r && r <= re.Rune[n+1] {
+					return true
+				}
+			}
+		}
+		for _, sub := range re.Sub {
+			if matches(sub) {
+				return true
+			}
+		}
+		return false
+	}
+	return matches(re)
+}
+
+// findConflicts returns the conflicts between the routes and patterns of the
+// given peers, sorted by key
+func findConflicts(peers []Peer) []RouteConflict {
+	conflicts := make(map[string]*RouteConflict)
+	addConflict := func(kind string, a, b RouteClaim, aPeer, bPeer Peer) {
+		if a.Name+a.Method+a.Pattern > b.Name+b.Method+b.Pattern {
+			a, b, aPeer, bPeer = b, a, bPeer, aPeer
+		}
+		conflict := &RouteConflict{Kind: kind, Claims: []RouteClaim{a, b}}
+		key := conflict.key()
+		if existing, ok := conflicts[key]; ok {
+			conflict = existing
+		} else {
+			conflicts[key] = conflict
+		}
+		conflict.Claims[0].Peers = appendPeer(conflict.Claims[0].Peers, aPeer)
+		conflict.Claims[1].Peers = appendPeer(conflict.Claims[1].Peers, bPeer)
+	}
+
+	for i, a := range peers {
+		for _, b := range peers[i+1:] {
+			if a.Name == b.Name {
+				continue
+			}
+			for _, aRoute := range a.RESTRoutes {
+				for _, bRoute := range b.RESTRoutes {
+					if aRoute.Overlaps(&bRoute) {
+						addConflict(RouteKindREST,
+							RouteClaim{Name: a.Name, Method: aRoute.Method, Pattern: aRoute.PatternSrc},
+							RouteClaim{Name: b.Name, Method: bRoute.Method, Pattern: bRoute.PatternSrc},
+							a, b)
+					}
+				}
+			}
+			for _, aPattern := range a.RPCPatterns {
+				for _, bPattern := range b.RPCPatterns {
+					if aPattern.Overlaps(&bPattern) {
+						addConflict(RouteKindRPC,
+							RouteClaim{Name: a.Name, Pattern: aPattern.PatternSrc},
+							RouteClaim{Name: b.Name, Pattern: bPattern.PatternSrc},
+							a, b)
+					}
+				}
+			}
+		}
+	}
+
+	sorted := make([]RouteConflict, 0, len(conflicts))
+	for _, conflict := range conflicts {
+		for _, claim := range conflict.Claims {
+			sort.Slice(claim.Peers, func(a, b int) bool {
+				return claim.Peers[a].ID < claim.Peers[b].ID
+			})
+		}
+		sorted = append(sorted, *conflict)
+	}
+	sort.Slice(sorted, func(a, b int) bool {
+		return sorted[a].key() < sorted[b].key()
+	})
+	return sorted
+}
+
+func appendPeer(peers []Peer, peer Peer) []Peer {
+	for _, knownPeer := range peers {
+		if knownPeer.ID == peer.ID {
+			return peers
+		}
+	}
+	return append(peers, peer)
+}
+
+// conflictsWith reports whether any route or pattern of a peer overlaps with
+// one of another peer with a different name
+func conflictsWith(a, b Peer) bool {
+	return a.Name != b.Name && len(findConflicts([]Peer{a, b})) != 0
+}
@@ -0,0 +1,134 @@
+package absinthe
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRESTRouteOverlaps(t *testing.T) {
+	testCases := []struct {
+		a, b     [2]string
+		overlaps bool
+	}{
+		{[2]string{"get", "/users/:id"}, [2]string{"get", "/users/me"}, true},
+		{[2]string{"get", "/users/:id"}, [2]string{"post", "/users/me"}, false},
+		{[2]string{"all", "/users/:id"}, [2]string{"post", "/users/me"}, true},
+		{[2]string{"get", "/users/:id"}, [2]string{"get", "/users/:userID"}, true},
+		{[2]string{"get", "/users/:id"}, [2]string{"get", "/accounts/:id"}, false},
+		{[2]string{"get", "/users/:id"}, [2]string{"get", "/users/:id/posts"}, false},
+		{[2]string{"get", "/users/:id+"}, [2]string{"get", "/users/:id/posts"}, true},
+		{[2]string{"get", "/users/:id(\\d+)"}, [2]string{"get", "/users/me"}, false},
+		{[2]string{"get", "/users/:id(\\d+)"}, [2]string{"get", "/users/42"}, true},
+		{[2]string{"get", "/users/*"}, [2]string{"get", "/users/me"}, true},
+		{[2]string{"get", "/files/*(.*)"}, [2]string{"get", "/files/a/b"}, true},
+		{[2]string{"get", "/users"}, [2]string{"get", "/users"}, true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.a[1]+" "+testCase.b[1], func(t *testing.T) {
+			a, err := NewRESTRoute(testCase.a[0], testCase.a[1])
+			assert.NoError(t, err)
+			b, err := NewRESTRoute(testCase.b[0], testCase.b[1])
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.overlaps, a.Overlaps(b))
+			assert.Equal(t, testCase.overlaps, b.Overlaps(a))
+		})
+	}
+}
+
+func TestRPCPatternOverlaps(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		overlaps bool
+	}{
+		{"user.$id.get", "user.me.get", true},
+		{"user.$id.get", "user.me.delete", false},
+		{"user.$.get", "user.$id.get", true},
+		{"user.$id(\\d+).get", "user.me.get", false},
+		{"user.$id.get", "user.$id", false},
+		{"user.get", "user.get", true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.a+" "+testCase.b, func(t *testing.T) {
+			a, err := NewRPCPattern(testCase.a)
+			assert.NoError(t, err)
+			b, err := NewRPCPattern(testCase.b)
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.overlaps, a.Overlaps(b))
+			assert.Equal(t, testCase.overlaps, b.Overlaps(a))
+		})
+	}
+}
+
+func TestFindConflicts(t *testing.T) {
+	peer := func(id, name string, routes ...string) Peer {
+		p := Peer{ID: id, Name: name, RESTRoutes: make(map[string]RESTRoute), RPCPatterns: make(map[string]RPCPattern)}
+		for _, route := range routes {
+			restRoute, _ := NewRESTRoute("get", route)
+			p.AddRESTRoute(*restRoute)
+		}
+		return p
+	}
+
+	conflicts := findConflicts([]Peer{
+		peer("1", "users", "/users/:id"),
+		peer("2", "users", "/users/:id"),
+		peer("3", "profiles", "/users/me", "/profiles/:id"),
+	})
+	if assert.Len(t, conflicts, 1) {
+		assert.Equal(t, "rest", conflicts[0].Kind)
+		assert.Equal(t, "profiles", conflicts[0].Claims[0].Name)
+		assert.Equal(t, "/users/me", conflicts[0].Claims[0].Pattern)
+		assert.Len(t, conflicts[0].Claims[0].Peers, 1)
+		assert.Equal(t, "users", conflicts[0].Claims[1].Name)
+		assert.Len(t, conflicts[0].Claims[1].Peers, 2)
+	}
+}
+
+func TestIndexerConflictPeers(t *testing.T) {
+	peer := func(id, name string, routes ...string) Peer {
+		p := Peer{ID: id, Name: name, RESTRoutes: make(map[string]RESTRoute), RPCPatterns: make(map[string]RPCPattern)}
+		for _, route := range routes {
+			restRoute, _ := NewRESTRoute("get", route)
+			p.AddRESTRoute(*restRoute)
+		}
+		return p
+	}
+	indexer := NewIndexer(&Client{options: GetDefaultOptions(), logger: slog.New(discardHandler{})})
+
+	indexer.setKnownPeer(peer("1", "users", "/users/:id"))
+	indexer.setKnownPeer(peer("2", "profiles", "/users/me"))
+	peers, changed := indexer.conflictPeers()
+	assert.True(t, changed)
+	assert.Len(t, peers, 2)
+	assert.Len(t, indexer.indexConflicts(peers), 1)
+
+	// Peers announcing the same routes do not need their conflicts found again
+	indexer.setKnownPeer(peer("1", "users", "/users/:id"))
+	_, changed = indexer.conflictPeers()
+	assert.False(t, changed)
+
+	// Only conflicts which were not already known are sent
+	indexer.nextRefusedPeers["3"] = peer("3", "accounts", "/users/:name")
+	peers, changed = indexer.conflictPeers()
+	assert.True(t, changed)
+	assert.Len(t, peers, 3)
+	events := indexer.indexConflicts(peers)
+	assert.Len(t, events, 2)
+	for _, event := range events {
+		assert.Contains(t, []string{event.Conflict.Claims[0].Name, event.Conflict.Claims[1].Name}, "accounts")
+	}
+	assert.Len(t, indexer.Conflicts(), 3)
+
+	indexer.nextRefusedPeers["3"] = peer("3", "accounts", "/users/:name")
+	_, changed = indexer.conflictPeers()
+	assert.False(t, changed)
+
+	indexer.deleteKnownPeer("2")
+	peers, changed = indexer.conflictPeers()
+	assert.True(t, changed)
+	assert.Len(t, peers, 1)
+}
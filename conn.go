@@ -1,44 +1,418 @@
 package absinthe
 
 import (
-	"github.com/nats-io/go-nats"
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
 )
 
 const DefaultAbsintheNamespace = "__ABSINTHE__"
 
+// InboxToken is the token following the namespace in the reply subjects of
+// requests made by a Conn, such as absinthe._INBOX.<conn>.<request>
+const InboxToken = "_INBOX"
+
+// ErrInvalidSubject is returned when a subject or namespace is empty, has
+// empty tokens, or contains wildcards or whitespace
+var ErrInvalidSubject = errors.New("absinthe: invalid subject")
+
+// ErrInvalidReplySubject is returned when replying to a request whose reply
+// subject is not within the inbox of the namespace
+var ErrInvalidReplySubject = errors.New("absinthe: reply subject is not within the inbox of the namespace")
+
+// ErrInvalidHandler is returned when a handler passed to Subscribe is not a
+// function accepting the decoded message as its last argument
+var ErrInvalidHandler = errors.New("absinthe: handler must be a func accepting up to a subject, a reply subject, and a value")
+
+// Handler is a function called with the decoded messages of a subscription.
+// It may take the form func(v T), func(subject string, v T), or
+// func(subject, reply string, v T), where T is the type to decode each message
+// into. A func(*Message) receives messages undecoded.
+type Handler interface{}
+
+// Conn wraps a Transport so every subject it publishes or subscribes to is
+// prefixed with the namespace, and values are gob encoded. Namespaces are dot
+// separated and may nest, such as absinthe.team.env.
 type Conn struct {
-	*nats.EncodedConn
+	transport Transport
 	Namespace string
+	inbox     *inbox
+}
+
+// inbox receives the responses to the requests made by a Conn. Responses are
+// sent to reply subjects within the namespace, under a prefix unique to the
+// Conn, and are received with a single subscription made on first use.
+type inbox struct {
+	prefix string
+
+	subscribeOnce sync.Once
+	subscribeErr  error
+
+	mu      sync.Mutex
+	next    uint64
+	waiting map[string]chan []byte
+}
+
+func newInbox(namespace string) *inbox {
+	return &inbox{
+		prefix:  namespace + "." + InboxToken + "." + newRequestID(),
+		waiting: make(map[string]chan []byte),
+	}
+}
+
+// open returns a new reply subject and the channel its response is delivered
+// to. The reply subject must be closed once the response has arrived or is no
+// longer awaited.
+func (i *inbox) open(transport Transport) (string, chan []byte, error) {
+	i.subscribeOnce.Do(func() {
+		_, i.subscribeErr = transport.Subscribe(i.prefix+".*", i.deliver)
+	})
+	if i.subscribeErr != nil {
+		return "", nil, i.subscribeErr
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.next++
+	reply := i.prefix + "." + strconv.FormatUint(i.next, 10)
+	response := make(chan []byte, 1)
+	i.waiting[reply] = response
+	return reply, response, nil
+}
+
+func (i *inbox) close(reply string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.waiting, reply)
+}
+
+// deliver hands a response to the request awaiting it. Only the first
+// response to each request is kept.
+func (i *inbox) deliver(msg *Message) {
+	i.mu.Lock()
+	response, ok := i.waiting[msg.Subject]
+	delete(i.waiting, msg.Subject)
+	i.mu.Unlock()
+	if ok {
+		response <- msg.Data
+	}
 }
 
 func NewConn(options *Options) (*Conn, error) {
-	natsConn, err := options.getNatsOptions().Connect()
-	if err != nil {
+	if err := ValidateSubject(options.Namespace); err != nil {
 		return nil, err
 	}
 
-	necodedNatsConn, err := nats.NewEncodedConn(natsConn, nats.GOB_ENCODER)
-	if err != nil {
-		return nil, err
+	transport := options.Transport
+	if transport == nil {
+		natsTransport, err := NewNATSTransport(options.getNatsOptions())
+		if err != nil {
+			return nil, err
+		}
+		transport = natsTransport
+	}
+
+	return &Conn{
+		transport: transport,
+		Namespace: options.Namespace,
+		inbox:     newInbox(options.Namespace),
+	}, nil
+}
+
+// ValidateSubject returns an error if the subject is empty, has empty tokens,
+// or contains wildcards or whitespace
+func ValidateSubject(subj string) error {
+	if len(subj) == 0 {
+		return fmt.Errorf("%w: subject is empty", ErrInvalidSubject)
 	}
+	for _, token := range strings.Split(subj, ".") {
+		if len(token) == 0 {
+			return fmt.Errorf("%w: %q has an empty token", ErrInvalidSubject, subj)
+		}
+		for _, r := range token {
+			if r == '*' || r == '>' || unicode.IsSpace(r) {
+				return fmt.Errorf("%w: %q contains %q", ErrInvalidSubject, subj, r)
+			}
+		}
+	}
+	return nil
+}
 
+// WithNamespace returns a Conn sharing the same transport, with the given
+// namespace nested under the namespace of c
+func (c *Conn) WithNamespace(namespace string) (*Conn, error) {
+	if err := ValidateSubject(namespace); err != nil {
+		return nil, err
+	}
 	return &Conn{
-		EncodedConn: necodedNatsConn,
-		Namespace:   options.Namespace,
+		transport: c.transport,
+		Namespace: c.Namespace + "." + namespace,
+		inbox:     newInbox(c.Namespace + "." + namespace),
 	}, nil
 }
 
-func (c *Conn) Subscribe(subj string, cb nats.Handler) (*nats.Subscription, error) {
-	return c.EncodedConn.Subscribe(c.Namespace+"."+subj, cb)
+func (c *Conn) subject(subj string) (string, error) {
+	if err := ValidateSubject(subj); err != nil {
+		return "", err
+	}
+	return c.Namespace + "." + subj, nil
 }
 
-func (c *Conn) QueueSubscribe(subj string, queue string, cb nats.Handler) (*nats.Subscription, error) {
-	return c.EncodedConn.QueueSubscribe(c.Namespace+"."+subj, queue, cb)
+func (c *Conn) Subscribe(subj string, cb Handler) (Subscription, error) {
+	subj, err := c.subject(subj)
+	if err != nil {
+		return nil, err
+	}
+	handler, err := decodingHandler(cb)
+	if err != nil {
+		return nil, err
+	}
+	return c.transport.Subscribe(subj, handler)
 }
 
-// TODO: Shadow the remaining message related nats connection methods so
-// namespaces are always used correctly
+func (c *Conn) QueueSubscribe(subj string, queue string, cb Handler) (Subscription, error) {
+	subj, err := c.subject(subj)
+	if err != nil {
+		return nil, err
+	}
+	handler, err := decodingHandler(cb)
+	if err != nil {
+		return nil, err
+	}
+	return c.transport.QueueSubscribe(subj, queue, handler)
+}
 
 func (c *Conn) Publish(subj string, v interface{}) error {
-	return c.EncodedConn.Publish(c.Namespace+"."+subj, v)
+	subj, err := c.subject(subj)
+	if err != nil {
+		return err
+	}
+	data, err := encode(v)
+	if err != nil {
+		return err
+	}
+	return c.transport.Publish(subj, data)
+}
+
+// PublishRequest publishes v to the subject, asking for responses to be sent
+// to reply. Both subjects are namespaced.
+func (c *Conn) PublishRequest(subj, reply string, v interface{}) error {
+	subj, err := c.subject(subj)
+	if err != nil {
+		return err
+	}
+	reply, err = c.subject(reply)
+	if err != nil {
+		return err
+	}
+	data, err := encode(v)
+	if err != nil {
+		return err
+	}
+	return c.transport.PublishRequest(subj, reply, data)
+}
+
+func (c *Conn) Request(subj string, v interface{}, vPtr interface{}, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return c.RequestWithContext(ctx, subj, v, vPtr)
+}
+
+// RequestWithContext publishes v to the subject and decodes the first
+// response into vPtr. The response is sent to a reply subject within the
+// namespace. If ctx expires first ErrTimeout is returned.
+func (c *Conn) RequestWithContext(ctx context.Context, subj string, v interface{}, vPtr interface{}) error {
+	subj, err := c.subject(subj)
+	if err != nil {
+		return err
+	}
+	data, err := encode(v)
+	if err != nil {
+		return err
+	}
+	reply, response, err := c.inbox.open(c.transport)
+	if err != nil {
+		return err
+	}
+	defer c.inbox.close(reply)
+	if err := c.transport.PublishRequest(subj, reply, data); err != nil {
+		return err
+	}
+	select {
+	case responseData := <-response:
+		return decode(responseData, vPtr)
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return ErrTimeout
+		}
+		return ctx.Err()
+	}
+}
+
+// BindSendChan publishes every value sent on channel to the subject
+func (c *Conn) BindSendChan(subj string, channel interface{}) error {
+	subj, err := c.subject(subj)
+	if err != nil {
+		return err
+	}
+	chanValue := reflect.ValueOf(channel)
+	if chanValue.Kind() != reflect.Chan || chanValue.Type().ChanDir()&reflect.RecvDir == 0 {
+		return errors.New("absinthe: argument needs to be a receivable channel")
+	}
+	go func() {
+		for {
+			v, ok := chanValue.Recv()
+			if !ok {
+				return
+			}
+			data, err := encode(v.Interface())
+			if err != nil {
+				continue
+			}
+			if err := c.transport.Publish(subj, data); err == ErrTransportClosed {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// BindRecvChan sends every value published to the subject on channel
+func (c *Conn) BindRecvChan(subj string, channel interface{}) (Subscription, error) {
+	return c.BindRecvQueueChan(subj, "", channel)
+}
+
+// BindRecvQueueChan sends values published to the subject on channel. Each
+// value is only sent to one member of the queue.
+func (c *Conn) BindRecvQueueChan(subj, queue string, channel interface{}) (Subscription, error) {
+	subj, err := c.subject(subj)
+	if err != nil {
+		return nil, err
+	}
+	chanValue := reflect.ValueOf(channel)
+	if chanValue.Kind() != reflect.Chan || chanValue.Type().ChanDir()&reflect.SendDir == 0 {
+		return nil, errors.New("absinthe: argument needs to be a sendable channel")
+	}
+	elemType := chanValue.Type().Elem()
+	handler := func(msg *Message) {
+		vPtr := reflect.New(elemType)
+		if err := decode(msg.Data, vPtr.Interface()); err != nil {
+			return
+		}
+		chanValue.Send(vPtr.Elem())
+	}
+	if len(queue) == 0 {
+		return c.transport.Subscribe(subj, handler)
+	}
+	return c.transport.QueueSubscribe(subj, queue, handler)
+}
+
+// IsConnected reports whether the transport of the connection is connected
+func (c *Conn) IsConnected() bool {
+	if transport, ok := c.transport.(StatefulTransport); ok {
+		return transport.IsConnected()
+	}
+	return true
+}
+
+// Close closes the underlying transport
+func (c *Conn) Close() error {
+	return c.transport.Close()
+}
+
+// validateReply checks that the reply subject of a request is within the inbox
+// of the namespace, where requests made by a Conn in the same namespace await
+// their responses, so a requester cannot have responses published to any
+// other subject
+func (c *Conn) validateReply(reply string) error {
+	if !strings.HasPrefix(reply, c.Namespace+"."+InboxToken+".") || ValidateSubject(reply) != nil {
+		return fmt.Errorf("%w: %q", ErrInvalidReplySubject, reply)
+	}
+	return nil
+}
+
+// publishReply publishes a response to the reply subject of a request, which
+// must be within the inbox of the namespace
+func (c *Conn) publishReply(reply string, v interface{}) error {
+	if err := c.validateReply(reply); err != nil {
+		return err
+	}
+	data, err := encode(v)
+	if err != nil {
+		return err
+	}
+	return c.transport.Publish(reply, data)
+}
+
+func encode(v interface{}) ([]byte, error) {
+	data := &bytes.Buffer{}
+	if err := gob.NewEncoder(data).Encode(v); err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
+
+func decode(data []byte, vPtr interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(vPtr)
+}
+
+var messageType = reflect.TypeOf(&Message{})
+
+// decodingHandler adapts a Handler to a MessageHandler, decoding each message
+// into the type accepted by the handler
+func decodingHandler(cb Handler) (MessageHandler, error) {
+	if handler, ok := cb.(func(*Message)); ok {
+		return handler, nil
+	}
+
+	cbValue := reflect.ValueOf(cb)
+	if cbValue.Kind() != reflect.Func {
+		return nil, ErrInvalidHandler
+	}
+	cbType := cbValue.Type()
+	numArgs := cbType.NumIn()
+	if numArgs == 0 || numArgs > 3 {
+		return nil, ErrInvalidHandler
+	}
+	for i := 0; i < numArgs-1; i++ {
+		if cbType.In(i).Kind() != reflect.String {
+			return nil, ErrInvalidHandler
+		}
+	}
+	argType := cbType.In(numArgs - 1)
+
+	return func(msg *Message) {
+		var vValue reflect.Value
+		if argType == messageType {
+			vValue = reflect.ValueOf(msg)
+		} else if argType.Kind() == reflect.Ptr {
+			vValue = reflect.New(argType.Elem())
+			if err := decode(msg.Data, vValue.Interface()); err != nil {
+				return
+			}
+		} else {
+			vPtr := reflect.New(argType)
+			if err := decode(msg.Data, vPtr.Interface()); err != nil {
+				return
+			}
+			vValue = vPtr.Elem()
+		}
+
+		args := make([]reflect.Value, 0, numArgs)
+		if numArgs > 1 {
+			args = append(args, reflect.ValueOf(msg.Subject))
+		}
+		if numArgs > 2 {
+			args = append(args, reflect.ValueOf(msg.Reply))
+		}
+		args = append(args, vValue)
+		cbValue.Call(args)
+	}, nil
 }
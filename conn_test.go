@@ -0,0 +1,82 @@
+package absinthe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var subjectsAndValidity = map[string]bool{
+	"absinthe":          true,
+	"absinthe.team.env": true,
+	"PONG-1234":         true,
+	"":                  false,
+	".":                 false,
+	"absinthe.":         false,
+	".absinthe":         false,
+	"absinthe..env":     false,
+	"absinthe.*":        false,
+	"absinthe.>":        false,
+	"absin*the":         false,
+	"absinthe team":     false,
+	"absinthe\tteam":    false,
+	"absinthe\n":        false,
+}
+
+func TestValidateSubject(t *testing.T) {
+	for subject, valid := range subjectsAndValidity {
+		err := ValidateSubject(subject)
+		if valid {
+			assert.NoError(t, err, "subject %q should be valid", subject)
+		} else {
+			assert.ErrorIs(t, err, ErrInvalidSubject, "subject %q should be invalid", subject)
+		}
+	}
+}
+
+func TestConnNamespaces(t *testing.T) {
+	conn := &Conn{Namespace: "absinthe"}
+
+	subject, err := conn.subject("PING")
+	assert.NoError(t, err)
+	assert.Equal(t, "absinthe.PING", subject)
+
+	_, err = conn.subject("PING.*")
+	assert.ErrorIs(t, err, ErrInvalidSubject)
+
+	teamConn, err := conn.WithNamespace("team.env")
+	assert.NoError(t, err)
+	subject, err = teamConn.subject("PING")
+	assert.NoError(t, err)
+	assert.Equal(t, "absinthe.team.env.PING", subject)
+
+	_, err = conn.WithNamespace("team >")
+	assert.ErrorIs(t, err, ErrInvalidSubject)
+}
+
+var replySubjectsAndValidity = map[string]bool{
+	"absinthe._INBOX.abc.1":      true,
+	"absinthe._INBOX.abc":        true,
+	"absinthe._INBOX":            false,
+	"absinthe._INBOX.":           false,
+	"absinthe._INBOX.*":          false,
+	"absinthe._INBOX.>":          false,
+	"absinthe.PONG-1234":         false,
+	"_INBOX.abc.1":               false,
+	"other._INBOX.abc.1":         false,
+	"absinthe.team._INBOX.abc.1": false,
+	"":                           false,
+}
+
+func TestConnValidateReply(t *testing.T) {
+	conn := &Conn{Namespace: "absinthe"}
+	for reply, valid := range replySubjectsAndValidity {
+		err := conn.validateReply(reply)
+		if valid {
+			assert.NoError(t, err, "reply subject %q should be valid", reply)
+		} else {
+			assert.ErrorIs(t, err, ErrInvalidReplySubject, "reply subject %q should be invalid", reply)
+		}
+	}
+	assert.ErrorIs(t, conn.publishReply("absinthe.PONG-1234", "data"), ErrInvalidReplySubject)
+}
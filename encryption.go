@@ -0,0 +1,246 @@
+package absinthe
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// ErrNoPeerEncryptionKey is returned when payload encryption is enabled but
+// the peer handling a request does not advertise an encryption key
+var ErrNoPeerEncryptionKey = errors.New("absinthe: peer does not advertise an encryption key")
+
+// ErrPlaintextPayload is returned when payload encryption is enabled and a
+// request or response arrives unencrypted
+var ErrPlaintextPayload = errors.New("absinthe: refusing plaintext payload")
+
+// ErrUntrustedEncryptionKeys is returned by Connect when payload encryption is
+// enabled without trusted keys. Encryption keys are learned from announcements,
+// so any peer could advertise a substitute key if they were not verified.
+var ErrUntrustedEncryptionKeys = errors.New("absinthe: payload encryption requires trusted keys")
+
+// Payloads are encrypted with AES-256-GCM. For each request the sender
+// generates an ephemeral X25519 key and combines it with the key advertised by
+// the receiving peer. The same key is used to encrypt the response. Only the
+// fields needed for routing are left in the clear.
+
+func newRequestKey(peerKey []byte) ([]byte, []byte, error) {
+	if len(peerKey) == 0 {
+		return nil, nil, ErrNoPeerEncryptionKey
+	}
+	peerPublicKey, err := ecdh.X25519().NewPublicKey(peerKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	ephemeralKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	secret, err := ephemeralKey.ECDH(peerPublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	senderKey := ephemeralKey.PublicKey().Bytes()
+	return derivePayloadKey(secret, senderKey, peerKey), senderKey, nil
+}
+
+func openRequestKey(key *ecdh.PrivateKey, senderKey []byte) ([]byte, error) {
+	if key == nil {
+		return nil, errors.New("absinthe: payload encryption is not enabled")
+	}
+	senderPublicKey, err := ecdh.X25519().NewPublicKey(senderKey)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := key.ECDH(senderPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return derivePayloadKey(secret, senderKey, key.PublicKey().Bytes()), nil
+}
+
+func derivePayloadKey(secret, senderKey, peerKey []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte("absinthe payload key"))
+	h.Write(secret)
+	h.Write(senderKey)
+	h.Write(peerKey)
+	return h.Sum(nil)
+}
+
+// payloadAAD returns the additional data a sealed payload is bound to, which is
+// the kind of its envelope and the fields of the envelope left in cleartext.
+// A payload opened with other additional data is rejected, so it cannot be
+// moved to another envelope, path, or request.
+func payloadAAD(kind string, fields ...string) []byte {
+	data, _ := json.Marshal(append([]string{kind}, fields...))
+	return data
+}
+
+// traceContextAAD returns a trace context as a field of payloadAAD. Empty and
+// nil trace contexts are the same, as gob does not send empty maps.
+func traceContextAAD(traceContext map[string]string) string {
+	if len(traceContext) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(traceContext)
+	return string(data)
+}
+
+func sealPayload(key, aad []byte, v interface{}) ([]byte, error) {
+	plaintext := &bytes.Buffer{}
+	if err := gob.NewEncoder(plaintext).Encode(v); err != nil {
+		return nil, err
+	}
+	aead, err := newPayloadAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext.Bytes(), aad), nil
+}
+
+func openPayload(key, aad, data []byte, v interface{}) error {
+	aead, err := newPayloadAEAD(key)
+	if err != nil {
+		return err
+	}
+	if len(data) < aead.NonceSize() {
+		return errors.New("absinthe: sealed payload is too short")
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], aad)
+	if err != nil {
+		return err
+	}
+	return gob.NewDecoder(bytes.NewReader(plaintext)).Decode(v)
+}
+
+func newPayloadAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (r *RESTRequest) aad() []byte {
+	return payloadAAD("rest request", r.Method, r.URL, r.RequestID, traceContextAAD(r.TraceContext))
+}
+
+func (r *RESTRequest) seal(key []byte) error {
+	sealed, err := sealPayload(key, r.aad(), &RESTRequest{
+		Header:            r.Header,
+		Body:              r.Body,
+		Identity:          r.Identity,
+		IdentitySignature: r.IdentitySignature,
+	})
+	if err != nil {
+		return err
+	}
+	r.Header, r.Body, r.Identity, r.IdentitySignature = nil, nil, nil, nil
+	r.Sealed = sealed
+	return nil
+}
+
+func (r *RESTRequest) open(key []byte) error {
+	secrets := &RESTRequest{}
+	if err := openPayload(key, r.aad(), r.Sealed, secrets); err != nil {
+		return err
+	}
+	r.Header, r.Body, r.Identity, r.IdentitySignature = secrets.Header, secrets.Body, secrets.Identity, secrets.IdentitySignature
+	r.Sealed = nil
+	return nil
+}
+
+func (r *RESTResponse) aad() []byte {
+	return payloadAAD("rest response", strconv.Itoa(r.Status))
+}
+
+func (r *RESTResponse) seal(key []byte) error {
+	sealed, err := sealPayload(key, r.aad(), &RESTResponse{
+		Header: r.Header,
+		Body:   r.Body,
+	})
+	if err != nil {
+		return err
+	}
+	r.Header, r.Body = nil, nil
+	r.Sealed = sealed
+	return nil
+}
+
+func (r *RESTResponse) open(key []byte) error {
+	secrets := &RESTResponse{}
+	if err := openPayload(key, r.aad(), r.Sealed, secrets); err != nil {
+		return err
+	}
+	r.Header, r.Body = secrets.Header, secrets.Body
+	r.Sealed = nil
+	return nil
+}
+
+func (r *RPCRequest) aad() []byte {
+	return payloadAAD("rpc request", r.Path, r.RequestID, traceContextAAD(r.TraceContext))
+}
+
+func (r *RPCRequest) seal(key []byte) error {
+	sealed, err := sealPayload(key, r.aad(), &RPCRequest{
+		Data:              r.Data,
+		Identity:          r.Identity,
+		IdentitySignature: r.IdentitySignature,
+	})
+	if err != nil {
+		return err
+	}
+	r.Data, r.Identity, r.IdentitySignature = nil, nil, nil
+	r.Sealed = sealed
+	return nil
+}
+
+func (r *RPCRequest) open(key []byte) error {
+	secrets := &RPCRequest{}
+	if err := openPayload(key, r.aad(), r.Sealed, secrets); err != nil {
+		return err
+	}
+	r.Data, r.Identity, r.IdentitySignature = secrets.Data, secrets.Identity, secrets.IdentitySignature
+	r.Sealed = nil
+	return nil
+}
+
+func (r *RPCResponse) aad() []byte {
+	return payloadAAD("rpc response")
+}
+
+func (r *RPCResponse) seal(key []byte) error {
+	sealed, err := sealPayload(key, r.aad(), &RPCResponse{
+		Data:  r.Data,
+		Error: r.Error,
+		Code:  r.Code,
+	})
+	if err != nil {
+		return err
+	}
+	r.Data, r.Error, r.Code = nil, "", ""
+	r.Sealed = sealed
+	return nil
+}
+
+func (r *RPCResponse) open(key []byte) error {
+	secrets := &RPCResponse{}
+	if err := openPayload(key, r.aad(), r.Sealed, secrets); err != nil {
+		return err
+	}
+	r.Data, r.Error, r.Code = secrets.Data, secrets.Error, secrets.Code
+	r.Sealed = nil
+	return nil
+}
@@ -0,0 +1,124 @@
+package absinthe
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRESTPayloadEncryption(t *testing.T) {
+	peerKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	payloadKey, senderKey, err := newRequestKey(peerKey.PublicKey().Bytes())
+	assert.NoError(t, err)
+
+	request := &RESTRequest{
+		Method:   "GET",
+		URL:      "/users/1",
+		Header:   http.Header{"Authorization": []string{"Bearer token"}},
+		Body:     []byte("secret"),
+		Identity: []byte("identity"),
+	}
+	assert.NoError(t, request.seal(payloadKey))
+	assert.Equal(t, "GET", request.Method)
+	assert.Equal(t, "/users/1", request.URL)
+	assert.Nil(t, request.Header)
+	assert.Nil(t, request.Body)
+	assert.Nil(t, request.Identity)
+	assert.NotEmpty(t, request.Sealed)
+
+	openedKey, err := openRequestKey(peerKey, senderKey)
+	assert.NoError(t, err)
+	assert.Equal(t, payloadKey, openedKey)
+	assert.NoError(t, request.open(openedKey))
+	assert.Equal(t, "Bearer token", request.Header.Get("Authorization"))
+	assert.Equal(t, []byte("secret"), request.Body)
+	assert.Equal(t, []byte("identity"), request.Identity)
+
+	response := &RESTResponse{Status: 200, Body: []byte("result")}
+	assert.NoError(t, response.seal(openedKey))
+	assert.Nil(t, response.Body)
+	assert.NoError(t, response.open(payloadKey))
+	assert.Equal(t, []byte("result"), response.Body)
+}
+
+func TestPayloadEncryptionBindsCleartextFields(t *testing.T) {
+	peerKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	payloadKey, _, err := newRequestKey(peerKey.PublicKey().Bytes())
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name   string
+		splice func(*RESTRequest)
+	}{
+		{"method", func(r *RESTRequest) { r.Method = "DELETE" }},
+		{"url", func(r *RESTRequest) { r.URL = "/admin" }},
+		{"request id", func(r *RESTRequest) { r.RequestID = "other" }},
+		{"trace context", func(r *RESTRequest) { r.TraceContext = map[string]string{"traceparent": "other"} }},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			request := &RESTRequest{
+				Method:       "GET",
+				URL:          "/users/1",
+				RequestID:    "1",
+				TraceContext: map[string]string{"traceparent": "1"},
+				Body:         []byte("secret"),
+			}
+			assert.NoError(t, request.seal(payloadKey))
+			testCase.splice(request)
+			assert.Error(t, request.open(payloadKey))
+		})
+	}
+
+	call := &RPCRequest{Path: "user.1.get", RequestID: "1", Data: []byte("secret")}
+	assert.NoError(t, call.seal(payloadKey))
+	call.Path = "user.1.delete"
+	assert.Error(t, call.open(payloadKey))
+
+	response := &RESTResponse{Status: 404, Body: []byte("result")}
+	assert.NoError(t, response.seal(payloadKey))
+	response.Status = 200
+	assert.Error(t, response.open(payloadKey))
+}
+
+func TestRPCPayloadEncryption(t *testing.T) {
+	peerKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	otherKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	payloadKey, senderKey, err := newRequestKey(peerKey.PublicKey().Bytes())
+	assert.NoError(t, err)
+
+	request := &RPCRequest{Path: "user.1.get", Data: []byte("secret")}
+	assert.NoError(t, request.seal(payloadKey))
+	assert.Equal(t, "user.1.get", request.Path)
+	assert.Nil(t, request.Data)
+
+	wrongKey, err := openRequestKey(otherKey, senderKey)
+	assert.NoError(t, err)
+	assert.Error(t, request.open(wrongKey))
+
+	response := &RPCResponse{Error: "failed", Code: "forbidden"}
+	assert.NoError(t, response.seal(payloadKey))
+	assert.Empty(t, response.Error)
+	assert.Empty(t, response.Code)
+	assert.NoError(t, response.open(payloadKey))
+	assert.Equal(t, "failed", response.Error)
+	assert.Equal(t, "forbidden", response.Code)
+
+	_, _, err = newRequestKey(nil)
+	assert.Equal(t, ErrNoPeerEncryptionKey, err)
+}
+
+func TestEncryptPayloadsRequiresTrustedKeys(t *testing.T) {
+	_, err := Connect("", EncryptPayloads())
+	assert.Equal(t, ErrUntrustedEncryptionKeys, err)
+}
@@ -0,0 +1,58 @@
+package absinthe
+
+import (
+	"net/http"
+)
+
+// RESTRequest is the envelope used to carry an HTTP request from a gateway to
+// the peer that handles it. When payload encryption is enabled everything but
+// the method, URL, request ID, and trace context is carried in Sealed, which
+// can only be opened along with them.
+type RESTRequest struct {
+	Method            string
+	URL               string
+	RequestID         string
+	TraceContext      map[string]string
+	Header            http.Header
+	Body              []byte
+	Identity          []byte
+	IdentitySignature []byte
+	SenderKey         []byte
+	Sealed            []byte
+}
+
+// RESTResponse is the envelope used to carry the response produced by a peer
+// back to the gateway. When payload encryption is enabled the header and body
+// are carried in Sealed.
+type RESTResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	Sealed []byte
+}
+
+// RPCRequest is the envelope used to carry an RPC call to the peer that
+// handles it. When payload encryption is enabled everything but the path,
+// request ID, and trace context is carried in Sealed, which can only be opened
+// along with them.
+type RPCRequest struct {
+	Path              string
+	RequestID         string
+	TraceContext      map[string]string
+	Data              []byte
+	Identity          []byte
+	IdentitySignature []byte
+	SenderKey         []byte
+	Sealed            []byte
+}
+
+// RPCResponse is the envelope used to carry the result of an RPC call back to
+// the caller. Code identifies errors the caller can recognize, such as
+// ErrForbidden. When payload encryption is enabled the data and error are
+// carried in Sealed.
+type RPCResponse struct {
+	Data   []byte
+	Error  string
+	Code   string
+	Sealed []byte
+}
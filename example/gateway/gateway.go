@@ -1,11 +1,13 @@
 package main
 
 import (
+	"net/http"
+
 	"github.com/RobertWHurst/Absinthe"
 )
 
 func main() {
-	_, err := absinthe.Connect(
+	client, err := absinthe.Connect(
 		absinthe.DefaultURL,
 		absinthe.Name("gateway"),
 		absinthe.Version("0.1.0"),
@@ -15,14 +17,12 @@ func main() {
 		panic(err)
 	}
 
-	// server := http.Server{
-	// 	Addr:    ":8000",
-	// 	Handler: client,
-	// }
-
-	// if err := server.ListenAndServe(); err != nil {
-	// 	panic(err)
-	// }
+	server := http.Server{
+		Addr:    ":8000",
+		Handler: client,
+	}
 
-	select {}
+	if err := server.ListenAndServe(); err != nil {
+		panic(err)
+	}
 }
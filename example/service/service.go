@@ -5,7 +5,7 @@ import (
 )
 
 func main() {
-	_, err := absinthe.Connect(
+	client, err := absinthe.Connect(
 		absinthe.DefaultURL,
 		absinthe.Name("service"),
 		absinthe.Version("0.1.0"),
@@ -15,10 +15,13 @@ func main() {
 		panic(err)
 	}
 
-	// abs.Use(func(c *absinthe.RESTContext) {
-	// 	println("here")
-	// 	c.Status(200).End()
-	// })
+	err = client.Get("/users/:id", func(c *absinthe.RESTContext) {
+		c.Write([]byte("user " + c.Params["id"]))
+		c.End()
+	})
+	if err != nil {
+		panic(err)
+	}
 
 	select {}
 }
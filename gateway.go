@@ -0,0 +1,138 @@
+package absinthe
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServeHTTP dispatches HTTP requests to a known peer with a matching REST
+// route, allowing the client to be used as a gateway. Each request is traced
+// with a server span, continuing any trace context carried by its headers.
+func (c *Client) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	requestID := requestIDFor(r)
+	rw.Header().Set(RequestIDHeader, requestID)
+	logger := c.logger.With("request_id", requestID, "method", r.Method, "url", r.URL.RequestURI())
+
+	ctx := c.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := c.startSpan(ctx, r.Method, trace.SpanKindServer, requestID,
+		attribute.String("http.request.method", r.Method),
+		attribute.String("url.path", r.URL.Path),
+	)
+	w := &statusWriter{ResponseWriter: rw}
+	defer func() { endRESTSpan(span, w.status) }()
+
+	peer, route, ok := c.indexer.FindRESTPeer(r.Method, r.URL.Path)
+	if !ok {
+		logger.Debug("no peer handles rest route")
+		http.NotFound(w, r)
+		return
+	}
+	logger = logger.With("route", route.PatternSrc, "remote_peer_id", peer.ID)
+	span.SetName(r.Method + " " + route.PatternSrc)
+	span.SetAttributes(attribute.String("http.route", route.PatternSrc), AttributeRoute.String(route.PatternSrc))
+
+	identity := IdentityFromContext(r.Context())
+	params, _ := route.FindParams(r.Method, r.URL.Path)
+	if err := authorize(route.Policies, identity, params); err != nil {
+		status := authorizationStatus(err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	header := r.Header
+	if identity != nil {
+		header = withoutCredentials(r.Context(), r.Header)
+	}
+	request := &RESTRequest{
+		Method:    r.Method,
+		URL:       r.URL.RequestURI(),
+		RequestID: requestID,
+		Header:    header,
+		Body:      body,
+	}
+	if identity != nil {
+		request.Identity, request.IdentitySignature, err = c.signForwardedIdentity(identity, requestID, restIdentityTarget(request.Method, request.URL))
+		if err != nil {
+			logger.Error("failed to sign identity", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	response, payloadKey, err := c.dispatchREST(ctx, peer, route, request)
+	if err != nil {
+		logger.Warn("failed to dispatch rest request", "error", err)
+		if err == ErrTimeout {
+			http.Error(w, err.Error(), http.StatusGatewayTimeout)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		}
+		return
+	}
+	if payloadKey != nil {
+		if len(response.Sealed) == 0 {
+			logger.Warn("rejected plaintext rest response")
+			http.Error(w, ErrPlaintextPayload.Error(), http.StatusBadGateway)
+			return
+		}
+		if err := response.open(payloadKey); err != nil {
+			logger.Warn("failed to open rest response", "error", err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+
+	writeRESTResponse(w, response)
+}
+
+// dispatchREST sends a request to a peer within a client span, carrying the
+// trace context of the span in the request. The request is sealed once its
+// trace context is set, as the trace context is bound to the sealed payload,
+// and the key the response is sealed with is returned.
+func (c *Client) dispatchREST(ctx context.Context, peer Peer, route RESTRoute, request *RESTRequest) (*RESTResponse, []byte, error) {
+	attrs := append(peerAttributes(peer),
+		attribute.String("http.request.method", request.Method),
+		attribute.String("http.route", route.PatternSrc),
+		AttributeRoute.String(route.PatternSrc),
+	)
+	ctx, span := c.startSpan(ctx, request.Method+" "+route.PatternSrc, trace.SpanKindClient, request.RequestID, attrs...)
+	request.TraceContext = c.injectTraceContext(ctx)
+	payloadKey, err := c.sealRESTRequest(peer, request)
+	if err != nil {
+		endSpan(span, err)
+		return nil, nil, err
+	}
+
+	done := c.startDispatchMetrics(MetricsKindREST)
+
+	response := &RESTResponse{}
+	if err := c.Request("REST-"+peer.ID, request, response, c.options.RequestTimeout); err != nil {
+		done(request.Method, route.PatternSrc, peer, true)
+		endSpan(span, err)
+		return nil, nil, err
+	}
+	done(request.Method, route.PatternSrc, peer, response.Status >= http.StatusInternalServerError)
+	endRESTSpan(span, response.Status)
+	return response, payloadKey, nil
+}
+
+func writeRESTResponse(w http.ResponseWriter, response *RESTResponse) {
+	for name, values := range response.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.WriteHeader(response.Status)
+	w.Write(response.Body)
+}
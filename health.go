@@ -0,0 +1,216 @@
+package absinthe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Health statuses
+const (
+	HealthStatusOK          = "ok"
+	HealthStatusUnavailable = "unavailable"
+	HealthStatusUnreachable = "unreachable"
+)
+
+// ErrNotConnected is reported by health checks while the transport of a client
+// is not connected
+var ErrNotConnected = errors.New("absinthe: transport is not connected")
+
+// ErrIndexerNotReady is reported by health checks until the indexer of a client
+// has completed a discovery round
+var ErrIndexerNotReady = errors.New("absinthe: indexer has not completed a discovery round")
+
+// ErrUnknownPeer is returned when a peer is not known to the indexer
+var ErrUnknownPeer = errors.New("absinthe: unknown peer")
+
+// ErrHealthCheckTimedOut is reported for checks which have not finished when
+// the context of a health check is done
+var ErrHealthCheckTimedOut = errors.New("absinthe: health check timed out")
+
+// ErrReservedHealthCheck is returned when adding a check with the name of one
+// of the checks every client runs
+var ErrReservedHealthCheck = errors.New("absinthe: health check name is reserved")
+
+// reservedHealthChecks are the names of the checks every client runs
+var reservedHealthChecks = map[string]bool{"transport": true, "indexer": true}
+
+// HealthCheck reports whether a dependency of a client, such as a database, is
+// usable. It should give up once ctx is done.
+type HealthCheck func(ctx context.Context) error
+
+// Health is the readiness of a client. Checks holds the result of each check,
+// which is "ok" for checks that passed, and the error otherwise.
+type Health struct {
+	Status    string            `json:"status"`
+	Checks    map[string]string `json:"checks,omitempty"`
+	CheckedAt time.Time         `json:"checkedAt"`
+}
+
+// OK reports whether every check passed
+func (h *Health) OK() bool {
+	return h.Status == HealthStatusOK
+}
+
+// healthChecks holds the checks registered on a client
+type healthChecks struct {
+	mu     sync.RWMutex
+	checks map[string]HealthCheck
+}
+
+// AddHealthCheck registers a check run to decide the readiness of the client.
+// Adding a check with the name of an existing check replaces it. The names
+// transport and indexer are reserved for the checks every client runs.
+func (c *Client) AddHealthCheck(name string, check HealthCheck) error {
+	if reservedHealthChecks[name] {
+		return ErrReservedHealthCheck
+	}
+	c.healthChecks.mu.Lock()
+	defer c.healthChecks.mu.Unlock()
+	if c.healthChecks.checks == nil {
+		c.healthChecks.checks = make(map[string]HealthCheck)
+	}
+	c.healthChecks.checks[name] = check
+	return nil
+}
+
+// Health checks the readiness of the client. The client is ready once its
+// transport is connected, its indexer has completed a discovery round, and
+// every registered check passes. Checks are run concurrently, and are given
+// until ctx is done or the request timeout of the client passes. Checks which
+// have not finished by then are reported as timed out.
+func (c *Client) Health(ctx context.Context) *Health {
+	ctx, cancel := context.WithTimeout(ctx, c.options.RequestTimeout)
+	defer cancel()
+
+	results := map[string]error{
+		"transport": nil,
+		"indexer":   nil,
+	}
+	if !c.IsConnected() {
+		results["transport"] = ErrNotConnected
+	}
+	if !c.indexer.Ready() {
+		results["indexer"] = ErrIndexerNotReady
+	}
+
+	c.healthChecks.mu.RLock()
+	checks := make(map[string]HealthCheck, len(c.healthChecks.checks))
+	for name, check := range c.healthChecks.checks {
+		checks[name] = check
+	}
+	c.healthChecks.mu.RUnlock()
+
+	type checkResult struct {
+		name string
+		err  error
+	}
+	checkResults := make(chan checkResult, len(checks))
+	for name, check := range checks {
+		results[name] = ErrHealthCheckTimedOut
+		go func(name string, check HealthCheck) {
+			checkResults <- checkResult{name: name, err: check(ctx)}
+		}(name, check)
+	}
+collect:
+	for remaining := len(checks); remaining > 0; remaining-- {
+		select {
+		case result := <-checkResults:
+			results[result.name] = result.err
+		case <-ctx.Done():
+			break collect
+		}
+	}
+
+	health := &Health{
+		Status:    HealthStatusOK,
+		Checks:    make(map[string]string, len(results)),
+		CheckedAt: time.Now(),
+	}
+	for name, err := range results {
+		if err != nil {
+			health.Status = HealthStatusUnavailable
+			health.Checks[name] = err.Error()
+		} else {
+			health.Checks[name] = HealthStatusOK
+		}
+	}
+	return health
+}
+
+// HealthHandler returns an http.Handler for liveness and readiness probes.
+// Requests to paths ending in /live or /livez are always answered with 200, as
+// answering them shows the process is responsive. All other requests are
+// answered with the readiness of the client, with a 200 if it is ready and a
+// 503 otherwise. The body of both is the Health of the client as JSON.
+func (c *Client) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var health *Health
+		if strings.HasSuffix(r.URL.Path, "/live") || strings.HasSuffix(r.URL.Path, "/livez") {
+			health = &Health{Status: HealthStatusOK, CheckedAt: time.Now()}
+		} else {
+			health = c.Health(r.Context())
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if health.OK() {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(health)
+	})
+}
+
+// CheckPeerHealth asks a known peer for its health over the transport. The
+// result is recorded on the peer as returned by the indexer. Peers which do not
+// respond are recorded as unreachable.
+func (c *Client) CheckPeerHealth(peerID string) (*Health, error) {
+	if _, ok := c.indexer.Peer(peerID); !ok {
+		return nil, ErrUnknownPeer
+	}
+
+	health := &Health{}
+	if err := c.Request("HEALTH-"+peerID, c.ID, health, c.options.RequestTimeout); err != nil {
+		c.indexer.setPeerHealth(peerID, &Health{
+			Status:    HealthStatusUnreachable,
+			Checks:    map[string]string{"transport": err.Error()},
+			CheckedAt: time.Now(),
+		})
+		return nil, err
+	}
+	c.indexer.setPeerHealth(peerID, health)
+	return health, nil
+}
+
+// CheckPeersHealth checks the health of every known peer concurrently, and
+// returns the results by peer ID
+func (c *Client) CheckPeersHealth() map[string]*Health {
+	peers := c.indexer.Peers()
+	results := make(map[string]*Health, len(peers))
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for _, peer := range peers {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			c.CheckPeerHealth(id)
+			peer, _ := c.indexer.Peer(id)
+			mu.Lock()
+			results[id] = peer.Health
+			mu.Unlock()
+		}(peer.ID)
+	}
+	wg.Wait()
+	return results
+}
+
+// handleHealthRequest responds to health checks made by other peers
+func (c *Client) handleHealthRequest(reply string) {
+	c.publishReply(reply, c.Health(context.Background()))
+}
@@ -0,0 +1,125 @@
+package absinthe_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	absinthe "github.com/RobertWHurst/Absinthe"
+	"github.com/RobertWHurst/Absinthe/absinthetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthHandler(t *testing.T) {
+	client := absinthetest.NewCluster(t).Connect("service")
+
+	var dbDown int32
+	assert.NoError(t, client.AddHealthCheck("db", func(ctx context.Context) error {
+		if atomic.LoadInt32(&dbDown) == 1 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}))
+	for _, name := range []string{"transport", "indexer"} {
+		assert.Equal(t, absinthe.ErrReservedHealthCheck, client.AddHealthCheck(name, func(ctx context.Context) error {
+			return nil
+		}))
+	}
+
+	probe := func(path string) (int, absinthe.Health) {
+		recorder := httptest.NewRecorder()
+		client.HealthHandler().ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+		health := absinthe.Health{}
+		assert.NoError(t, json.NewDecoder(recorder.Body).Decode(&health))
+		return recorder.Code, health
+	}
+
+	code, health := probe("/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, absinthe.ErrIndexerNotReady.Error(), health.Checks["indexer"])
+
+	absinthetest.WaitFor(t, client.Indexer().Ready, "indexer to be ready")
+
+	code, health = probe("/ready")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]string{"transport": "ok", "indexer": "ok", "db": "ok"}, health.Checks)
+
+	atomic.StoreInt32(&dbDown, 1)
+	code, health = probe("/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, absinthe.HealthStatusUnavailable, health.Status)
+	assert.Equal(t, "connection refused", health.Checks["db"])
+
+	code, health = probe("/healthz/live")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, absinthe.HealthStatusOK, health.Status)
+
+	client.Close()
+	code, health = probe("/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, absinthe.ErrNotConnected.Error(), health.Checks["transport"])
+}
+
+func TestCheckPeerHealth(t *testing.T) {
+	cluster := absinthetest.NewCluster(t)
+	gateway := cluster.Connect("gateway")
+	service := cluster.Connect("service")
+	assert.NoError(t, service.AddHealthCheck("db", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	}))
+
+	_, err := gateway.CheckPeerHealth("unknown")
+	assert.Equal(t, absinthe.ErrUnknownPeer, err)
+
+	absinthetest.WaitFor(t, func() bool {
+		_, ok := gateway.Indexer().Peer(service.ID)
+		return ok
+	}, "peer %s", service.ID)
+
+	peer, ok := gateway.Indexer().Peer(service.ID)
+	assert.True(t, ok)
+	assert.Nil(t, peer.Health)
+
+	health, err := gateway.CheckPeerHealth(service.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, absinthe.HealthStatusUnavailable, health.Status)
+	assert.Equal(t, "connection refused", health.Checks["db"])
+
+	peer, _ = gateway.Indexer().Peer(service.ID)
+	assert.Equal(t, health, peer.Health)
+
+	results := gateway.CheckPeersHealth()
+	assert.Len(t, results, 1)
+	assert.Equal(t, "connection refused", results[service.ID].Checks["db"])
+}
+
+func TestHealthCheckTimeout(t *testing.T) {
+	client := absinthetest.NewCluster(t).Connect("service")
+	absinthetest.WaitFor(t, client.Indexer().Ready, "indexer to be ready")
+
+	unblock := make(chan struct{})
+	defer close(unblock)
+	assert.NoError(t, client.AddHealthCheck("db", func(ctx context.Context) error {
+		<-unblock
+		return nil
+	}))
+	assert.NoError(t, client.AddHealthCheck("cache", func(ctx context.Context) error {
+		return nil
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	health := client.Health(ctx)
+	assert.Equal(t, absinthe.HealthStatusUnavailable, health.Status)
+	assert.Equal(t, map[string]string{
+		"transport": "ok",
+		"indexer":   "ok",
+		"cache":     "ok",
+		"db":        absinthe.ErrHealthCheckTimedOut.Error(),
+	}, health.Checks)
+}
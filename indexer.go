@@ -1,10 +1,11 @@
 package absinthe
 
 import (
-	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"sync"
 	"time"
-
-	"github.com/davecgh/go-spew/spew"
 )
 
 // DefaultIndexerAnnouceInterval is the interval in number of seconds between
@@ -17,79 +18,570 @@ const DefaultIndexerAnnouceInterval = 1 * time.Second
 // peer to send the request to.
 type Indexer struct {
 	client      *Client
-	isRunning   bool
+	stopChan    chan struct{}
 	stoppedChan chan struct{}
+	stopOnce    *sync.Once
 
+	mu         *sync.RWMutex
 	knownPeers map[string]Peer
+	restIndex  *routeIndex
+	rpcIndex   *routeIndex
 
 	nextKnownPeers map[string]Peer
+
+	seenNonces map[string]time.Time
+
+	peerHealth map[string]*Health
+	rounds     int
+
+	conflicts        []RouteConflict
+	routesChanged    bool
+	refusedPeers     map[string]Peer
+	nextRefusedPeers map[string]Peer
+
+	watchers *indexerWatchers
+}
+
+// Types of IndexerEvent
+const (
+	IndexerEventPeerJoined    = "peer_joined"
+	IndexerEventPeerLeft      = "peer_left"
+	IndexerEventRouteConflict = "route_conflict"
+)
+
+// IndexerEvent describes a change to the peers known to an indexer. Conflict
+// is set for route conflict events, which are sent once when a conflict is
+// first found.
+type IndexerEvent struct {
+	Type     string
+	Peer     Peer
+	Conflict *RouteConflict
+	At       time.Time
+}
+
+type indexerWatchers struct {
+	mu       sync.Mutex
+	next     int
+	handlers map[int]func(IndexerEvent)
 }
 
 func NewIndexer(client *Client) Indexer {
 	return Indexer{
-		client:         client,
-		isRunning:      false,
-		stoppedChan:    make(chan struct{}),
-		knownPeers:     make(map[string]Peer),
-		nextKnownPeers: make(map[string]Peer),
+		client:           client,
+		stopChan:         make(chan struct{}),
+		stoppedChan:      make(chan struct{}),
+		stopOnce:         &sync.Once{},
+		mu:               &sync.RWMutex{},
+		knownPeers:       make(map[string]Peer),
+		restIndex:        newRESTRouteIndex(),
+		rpcIndex:         newRPCPatternIndex(),
+		nextKnownPeers:   make(map[string]Peer),
+		seenNonces:       make(map[string]time.Time),
+		peerHealth:       make(map[string]*Health),
+		refusedPeers:     make(map[string]Peer),
+		nextRefusedPeers: make(map[string]Peer),
+		watchers:         &indexerWatchers{handlers: make(map[int]func(IndexerEvent))},
 	}
 }
 
-func (i *Indexer) HasRPCHandlerFor(path string) bool {
-	for _, peer := range i.knownPeers {
-		if peer.HasRPCHandlerFor(path) {
-			return true
+// Watch calls handler with each event of the indexer until the returned
+// function is called. Handlers are called from the indexing goroutine, and
+// should not block.
+func (i *Indexer) Watch(handler func(IndexerEvent)) func() {
+	i.watchers.mu.Lock()
+	defer i.watchers.mu.Unlock()
+	id := i.watchers.next
+	i.watchers.next++
+	i.watchers.handlers[id] = handler
+	return func() {
+		i.watchers.mu.Lock()
+		defer i.watchers.mu.Unlock()
+		delete(i.watchers.handlers, id)
+	}
+}
+
+func (i *Indexer) emit(events []IndexerEvent) {
+	if len(events) == 0 {
+		return
+	}
+	i.watchers.mu.Lock()
+	handlers := make([]func(IndexerEvent), 0, len(i.watchers.handlers))
+	for _, handler := range i.watchers.handlers {
+		handlers = append(handlers, handler)
+	}
+	i.watchers.mu.Unlock()
+	for _, event := range events {
+		for _, handler := range handlers {
+			handler(event)
 		}
 	}
-	return false
+}
+
+func (i *Indexer) HasRPCHandlerFor(path string) bool {
+	_, _, ok := i.FindRPCPeer(path)
+	return ok
 }
 
 func (i *Indexer) HasRestHandlerFor(method, path string) bool {
+	_, _, ok := i.FindRESTPeer(method, path)
+	return ok
+}
+
+// Peers returns the known peers, sorted by ID
+func (i *Indexer) Peers() []Peer {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	peers := make([]Peer, 0, len(i.knownPeers))
 	for _, peer := range i.knownPeers {
-		if peer.HasRestHandlerFor(method, path) {
-			return true
+		peers = append(peers, peer)
+	}
+	sortPeers(peers)
+	return peers
+}
+
+// Peer returns the known peer with the given ID
+func (i *Indexer) Peer(id string) (Peer, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	peer, ok := i.knownPeers[id]
+	return peer, ok
+}
+
+// Ready reports whether the indexer has completed at least one discovery
+// round, so the peers it knows of can be relied upon
+func (i *Indexer) Ready() bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.rounds > 0
+}
+
+// setPeerHealth records the result of a health check of a known peer
+func (i *Indexer) setPeerHealth(id string, health *Health) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.peerHealth[id] = health
+	for _, peers := range []map[string]Peer{i.knownPeers, i.nextKnownPeers} {
+		if peer, ok := peers[id]; ok {
+			peer.Health = health
+			peers[id] = peer
 		}
 	}
-	return false
 }
 
-func (i *Indexer) Start() {
-	i.isRunning = true
+// Conflicts returns the overlapping routes and patterns advertised by peers
+// with different names, as found by the last indexing round. Peers refused
+// because of a conflict are included.
+func (i *Indexer) Conflicts() []RouteConflict {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return append([]RouteConflict{}, i.conflicts...)
+}
+
+// RESTMatch is a route taking precedence for a request, along with the
+// known peers advertising it and the params found in the path
+type RESTMatch struct {
+	Route  RESTRoute
+	Peers  []Peer
+	Params map[string]string
+}
 
+// RPCMatch is a pattern taking precedence for an rpc path, along with the
+// known peers advertising it and the params found in the path
+type RPCMatch struct {
+	Pattern RPCPattern
+	Peers   []Peer
+	Params  map[string]string
+}
+
+// MatchREST returns the route of known peers taking precedence for the given
+// method and path. Routes are found with an index of the routes of known
+// peers, so the cost of a lookup depends on the length of the path rather than
+// the number of routes. Peers are sorted by ID.
+func (i *Indexer) MatchREST(method, path string) (RESTMatch, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	var matched *RESTRoute
+	peers := make([]Peer, 0)
+	for _, candidate := range i.restIndex.candidates(path) {
+		route := candidate.restRoute
+		if !route.Match(method, path) {
+			continue
+		}
+		if matched != nil {
+			c := compareRESTRoutes(route, matched)
+			if c > 0 {
+				continue
+			}
+			if c < 0 {
+				peers = peers[:0]
+			}
+		}
+		matched = route
+		peers = append(peers, i.knownPeers[candidate.peerID])
+	}
+	if matched == nil {
+		return RESTMatch{}, false
+	}
+	sortPeers(peers)
+	params, _ := matched.FindParams(method, path)
+	return RESTMatch{Route: *matched, Peers: peers, Params: params}, true
+}
+
+// MatchRPC returns the pattern of known peers taking precedence for the given
+// rpc path. Patterns are found with an index, as with MatchREST.
+func (i *Indexer) MatchRPC(path string) (RPCMatch, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	var matched *RPCPattern
+	peers := make([]Peer, 0)
+	for _, candidate := range i.rpcIndex.candidates(path) {
+		pattern := candidate.rpcPattern
+		if !pattern.Match(path) {
+			continue
+		}
+		if matched != nil {
+			c := compareRPCPatterns(pattern, matched)
+			if c > 0 {
+				continue
+			}
+			if c < 0 {
+				peers = peers[:0]
+			}
+		}
+		matched = pattern
+		peers = append(peers, i.knownPeers[candidate.peerID])
+	}
+	if matched == nil {
+		return RPCMatch{}, false
+	}
+	sortPeers(peers)
+	params, _ := matched.FindParams(path)
+	return RPCMatch{Pattern: *matched, Peers: peers, Params: params}, true
+}
+
+// FindRPCPeer returns a known peer with a handler for the given rpc path, along
+// with the pattern it matched. The peer is chosen from those advertising the
+// pattern taking precedence, at random if there are several.
+func (i *Indexer) FindRPCPeer(path string) (Peer, RPCPattern, bool) {
+	match, ok := i.MatchRPC(path)
+	if !ok {
+		return Peer{}, RPCPattern{}, false
+	}
+	return match.Peers[rand.Intn(len(match.Peers))], match.Pattern, true
+}
+
+// FindRESTPeer returns a known peer with a handler for the given method and
+// path, along with the route it matched. The peer is chosen from those
+// advertising the route taking precedence, at random if there are several.
+func (i *Indexer) FindRESTPeer(method, path string) (Peer, RESTRoute, bool) {
+	match, ok := i.MatchREST(method, path)
+	if !ok {
+		return Peer{}, RESTRoute{}, false
+	}
+	return match.Peers[rand.Intn(len(match.Peers))], match.Route, true
+}
+
+// setKnownPeer adds or replaces a known peer, and indexes its routes and
+// patterns. Peers announcing the same routes and patterns as before are
+// replaced without being re-indexed. It reports whether the routes and
+// patterns of the peer changed, and must be called with mu held.
+func (i *Indexer) setKnownPeer(peer Peer) bool {
+	if knownPeer, ok := i.knownPeers[peer.ID]; ok && sameRoutes(knownPeer, peer) {
+		i.knownPeers[peer.ID] = peer
+		return false
+	}
+	i.deleteKnownPeer(peer.ID)
+	i.knownPeers[peer.ID] = peer
+	i.routesChanged = true
+	for _, route := range peer.RESTRoutes {
+		i.restIndex.addRESTRoute(peer.ID, route)
+	}
+	for _, pattern := range peer.RPCPatterns {
+		i.rpcIndex.addRPCPattern(peer.ID, pattern)
+	}
+	return true
+}
+
+// sameRoutes reports whether two peers advertise the same routes and patterns
+// with the same policies. Routes and patterns are keyed by their method and
+// compiled pattern, so equal keys have equal patterns.
+func sameRoutes(a, b Peer) bool {
+	if len(a.RESTRoutes) != len(b.RESTRoutes) || len(a.RPCPatterns) != len(b.RPCPatterns) {
+		return false
+	}
+	for key, route := range a.RESTRoutes {
+		otherRoute, ok := b.RESTRoutes[key]
+		if !ok || !reflect.DeepEqual(route.Policies, otherRoute.Policies) {
+			return false
+		}
+	}
+	for key, pattern := range a.RPCPatterns {
+		otherPattern, ok := b.RPCPatterns[key]
+		if !ok || !reflect.DeepEqual(pattern.Policies, otherPattern.Policies) {
+			return false
+		}
+	}
+	return true
+}
+
+// deleteKnownPeer removes a known peer and its routes and patterns from the
+// index. It must be called with mu held.
+func (i *Indexer) deleteKnownPeer(id string) {
+	peer, ok := i.knownPeers[id]
+	if !ok {
+		return
+	}
+	delete(i.knownPeers, id)
+	i.routesChanged = true
+	for _, route := range peer.RESTRoutes {
+		i.restIndex.removeRESTRoute(id, route)
+	}
+	for _, pattern := range peer.RPCPatterns {
+		i.rpcIndex.removeRPCPattern(id, pattern)
+	}
+}
+
+func sortPeers(peers []Peer) {
+	sort.Slice(peers, func(a, b int) bool {
+		return peers[a].ID < peers[b].ID
+	})
+}
+
+func (i *Indexer) Start() {
 	i.client.Subscribe("PING", func(requestingPeerID string) {
-		if requestingPeerID != i.client.ID {
-			err := i.client.Publish("PONG-"+requestingPeerID, i.client.Peer)
+		if requestingPeerID != i.client.ID && !i.client.options.Passive {
+			i.client.peerMu.RLock()
+			announcement, err := newAnnouncement(&i.client.Peer, requestingPeerID, i.client.options.SigningKey)
+			i.client.peerMu.RUnlock()
+			if err != nil {
+				i.client.logger.Error("failed to create announcement", "remote_peer_id", requestingPeerID, "error", err)
+				return
+			}
+			err = i.client.Publish("PONG-"+requestingPeerID, announcement)
 			if err != nil {
-				fmt.Println(err)
+				i.client.logger.Error("failed to publish announcement", "remote_peer_id", requestingPeerID, "error", err)
 			}
 		}
 	})
 
-	i.client.Subscribe("PONG-"+i.client.ID, func(respondingPeer Peer) {
+	i.client.Subscribe("PONG-"+i.client.ID, func(announcement *Announcement) {
+		respondingPeer, err := i.acceptAnnouncement(announcement, time.Now())
+		if err != nil {
+			i.client.logger.Warn("rejected announcement", "error", err)
+			return
+		}
 		if respondingPeer.ID != i.client.ID {
-			i.knownPeers[respondingPeer.ID] = respondingPeer
+			events := make([]IndexerEvent, 0)
+			i.mu.Lock()
+			if i.client.options.RefuseConflictingPeers && i.refuseConflicting(respondingPeer) {
+				i.mu.Unlock()
+				return
+			}
+			respondingPeer.Health = i.peerHealth[respondingPeer.ID]
+			if _, ok := i.knownPeers[respondingPeer.ID]; !ok {
+				i.client.logger.Debug("discovered peer", "remote_peer_id", respondingPeer.ID, "remote_peer_name", respondingPeer.Name)
+				events = append(events, IndexerEvent{Type: IndexerEventPeerJoined, Peer: respondingPeer, At: time.Now()})
+			}
+			i.setKnownPeer(respondingPeer)
 			i.nextKnownPeers[respondingPeer.ID] = respondingPeer
+			i.mu.Unlock()
+			i.emit(events)
 		}
 	})
 
-	for i.isRunning {
-		i.client.Publish("PING", i.client.ID)
-		<-time.After(DefaultIndexerAnnouceInterval)
-		for k := range i.knownPeers {
-			delete(i.knownPeers, k)
+	for {
+		if err := i.client.Publish("PING", i.client.ID); err != nil {
+			i.client.logger.Error("failed to publish ping", "error", err)
+		}
+		select {
+		case <-time.After(i.client.options.IndexingInterval):
+		case <-i.stopChan:
+			i.stoppedChan <- struct{}{}
+			return
+		}
+		events := make([]IndexerEvent, 0)
+		i.mu.Lock()
+		for k, peer := range i.knownPeers {
+			if _, ok := i.nextKnownPeers[k]; !ok {
+				i.client.logger.Debug("lost peer", "remote_peer_id", k, "remote_peer_name", peer.Name)
+				delete(i.peerHealth, k)
+				events = append(events, IndexerEvent{Type: IndexerEventPeerLeft, Peer: peer, At: time.Now()})
+				i.deleteKnownPeer(k)
+			}
 		}
 		for k := range i.nextKnownPeers {
-			i.knownPeers[k] = i.nextKnownPeers[k]
+			if _, ok := i.knownPeers[k]; !ok {
+				i.setKnownPeer(i.nextKnownPeers[k])
+			}
 		}
 		for k := range i.nextKnownPeers {
 			delete(i.nextKnownPeers, k)
 		}
-		spew.Dump(i.knownPeers)
+		conflictPeers, conflictsChanged := i.conflictPeers()
+		for k, seenAt := range i.seenNonces {
+			if time.Since(seenAt) > 2*MaxAnnouncementAge {
+				delete(i.seenNonces, k)
+			}
+		}
+		i.rounds++
+		i.client.logger.Debug("indexed peers", "peers", len(i.knownPeers))
+		if i.client.options.Metrics != nil {
+			i.client.options.Metrics.observeIndex(i.client.Peer, i.knownPeers)
+		}
+		i.mu.Unlock()
+		if conflictsChanged {
+			events = append(events, i.indexConflicts(conflictPeers)...)
+		}
+		i.emit(events)
+	}
+}
+
+// refuseConflicting reports whether a peer conflicts with a known peer which
+// started before it, and so should be refused. Known peers conflicting with
+// the peer which started after it are refused in its favour. Peer IDs begin
+// with the time their peer started, so every indexer refuses the same peers.
+// It must be called with mu held.
+func (i *Indexer) refuseConflicting(peer Peer) bool {
+	candidates := make(map[string]Peer, len(i.knownPeers)+len(i.nextKnownPeers))
+	for id, knownPeer := range i.knownPeers {
+		candidates[id] = knownPeer
+	}
+	for id, knownPeer := range i.nextKnownPeers {
+		candidates[id] = knownPeer
+	}
+
+	refused := false
+	for id, knownPeer := range candidates {
+		if id == peer.ID || !conflictsWith(peer, knownPeer) {
+			continue
+		}
+		if knownPeer.ID < peer.ID {
+			refused = true
+			continue
+		}
+		i.deleteKnownPeer(id)
+		delete(i.nextKnownPeers, id)
+		i.refusePeer(knownPeer)
 	}
-	i.stoppedChan <- struct{}{}
+	if refused {
+		i.deleteKnownPeer(peer.ID)
+		delete(i.nextKnownPeers, peer.ID)
+		i.refusePeer(peer)
+	}
+	return refused
+}
+
+// refusePeer records a peer as refused. It must be called with mu held.
+func (i *Indexer) refusePeer(peer Peer) {
+	if _, ok := i.refusedPeers[peer.ID]; !ok {
+		if _, ok := i.nextRefusedPeers[peer.ID]; !ok {
+			i.client.logger.Error("refused peer with conflicting routes", "remote_peer_id", peer.ID, "remote_peer_name", peer.Name)
+		}
+	}
+	i.nextRefusedPeers[peer.ID] = peer
 }
 
+// conflictPeers returns the peers seen during the round, including refused
+// peers, if their routes or patterns may have changed since conflicts were
+// last found, and whether they may have. It must be called with mu held, after
+// knownPeers has been updated.
+func (i *Indexer) conflictPeers() ([]Peer, bool) {
+	changed := i.routesChanged || !samePeers(i.refusedPeers, i.nextRefusedPeers)
+	i.routesChanged = false
+	i.refusedPeers = i.nextRefusedPeers
+	i.nextRefusedPeers = make(map[string]Peer)
+	if !changed {
+		return nil, false
+	}
+
+	peers := make([]Peer, 0, len(i.knownPeers)+len(i.refusedPeers))
+	for _, peer := range i.knownPeers {
+		peers = append(peers, peer)
+	}
+	for id, peer := range i.refusedPeers {
+		if _, ok := i.knownPeers[id]; !ok {
+			peers = append(peers, peer)
+		}
+	}
+	return peers, true
+}
+
+// samePeers reports whether two sets of peers have the same peers, advertising
+// the same routes and patterns
+func samePeers(a, b map[string]Peer) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for id, peer := range a {
+		otherPeer, ok := b[id]
+		if !ok || !sameRoutes(peer, otherPeer) {
+			return false
+		}
+	}
+	return true
+}
+
+// indexConflicts finds the conflicts between the given peers, and returns
+// events for those which are new. Finding conflicts compares every pair of
+// routes, so it is done without holding mu, leaving lookups unblocked.
+func (i *Indexer) indexConflicts(peers []Peer) []IndexerEvent {
+	conflicts := findConflicts(peers)
+
+	i.mu.Lock()
+	previous := make(map[string]bool, len(i.conflicts))
+	for _, conflict := range i.conflicts {
+		previous[conflict.key()] = true
+	}
+	i.conflicts = conflicts
+	i.mu.Unlock()
+
+	events := make([]IndexerEvent, 0)
+	for n := range conflicts {
+		conflict := &conflicts[n]
+		if previous[conflict.key()] {
+			continue
+		}
+		i.client.logger.Warn("route conflict",
+			"kind", conflict.Kind,
+			"remote_peer_name", conflict.Claims[0].Name,
+			"route", conflict.Claims[0].Method+" "+conflict.Claims[0].Pattern,
+			"conflicting_peer_name", conflict.Claims[1].Name,
+			"conflicting_route", conflict.Claims[1].Method+" "+conflict.Claims[1].Pattern,
+		)
+		events = append(events, IndexerEvent{Type: IndexerEventRouteConflict, Conflict: conflict, At: time.Now()})
+	}
+
+	return events
+}
+
+// acceptAnnouncement decodes the peer carried by an announcement. If trusted
+// keys are configured the announcement must be signed by one of them, and
+// each signed announcement is only accepted once.
+func (i *Indexer) acceptAnnouncement(announcement *Announcement, now time.Time) (Peer, error) {
+	trustedKeys := i.client.options.TrustedKeys
+	if len(trustedKeys) != 0 {
+		if err := announcement.Verify(trustedKeys, i.client.ID, now); err != nil {
+			return Peer{}, err
+		}
+		i.mu.Lock()
+		nonce := string(announcement.Nonce)
+		_, seen := i.seenNonces[nonce]
+		if !seen {
+			i.seenNonces[nonce] = now
+		}
+		i.mu.Unlock()
+		if seen {
+			return Peer{}, ErrReplayedAnnouncement
+		}
+	}
+	return announcement.Peer()
+}
+
+// Stop stops indexing and waits for the indexer to finish. Calling Stop more
+// than once has no effect.
 func (i *Indexer) Stop() {
-	i.isRunning = false
-	<-i.stoppedChan
+	i.stopOnce.Do(func() {
+		close(i.stopChan)
+		<-i.stoppedChan
+	})
 }
@@ -0,0 +1,101 @@
+package absinthe_test
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	absinthe "github.com/RobertWHurst/Absinthe"
+	"github.com/RobertWHurst/Absinthe/absinthetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexerRouteConflicts(t *testing.T) {
+	testCases := map[string]bool{
+		"known":   false,
+		"refused": true,
+	}
+
+	for name, refuse := range testCases {
+		refuse := refuse
+		t.Run(name, func(t *testing.T) {
+			cluster := absinthetest.NewCluster(t)
+			connect := func(name string) *absinthe.Client {
+				if refuse {
+					return cluster.Connect(name, absinthe.RefuseConflictingPeers())
+				}
+				return cluster.Connect(name)
+			}
+			gateway := connect("gateway")
+
+			// A conflict is sent again if a peer misses a round under load, so
+			// conflicts are told apart by the names of their claims
+			mu := sync.Mutex{}
+			claimed := make(map[string]bool)
+			first := ""
+			stop := gateway.Indexer().Watch(func(event absinthe.IndexerEvent) {
+				if event.Type != absinthe.IndexerEventRouteConflict {
+					return
+				}
+				names := []string{event.Conflict.Claims[0].Name, event.Conflict.Claims[1].Name}
+				sort.Strings(names)
+				mu.Lock()
+				if first == "" {
+					first = event.Conflict.Claims[0].Pattern + " " + event.Conflict.Claims[1].Pattern
+				}
+				claimed[strings.Join(names, " ")] = true
+				mu.Unlock()
+			})
+			defer stop()
+			received := func() map[string]bool {
+				mu.Lock()
+				defer mu.Unlock()
+				claims := make(map[string]bool, len(claimed))
+				for claim := range claimed {
+					claims[claim] = true
+				}
+				return claims
+			}
+
+			users := connect("users")
+			assert.NoError(t, users.Get("/users/:id", func(c *absinthe.RESTContext) { c.End() }))
+			cluster.WaitForREST(gateway, "GET", "/users/1")
+			profiles := connect("profiles")
+			assert.NoError(t, profiles.Get("/users/me", func(c *absinthe.RESTContext) { c.End() }))
+
+			absinthetest.WaitFor(t, func() bool {
+				return len(received()) != 0
+			}, "a conflict event")
+			mu.Lock()
+			assert.Equal(t, "/users/me /users/:id", first)
+			mu.Unlock()
+
+			// The peer which started last is refused. Peer IDs begin with the
+			// time their peer started.
+			earlier, later := users, profiles
+			if profiles.ID < users.ID {
+				earlier, later = profiles, users
+			}
+			absinthetest.WaitFor(t, func() bool {
+				_, laterKnown := gateway.Indexer().Peer(later.ID)
+				_, earlierKnown := gateway.Indexer().Peer(earlier.ID)
+				return laterKnown == !refuse && earlierKnown
+			}, "%s to be indexed", later.Name)
+
+			accounts := connect("accounts")
+			assert.NoError(t, accounts.Get("/users/:name", func(c *absinthe.RESTContext) { c.End() }))
+			absinthetest.WaitFor(t, func() bool {
+				return len(received()) >= 3
+			}, "conflict events for accounts")
+			assert.Equal(t, map[string]bool{
+				"profiles users":    true,
+				"accounts users":    true,
+				"accounts profiles": true,
+			}, received())
+			absinthetest.WaitFor(t, func() bool {
+				return len(gateway.Indexer().Conflicts()) == 3
+			}, "three conflicts")
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package absinthe
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// RequestIDHeader is the header gateways read the request ID of incoming
+// requests from, and write it back to on responses
+const RequestIDHeader = "X-Request-ID"
+
+// AccessLogField selects a field written by the access log middleware
+type AccessLogField string
+
+const (
+	AccessLogRequestID AccessLogField = "request_id"
+	AccessLogPeerID    AccessLogField = "peer_id"
+	AccessLogNamespace AccessLogField = "namespace"
+	AccessLogMethod    AccessLogField = "method"
+	AccessLogURL       AccessLogField = "url"
+	AccessLogPath      AccessLogField = "path"
+	AccessLogRoute     AccessLogField = "route"
+	AccessLogStatus    AccessLogField = "status"
+	AccessLogError     AccessLogField = "error"
+	AccessLogSize      AccessLogField = "size"
+	AccessLogDuration  AccessLogField = "duration"
+	AccessLogSubject   AccessLogField = "subject"
+)
+
+// DefaultAccessLogFields are the fields written by the access log middleware
+// when none are given. Fields which do not apply to a request, such as the
+// status of an RPC call, are skipped.
+var DefaultAccessLogFields = []AccessLogField{
+	AccessLogRequestID,
+	AccessLogMethod,
+	AccessLogURL,
+	AccessLogPath,
+	AccessLogRoute,
+	AccessLogStatus,
+	AccessLogError,
+	AccessLogDuration,
+}
+
+// RESTAccessLog returns a middleware logging each REST request once its
+// response has ended. Responses with a 5xx status are logged at the error
+// level, all others at the info level.
+func RESTAccessLog(logger *slog.Logger, fields ...AccessLogField) RESTHandler {
+	if len(fields) == 0 {
+		fields = DefaultAccessLogFields
+	}
+	return func(c *RESTContext) {
+		start := time.Now()
+		c.onEnd(func() {
+			level := slog.LevelInfo
+			if c.response.Status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+			attrs := make([]slog.Attr, 0, len(fields))
+			for _, field := range fields {
+				var value slog.Value
+				switch field {
+				case AccessLogRequestID:
+					value = slog.StringValue(c.RequestID)
+				case AccessLogPeerID:
+					if c.client != nil {
+						value = slog.StringValue(c.client.ID)
+					}
+				case AccessLogNamespace:
+					if c.client != nil {
+						value = slog.StringValue(c.client.options.Namespace)
+					}
+				case AccessLogMethod:
+					value = slog.StringValue(c.Method)
+				case AccessLogURL:
+					value = slog.StringValue(c.request.URL)
+				case AccessLogPath:
+					value = slog.StringValue(c.URL)
+				case AccessLogRoute:
+					if c.route != nil {
+						value = slog.StringValue(c.route.PatternSrc)
+					}
+				case AccessLogStatus:
+					value = slog.IntValue(c.response.Status)
+				case AccessLogSize:
+					value = slog.IntValue(len(c.response.Body))
+				case AccessLogDuration:
+					value = slog.DurationValue(time.Since(start))
+				case AccessLogSubject:
+					if c.Identity != nil {
+						value = slog.StringValue(c.Identity.Subject)
+					}
+				}
+				if value.Kind() != slog.KindAny || value.Any() != nil {
+					attrs = append(attrs, slog.Attr{Key: string(field), Value: value})
+				}
+			}
+			logger.LogAttrs(context.Background(), level, "rest request", attrs...)
+		})
+		c.Next()
+	}
+}
+
+// RPCAccessLog returns a middleware logging each RPC call once it has been
+// responded to. Calls ending in an error are logged at the error level, all
+// others at the info level.
+func RPCAccessLog(logger *slog.Logger, fields ...AccessLogField) RPCHandler {
+	if len(fields) == 0 {
+		fields = DefaultAccessLogFields
+	}
+	return func(c *RPCContext) {
+		start := time.Now()
+		c.onEnd(func() {
+			level := slog.LevelInfo
+			if len(c.response.Error) != 0 {
+				level = slog.LevelError
+			}
+			attrs := make([]slog.Attr, 0, len(fields))
+			for _, field := range fields {
+				var value slog.Value
+				switch field {
+				case AccessLogRequestID:
+					value = slog.StringValue(c.RequestID)
+				case AccessLogPeerID:
+					if c.client != nil {
+						value = slog.StringValue(c.client.ID)
+					}
+				case AccessLogNamespace:
+					if c.client != nil {
+						value = slog.StringValue(c.client.options.Namespace)
+					}
+				case AccessLogPath:
+					value = slog.StringValue(c.Path)
+				case AccessLogRoute:
+					if c.pattern != nil {
+						value = slog.StringValue(c.pattern.PatternSrc)
+					}
+				case AccessLogError:
+					if len(c.response.Error) != 0 {
+						value = slog.StringValue(c.response.Error)
+					}
+				case AccessLogSize:
+					value = slog.IntValue(len(c.response.Data))
+				case AccessLogDuration:
+					value = slog.DurationValue(time.Since(start))
+				case AccessLogSubject:
+					if c.Identity != nil {
+						value = slog.StringValue(c.Identity.Subject)
+					}
+				}
+				if value.Kind() != slog.KindAny || value.Any() != nil {
+					attrs = append(attrs, slog.Attr{Key: string(field), Value: value})
+				}
+			}
+			logger.LogAttrs(context.Background(), level, "rpc call", attrs...)
+		})
+		c.Next()
+	}
+}
+
+// requestIDFor returns the request ID carried by an HTTP request, or a new one
+// if it has none
+func requestIDFor(r *http.Request) string {
+	if requestID := r.Header.Get(RequestIDHeader); len(requestID) != 0 && len(requestID) <= 128 {
+		return requestID
+	}
+	return newRequestID()
+}
+
+// newRequestID returns a random ID used to correlate the log lines of a
+// request across peers
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// discardHandler is the slog handler used when no logger is configured
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
@@ -0,0 +1,115 @@
+package absinthe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeLogLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	lines := make([]map[string]interface{}, 0)
+	decoder := json.NewDecoder(buf)
+	for decoder.More() {
+		line := make(map[string]interface{})
+		assert.NoError(t, decoder.Decode(&line))
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestRESTAccessLog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(buf, nil))
+
+	router := NewRESTRouter()
+	assert.NoError(t, router.Use(RESTAccessLog(logger, AccessLogRequestID, AccessLogMethod, AccessLogPath, AccessLogRoute, AccessLogStatus, AccessLogSize)))
+	assert.NoError(t, router.Get("/users/:id", func(c *RESTContext) {
+		c.Status(http.StatusCreated).Write([]byte("user"))
+		c.End()
+	}))
+
+	req := httptest.NewRequest("GET", "/users/1?full=true", nil)
+	req.Header.Set(RequestIDHeader, "abc123")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+
+	lines := decodeLogLines(t, buf)
+	assert.Len(t, lines, 2)
+
+	assert.Equal(t, "INFO", lines[0]["level"])
+	assert.Equal(t, "rest request", lines[0]["msg"])
+	assert.Equal(t, "abc123", lines[0]["request_id"])
+	assert.Equal(t, "GET", lines[0]["method"])
+	assert.Equal(t, "/users/1", lines[0]["path"])
+	assert.Equal(t, "/users/:id", lines[0]["route"])
+	assert.Equal(t, float64(http.StatusCreated), lines[0]["status"])
+	assert.Equal(t, float64(4), lines[0]["size"])
+	assert.NotContains(t, lines[0], "duration")
+
+	assert.Equal(t, float64(http.StatusNotFound), lines[1]["status"])
+	assert.NotEmpty(t, lines[1]["request_id"])
+}
+
+func TestRPCAccessLog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(buf, nil))
+
+	router := NewRPCRouter()
+	router.UseRPC(RPCAccessLog(logger))
+	assert.NoError(t, router.Handle("user.$id.get", func(c *RPCContext) {
+		c.Respond([]byte("user"))
+	}))
+	assert.NoError(t, router.Handle("user.$id.delete", func(c *RPCContext) {
+		c.Error(errors.New("forbidden"))
+	}))
+
+	_, err := router.Invoke(context.Background(), "user.1.get", nil)
+	assert.NoError(t, err)
+	_, err = router.Invoke(context.Background(), "user.1.delete", nil)
+	assert.EqualError(t, err, "forbidden")
+	_, err = router.Invoke(context.Background(), "user.1.update", nil)
+	assert.Equal(t, ErrNoRPCHandler, err)
+
+	lines := decodeLogLines(t, buf)
+	assert.Len(t, lines, 2)
+
+	assert.Equal(t, "INFO", lines[0]["level"])
+	assert.Equal(t, "rpc call", lines[0]["msg"])
+	assert.Equal(t, "user.1.get", lines[0]["path"])
+	assert.Equal(t, "user.$id.get", lines[0]["route"])
+	assert.NotEmpty(t, lines[0]["request_id"])
+	assert.Contains(t, lines[0], "duration")
+	assert.NotContains(t, lines[0], "status")
+	assert.NotContains(t, lines[0], "error")
+
+	assert.Equal(t, "ERROR", lines[1]["level"])
+	assert.Equal(t, "forbidden", lines[1]["error"])
+}
+
+func TestRPCRouterMiddleware(t *testing.T) {
+	router := NewRPCRouter()
+	router.UseRPC(func(c *RPCContext) {
+		if c.Identity == nil {
+			c.Error(ErrUnauthenticated)
+			return
+		}
+		c.Next()
+	})
+	assert.NoError(t, router.Handle("user.$id.get", func(c *RPCContext) {
+		c.Respond([]byte(c.Identity.Subject + " " + c.Params["id"]))
+	}))
+
+	_, err := router.Invoke(context.Background(), "user.1.get", nil)
+	assert.EqualError(t, err, ErrUnauthenticated.Error())
+
+	data, err := router.Invoke(WithIdentity(context.Background(), &Identity{Subject: "alice"}), "user.1.get", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("alice 1"), data)
+}
@@ -0,0 +1,287 @@
+// Package memory provides an in-process absinthe Transport. Clients using
+// transports from the same Network can discover each other and exchange REST
+// and RPC traffic without a nats server, which is useful for tests.
+package memory
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	absinthe "github.com/RobertWHurst/Absinthe"
+)
+
+// Network routes messages between the transports created from it
+type Network struct {
+	mu            sync.RWMutex
+	subscriptions map[string][]*subscription
+	queueCounters map[string]int
+	inboxCounter  uint64
+}
+
+// NewNetwork creates an empty Network
+func NewNetwork() *Network {
+	return &Network{
+		subscriptions: make(map[string][]*subscription),
+		queueCounters: make(map[string]int),
+	}
+}
+
+// NewTransport creates a Transport connected to the network
+func (n *Network) NewTransport() *Transport {
+	return &Transport{
+		network:       n,
+		subscriptions: make(map[*subscription]struct{}),
+	}
+}
+
+func (n *Network) subscribe(s *subscription) {
+	n.mu.Lock()
+	n.subscriptions[s.subject] = append(n.subscriptions[s.subject], s)
+	n.mu.Unlock()
+	go s.run()
+}
+
+func (n *Network) unsubscribe(s *subscription) {
+	n.mu.Lock()
+	subscriptions := n.subscriptions[s.subject]
+	for i, knownSubscription := range subscriptions {
+		if knownSubscription == s {
+			n.subscriptions[s.subject] = append(subscriptions[:i:i], subscriptions[i+1:]...)
+			break
+		}
+	}
+	if len(n.subscriptions[s.subject]) == 0 {
+		delete(n.subscriptions, s.subject)
+	}
+	n.mu.Unlock()
+	s.close()
+}
+
+func (n *Network) publish(subject, reply string, data []byte) {
+	msgData := make([]byte, len(data))
+	copy(msgData, data)
+
+	n.mu.Lock()
+	queues := make(map[string][]*subscription)
+	recipients := make([]*subscription, 0)
+	for subscribedSubject, subscriptions := range n.subscriptions {
+		if !matchSubject(subscribedSubject, subject) {
+			continue
+		}
+		for _, s := range subscriptions {
+			if len(s.queue) == 0 {
+				recipients = append(recipients, s)
+			} else {
+				queues[s.queue] = append(queues[s.queue], s)
+			}
+		}
+	}
+	for queue, members := range queues {
+		key := subject + " " + queue
+		recipients = append(recipients, members[n.queueCounters[key]%len(members)])
+		n.queueCounters[key]++
+	}
+	n.mu.Unlock()
+
+	for _, s := range recipients {
+		s.deliver(&absinthe.Message{
+			Subject: subject,
+			Reply:   reply,
+			Data:    msgData,
+		})
+	}
+}
+
+// matchSubject reports whether a subscription to pattern receives messages
+// published to subject. As with nats, a * token in pattern matches any one
+// token, and a trailing > token matches one or more tokens.
+func matchSubject(pattern, subject string) bool {
+	if pattern == subject {
+		return true
+	}
+	if !strings.ContainsAny(pattern, "*>") {
+		return false
+	}
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+	for i, token := range patternTokens {
+		if token == ">" && i == len(patternTokens)-1 {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) || (token != "*" && token != subjectTokens[i]) {
+			return false
+		}
+	}
+	return len(patternTokens) == len(subjectTokens)
+}
+
+func (n *Network) newInbox() string {
+	return "_INBOX." + strconv.FormatUint(atomic.AddUint64(&n.inboxCounter, 1), 10)
+}
+
+// Transport is an absinthe Transport delivering messages to other transports
+// on the same Network
+type Transport struct {
+	network       *Network
+	mu            sync.Mutex
+	subscriptions map[*subscription]struct{}
+	closed        bool
+}
+
+func (t *Transport) IsConnected() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return !t.closed
+}
+
+func (t *Transport) Publish(subject string, data []byte) error {
+	return t.PublishRequest(subject, "", data)
+}
+
+func (t *Transport) PublishRequest(subject, reply string, data []byte) error {
+	t.mu.Lock()
+	closed := t.closed
+	t.mu.Unlock()
+	if closed {
+		return absinthe.ErrTransportClosed
+	}
+	t.network.publish(subject, reply, data)
+	return nil
+}
+
+func (t *Transport) Subscribe(subject string, handler absinthe.MessageHandler) (absinthe.Subscription, error) {
+	return t.QueueSubscribe(subject, "", handler)
+}
+
+func (t *Transport) QueueSubscribe(subject, queue string, handler absinthe.MessageHandler) (absinthe.Subscription, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, absinthe.ErrTransportClosed
+	}
+	s := newSubscription(t, subject, queue, handler)
+	t.subscriptions[s] = struct{}{}
+	t.network.subscribe(s)
+	return s, nil
+}
+
+func (t *Transport) Request(ctx context.Context, subject string, data []byte) ([]byte, error) {
+	inbox := t.network.newInbox()
+	responses := make(chan []byte, 1)
+	s, err := t.Subscribe(inbox, func(msg *absinthe.Message) {
+		select {
+		case responses <- msg.Data:
+		default:
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer s.Unsubscribe()
+
+	if err := t.PublishRequest(subject, inbox, data); err != nil {
+		return nil, err
+	}
+
+	select {
+	case data := <-responses:
+		return data, nil
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, absinthe.ErrTimeout
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (t *Transport) Close() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	subscriptions := t.subscriptions
+	t.subscriptions = make(map[*subscription]struct{})
+	t.mu.Unlock()
+
+	for s := range subscriptions {
+		t.network.unsubscribe(s)
+	}
+	return nil
+}
+
+func (t *Transport) forget(s *subscription) {
+	t.mu.Lock()
+	delete(t.subscriptions, s)
+	t.mu.Unlock()
+}
+
+// subscription delivers messages to its handler in order, on its own
+// goroutine, so slow handlers never block publishers
+type subscription struct {
+	transport *Transport
+	subject   string
+	queue     string
+	handler   absinthe.MessageHandler
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []*absinthe.Message
+	closed  bool
+}
+
+func newSubscription(transport *Transport, subject, queue string, handler absinthe.MessageHandler) *subscription {
+	s := &subscription{
+		transport: transport,
+		subject:   subject,
+		queue:     queue,
+		handler:   handler,
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *subscription) Unsubscribe() error {
+	s.transport.forget(s)
+	s.transport.network.unsubscribe(s)
+	return nil
+}
+
+func (s *subscription) deliver(msg *absinthe.Message) {
+	s.mu.Lock()
+	if !s.closed {
+		s.pending = append(s.pending, msg)
+		s.cond.Signal()
+	}
+	s.mu.Unlock()
+}
+
+func (s *subscription) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.pending = nil
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
+
+func (s *subscription) run() {
+	for {
+		s.mu.Lock()
+		for len(s.pending) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+		msg := s.pending[0]
+		s.pending = s.pending[1:]
+		s.mu.Unlock()
+
+		s.handler(msg)
+	}
+}
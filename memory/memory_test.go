@@ -0,0 +1,122 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	absinthe "github.com/RobertWHurst/Absinthe"
+	"github.com/stretchr/testify/assert"
+)
+
+func receive(t *testing.T, messages chan *absinthe.Message) *absinthe.Message {
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for message")
+		return nil
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	network := NewNetwork()
+	a := network.NewTransport()
+	b := network.NewTransport()
+
+	messages := make(chan *absinthe.Message, 10)
+	_, err := b.Subscribe("absinthe.PING", func(msg *absinthe.Message) {
+		messages <- msg
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, a.Publish("absinthe.PING", []byte("1")))
+	assert.NoError(t, a.Publish("absinthe.PONG", []byte("2")))
+	assert.NoError(t, a.Publish("absinthe.PING", []byte("3")))
+
+	assert.Equal(t, []byte("1"), receive(t, messages).Data)
+	assert.Equal(t, []byte("3"), receive(t, messages).Data)
+
+	assert.NoError(t, b.Close())
+	assert.Equal(t, absinthe.ErrTransportClosed, b.Publish("absinthe.PING", nil))
+}
+
+func TestQueueSubscribe(t *testing.T) {
+	network := NewNetwork()
+	transport := network.NewTransport()
+
+	messages := make(chan *absinthe.Message, 10)
+	for i := 0; i < 2; i++ {
+		_, err := transport.QueueSubscribe("absinthe.work", "workers", func(msg *absinthe.Message) {
+			messages <- msg
+		})
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, transport.Publish("absinthe.work", []byte("job")))
+	receive(t, messages)
+	select {
+	case <-messages:
+		t.Fatal("queue message was delivered more than once")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRequest(t *testing.T) {
+	network := NewNetwork()
+	a := network.NewTransport()
+	b := network.NewTransport()
+
+	_, err := b.Subscribe("absinthe.echo", func(msg *absinthe.Message) {
+		b.Publish(msg.Reply, append([]byte("echo "), msg.Data...))
+	})
+	assert.NoError(t, err)
+
+	response, err := a.Request(context.Background(), "absinthe.echo", []byte("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("echo hello"), response)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = a.Request(ctx, "absinthe.nobody", nil)
+	assert.Equal(t, absinthe.ErrTimeout, err)
+}
+
+func TestMatchSubject(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		subject string
+		match   bool
+	}{
+		{"absinthe.PING", "absinthe.PING", true},
+		{"absinthe.PING", "absinthe.PONG", false},
+		{"absinthe.*", "absinthe.PING", true},
+		{"absinthe.*", "absinthe.team.PING", false},
+		{"*.PING", "absinthe.PING", true},
+		{"absinthe.>", "absinthe.PING", true},
+		{"absinthe.>", "absinthe.team.PING", true},
+		{"absinthe.>", "absinthe", false},
+		{"_INBOX.>", "_INBOX.1", true},
+		{"absinthe.*.PING", "absinthe.PING", false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.pattern+" "+testCase.subject, func(t *testing.T) {
+			assert.Equal(t, testCase.match, matchSubject(testCase.pattern, testCase.subject))
+		})
+	}
+}
+
+func TestWildcardSubscribe(t *testing.T) {
+	network := NewNetwork()
+	transport := network.NewTransport()
+
+	messages := make(chan *absinthe.Message, 10)
+	_, err := transport.Subscribe("absinthe.>", func(msg *absinthe.Message) {
+		messages <- msg
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, transport.Publish("absinthe.team.PING", []byte("ping")))
+	assert.Equal(t, "absinthe.team.PING", receive(t, messages).Subject)
+}
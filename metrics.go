@@ -0,0 +1,295 @@
+package absinthe
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Kinds of traffic used as the kind label of metrics
+const (
+	MetricsKindREST = "rest"
+	MetricsKindRPC  = "rpc"
+)
+
+// metricsOtherMethod is the method label of requests with a method outside of
+// metricsMethods
+const metricsOtherMethod = "other"
+
+// metricsMethods are the methods used as the method label of metrics. Other
+// methods are counted under metricsOtherMethod, as the method of a request is
+// chosen by the caller.
+var metricsMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true,
+	http.MethodPut: true, http.MethodPatch: true, http.MethodDelete: true,
+	http.MethodConnect: true, http.MethodOptions: true, http.MethodTrace: true,
+}
+
+// Metrics collects prometheus metrics from the clients it is given to with
+// the UseMetrics Option. Request metrics are labelled by route pattern rather
+// than URL, and by one of a fixed set of methods, so their cardinality is
+// bounded by the number of routes.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	dispatchRequests *prometheus.CounterVec
+	dispatchErrors   *prometheus.CounterVec
+	dispatchDuration *prometheus.HistogramVec
+	dispatchInFlight *prometheus.GaugeVec
+
+	handlerRequests *prometheus.CounterVec
+	handlerErrors   *prometheus.CounterVec
+	handlerDuration *prometheus.HistogramVec
+	handlerInFlight *prometheus.GaugeVec
+
+	publishedBytes *prometheus.CounterVec
+	receivedBytes  *prometheus.CounterVec
+
+	knownPeers       *prometheus.GaugeVec
+	knownRESTRoutes  *prometheus.GaugeVec
+	knownRPCPatterns *prometheus.GaugeVec
+}
+
+// NewMetrics creates the absinthe metrics and registers them with registry.
+// If registry is nil a new one is created.
+func NewMetrics(registry *prometheus.Registry) *Metrics {
+	if registry == nil {
+		registry = prometheus.NewRegistry()
+	}
+
+	requestLabels := []string{"kind", "method", "route", "peer", "version"}
+	peerLabels := []string{"peer", "version"}
+
+	m := &Metrics{
+		registry: registry,
+
+		dispatchRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "absinthe", Subsystem: "dispatch", Name: "requests_total",
+			Help: "Requests dispatched to peers, labelled by the peer dispatched to.",
+		}, requestLabels),
+		dispatchErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "absinthe", Subsystem: "dispatch", Name: "errors_total",
+			Help: "Dispatched requests which failed or ended with a server error.",
+		}, requestLabels),
+		dispatchDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "absinthe", Subsystem: "dispatch", Name: "duration_seconds",
+			Help:    "Time taken for dispatched requests to be responded to.",
+			Buckets: prometheus.DefBuckets,
+		}, requestLabels),
+		dispatchInFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "absinthe", Subsystem: "dispatch", Name: "in_flight",
+			Help: "Dispatched requests awaiting a response.",
+		}, []string{"kind"}),
+
+		handlerRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "absinthe", Subsystem: "handler", Name: "requests_total",
+			Help: "Requests handled, labelled by the handling peer.",
+		}, requestLabels),
+		handlerErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "absinthe", Subsystem: "handler", Name: "errors_total",
+			Help: "Handled requests which timed out or ended with a server error.",
+		}, requestLabels),
+		handlerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "absinthe", Subsystem: "handler", Name: "duration_seconds",
+			Help:    "Time taken for handlers to respond.",
+			Buckets: prometheus.DefBuckets,
+		}, requestLabels),
+		handlerInFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "absinthe", Subsystem: "handler", Name: "in_flight",
+			Help: "Requests being handled.",
+		}, []string{"kind", "peer", "version"}),
+
+		publishedBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "absinthe", Subsystem: "transport", Name: "published_bytes_total",
+			Help: "Bytes published to the transport.",
+		}, peerLabels),
+		receivedBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "absinthe", Subsystem: "transport", Name: "received_bytes_total",
+			Help: "Bytes received from the transport.",
+		}, peerLabels),
+
+		knownPeers: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "absinthe", Subsystem: "indexer", Name: "known_peers",
+			Help: "Peers found by the last indexing round.",
+		}, peerLabels),
+		knownRESTRoutes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "absinthe", Subsystem: "indexer", Name: "known_rest_routes",
+			Help: "REST routes advertised by the peers found by the last indexing round.",
+		}, peerLabels),
+		knownRPCPatterns: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "absinthe", Subsystem: "indexer", Name: "known_rpc_patterns",
+			Help: "RPC patterns advertised by the peers found by the last indexing round.",
+		}, peerLabels),
+	}
+
+	registry.MustRegister(
+		m.dispatchRequests, m.dispatchErrors, m.dispatchDuration, m.dispatchInFlight,
+		m.handlerRequests, m.handlerErrors, m.handlerDuration, m.handlerInFlight,
+		m.publishedBytes, m.receivedBytes,
+		m.knownPeers, m.knownRESTRoutes, m.knownRPCPatterns,
+	)
+
+	return m
+}
+
+// Registry returns the registry the metrics are registered with
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler returns an http.Handler serving the metrics in the prometheus
+// exposition format, to be mounted at /metrics
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// startDispatchMetrics returns a function recording the outcome of a dispatch
+// in the request rates of the client, and in its metrics if it has any
+func (c *Client) startDispatchMetrics(kind string) func(method, route string, peer Peer, failed bool) {
+	var observe func(string, string, Peer, bool)
+	if c.options.Metrics != nil {
+		observe = c.options.Metrics.startDispatch(kind)
+	}
+	return func(method, route string, peer Peer, failed bool) {
+		method = methodLabel(method)
+		c.rates.add("dispatch", kind, method, route, failed, time.Now())
+		if observe != nil {
+			observe(method, route, peer, failed)
+		}
+	}
+}
+
+// startHandlerMetrics returns a function recording the outcome of a handled
+// request in the request rates of the client, and in its metrics if it has any
+func (c *Client) startHandlerMetrics(kind string) func(method, route string, failed bool) {
+	var observe func(string, string, bool)
+	if c.options.Metrics != nil {
+		observe = c.options.Metrics.startHandler(kind, c.Peer)
+	}
+	return func(method, route string, failed bool) {
+		method = methodLabel(method)
+		c.rates.add("handler", kind, method, route, failed, time.Now())
+		if observe != nil {
+			observe(method, route, failed)
+		}
+	}
+}
+
+func (m *Metrics) startDispatch(kind string) func(method, route string, peer Peer, failed bool) {
+	start := time.Now()
+	inFlight := m.dispatchInFlight.WithLabelValues(kind)
+	inFlight.Inc()
+	return func(method, route string, peer Peer, failed bool) {
+		inFlight.Dec()
+		labels := []string{kind, method, route, peer.Name, versionLabel(peer)}
+		m.dispatchRequests.WithLabelValues(labels...).Inc()
+		m.dispatchDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+		if failed {
+			m.dispatchErrors.WithLabelValues(labels...).Inc()
+		}
+	}
+}
+
+func (m *Metrics) startHandler(kind string, peer Peer) func(method, route string, failed bool) {
+	start := time.Now()
+	inFlight := m.handlerInFlight.WithLabelValues(kind, peer.Name, versionLabel(peer))
+	inFlight.Inc()
+	return func(method, route string, failed bool) {
+		inFlight.Dec()
+		labels := []string{kind, method, route, peer.Name, versionLabel(peer)}
+		m.handlerRequests.WithLabelValues(labels...).Inc()
+		m.handlerDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+		if failed {
+			m.handlerErrors.WithLabelValues(labels...).Inc()
+		}
+	}
+}
+
+func (m *Metrics) observeIndex(peer Peer, knownPeers map[string]Peer) {
+	restRoutes, rpcPatterns := 0, 0
+	for _, knownPeer := range knownPeers {
+		restRoutes += len(knownPeer.RESTRoutes)
+		rpcPatterns += len(knownPeer.RPCPatterns)
+	}
+	m.knownPeers.WithLabelValues(peer.Name, versionLabel(peer)).Set(float64(len(knownPeers)))
+	m.knownRESTRoutes.WithLabelValues(peer.Name, versionLabel(peer)).Set(float64(restRoutes))
+	m.knownRPCPatterns.WithLabelValues(peer.Name, versionLabel(peer)).Set(float64(rpcPatterns))
+}
+
+// methodLabel returns the method label of a request method. RPC calls have
+// no method and keep an empty label.
+func methodLabel(method string) string {
+	if method == "" {
+		return ""
+	}
+	method = strings.ToUpper(method)
+	if !metricsMethods[method] {
+		return metricsOtherMethod
+	}
+	return method
+}
+
+func versionLabel(peer Peer) string {
+	if peer.Version == nil {
+		return ""
+	}
+	return peer.Version.String()
+}
+
+// metricsTransport counts the bytes moved through a transport
+type metricsTransport struct {
+	Transport
+	published prometheus.Counter
+	received  prometheus.Counter
+}
+
+func (m *Metrics) wrapTransport(transport Transport, peer Peer) Transport {
+	return &metricsTransport{
+		Transport: transport,
+		published: m.publishedBytes.WithLabelValues(peer.Name, versionLabel(peer)),
+		received:  m.receivedBytes.WithLabelValues(peer.Name, versionLabel(peer)),
+	}
+}
+
+func (t *metricsTransport) IsConnected() bool {
+	if transport, ok := t.Transport.(StatefulTransport); ok {
+		return transport.IsConnected()
+	}
+	return true
+}
+
+func (t *metricsTransport) Publish(subject string, data []byte) error {
+	t.published.Add(float64(len(data)))
+	return t.Transport.Publish(subject, data)
+}
+
+func (t *metricsTransport) PublishRequest(subject, reply string, data []byte) error {
+	t.published.Add(float64(len(data)))
+	return t.Transport.PublishRequest(subject, reply, data)
+}
+
+func (t *metricsTransport) Subscribe(subject string, handler MessageHandler) (Subscription, error) {
+	return t.Transport.Subscribe(subject, t.countReceived(handler))
+}
+
+func (t *metricsTransport) QueueSubscribe(subject, queue string, handler MessageHandler) (Subscription, error) {
+	return t.Transport.QueueSubscribe(subject, queue, t.countReceived(handler))
+}
+
+func (t *metricsTransport) Request(ctx context.Context, subject string, data []byte) ([]byte, error) {
+	t.published.Add(float64(len(data)))
+	response, err := t.Transport.Request(ctx, subject, data)
+	t.received.Add(float64(len(response)))
+	return response, err
+}
+
+func (t *metricsTransport) countReceived(handler MessageHandler) MessageHandler {
+	return func(msg *Message) {
+		t.received.Add(float64(len(msg.Data)))
+		handler(msg)
+	}
+}
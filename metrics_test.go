@@ -0,0 +1,71 @@
+package absinthe_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	absinthe "github.com/RobertWHurst/Absinthe"
+	"github.com/RobertWHurst/Absinthe/absinthetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := absinthe.NewMetrics(nil)
+	cluster := absinthetest.NewCluster(t)
+	connect := func(name string) *absinthe.Client {
+		return cluster.Connect(name, absinthe.Version("1.0.0"), absinthe.UseMetrics(metrics))
+	}
+	gateway := connect("gateway")
+	service := connect("service")
+
+	assert.NoError(t, service.Get("/users/:id", func(c *absinthe.RESTContext) {
+		c.Write([]byte("user"))
+		c.End()
+	}))
+	assert.NoError(t, service.Route("purge", "/users/:id", func(c *absinthe.RESTContext) {
+		c.End()
+	}))
+	assert.NoError(t, service.Handle("user.$id.delete", func(c *absinthe.RPCContext) {
+		c.Error(errors.New("forbidden"))
+	}))
+
+	scrape := func() string {
+		recorder := httptest.NewRecorder()
+		metrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		body, _ := ioutil.ReadAll(recorder.Body)
+		return string(body)
+	}
+
+	cluster.WaitForREST(gateway, "GET", "/users/1")
+	cluster.WaitForRPC(gateway, "user.1.delete")
+	absinthetest.WaitFor(t, func() bool {
+		return strings.Contains(scrape(), `absinthe_indexer_known_rest_routes{peer="gateway",version="1.0.0"} 2`)
+	}, "an indexing round to find the routes of the service")
+
+	gateway.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/1", nil))
+	gateway.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/2", nil))
+	gateway.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PURGE", "/users/3", nil))
+	_, err := gateway.Call("user.1.delete", nil)
+	assert.EqualError(t, err, "forbidden")
+
+	text := scrape()
+
+	assert.Contains(t, text, `absinthe_dispatch_requests_total{kind="rest",method="GET",peer="service",route="/users/:id",version="1.0.0"} 2`)
+	assert.Contains(t, text, `absinthe_dispatch_duration_seconds_count{kind="rest",method="GET",peer="service",route="/users/:id",version="1.0.0"} 2`)
+	assert.Contains(t, text, `absinthe_handler_requests_total{kind="rest",method="GET",peer="service",route="/users/:id",version="1.0.0"} 2`)
+	assert.Contains(t, text, `absinthe_dispatch_requests_total{kind="rest",method="other",peer="service",route="/users/:id",version="1.0.0"} 1`)
+	assert.Contains(t, text, `absinthe_handler_requests_total{kind="rest",method="other",peer="service",route="/users/:id",version="1.0.0"} 1`)
+	assert.Contains(t, text, `absinthe_dispatch_errors_total{kind="rpc",method="",peer="service",route="user.$id.delete",version="1.0.0"} 1`)
+	assert.Contains(t, text, `absinthe_handler_errors_total{kind="rpc",method="",peer="service",route="user.$id.delete",version="1.0.0"} 1`)
+	assert.Contains(t, text, `absinthe_dispatch_in_flight{kind="rest"} 0`)
+	assert.Contains(t, text, `absinthe_indexer_known_peers{peer="gateway",version="1.0.0"} 1`)
+	assert.Contains(t, text, `absinthe_indexer_known_rest_routes{peer="gateway",version="1.0.0"} 2`)
+	assert.Regexp(t, regexp.MustCompile(`absinthe_transport_published_bytes_total\{peer="gateway",version="1.0.0"\} [1-9]`), text)
+	assert.Regexp(t, regexp.MustCompile(`absinthe_transport_received_bytes_total\{peer="service",version="1.0.0"\} [1-9]`), text)
+}
@@ -0,0 +1,71 @@
+package absinthe
+
+import (
+	"context"
+
+	"github.com/nats-io/go-nats"
+)
+
+// NATSTransport is the default Transport, sending messages through a nats
+// server
+type NATSTransport struct {
+	conn *nats.Conn
+}
+
+// NewNATSTransport connects to nats using the given options
+func NewNATSTransport(options nats.Options) (*NATSTransport, error) {
+	conn, err := options.Connect()
+	if err != nil {
+		return nil, err
+	}
+	return &NATSTransport{conn: conn}, nil
+}
+
+func (t *NATSTransport) IsConnected() bool {
+	return t.conn.IsConnected()
+}
+
+func (t *NATSTransport) Publish(subject string, data []byte) error {
+	return t.conn.Publish(subject, data)
+}
+
+func (t *NATSTransport) PublishRequest(subject, reply string, data []byte) error {
+	return t.conn.PublishRequest(subject, reply, data)
+}
+
+func (t *NATSTransport) Subscribe(subject string, handler MessageHandler) (Subscription, error) {
+	return t.conn.Subscribe(subject, natsMessageHandler(handler))
+}
+
+func (t *NATSTransport) QueueSubscribe(subject, queue string, handler MessageHandler) (Subscription, error) {
+	return t.conn.QueueSubscribe(subject, queue, natsMessageHandler(handler))
+}
+
+func (t *NATSTransport) Request(ctx context.Context, subject string, data []byte) ([]byte, error) {
+	msg, err := t.conn.RequestWithContext(ctx, subject, data)
+	if err == nats.ErrTimeout || err == context.DeadlineExceeded {
+		return nil, ErrTimeout
+	}
+	if err == nats.ErrConnectionClosed {
+		return nil, ErrTransportClosed
+	}
+	if err != nil {
+		return nil, err
+	}
+	return msg.Data, nil
+}
+
+func (t *NATSTransport) Close() error {
+	t.conn.Close()
+	return nil
+}
+
+func natsMessageHandler(handler MessageHandler) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		handler(&Message{
+			Subject: msg.Subject,
+			Reply:   msg.Reply,
+			Data:    msg.Data,
+		})
+	}
+}
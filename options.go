@@ -1,13 +1,17 @@
 package absinthe
 
 import (
+	"crypto/ed25519"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
 	"io/ioutil"
+	"log/slog"
 	"time"
 
 	"github.com/coreos/go-semver/semver"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 
 	nats "github.com/nats-io/go-nats"
 )
@@ -32,6 +36,65 @@ type Options struct {
 	// messages
 	Namespace string
 
+	// RequestTimeout is the maximum amount of time to wait for a peer to respond
+	// to a dispatched REST request or RPC call.
+	RequestTimeout time.Duration
+
+	// IdentityKey is the secret used to sign identities forwarded by gateways and
+	// to verify them on services. It must be shared by every peer trusting
+	// forwarded identities.
+	IdentityKey []byte
+
+	// SigningKey is used to sign the announcements of this client so other
+	// peers can verify where its routes and patterns come from.
+	SigningKey ed25519.PrivateKey
+
+	// TrustedKeys is the set of public keys announcements must be signed with.
+	// If empty, announcements are accepted without verification.
+	TrustedKeys []ed25519.PublicKey
+
+	// EncryptPayloads enables end-to-end encryption of request and response
+	// payloads. Each client generates a key pair on connect and advertises the
+	// public key with its peer. Plaintext payloads are refused. Keys are taken
+	// from announcements, so TrustedKeys must also be set, otherwise any peer
+	// on the bus could advertise a substitute key.
+	EncryptPayloads bool
+
+	// Transport is used to move messages between peers. If nil, a nats
+	// connection is made using the nats options below.
+	Transport Transport
+
+	// Logger receives the internal logs of the client, such as rejected
+	// announcements and failed dispatches. If nil, nothing is logged.
+	Logger *slog.Logger
+
+	// TracerProvider is used to create the spans tracing requests through the
+	// client. If nil, the global tracer provider is used.
+	TracerProvider trace.TracerProvider
+
+	// Propagator is used to carry trace context between peers, and to read it
+	// from the headers of incoming HTTP requests. If nil, W3C trace context is
+	// used.
+	Propagator propagation.TextMapPropagator
+
+	// Metrics collects prometheus metrics from the client. If nil, no metrics
+	// are collected.
+	Metrics *Metrics
+
+	// Codec encodes and decodes the requests and responses of typed RPC
+	// handlers and calls. If nil, JSON is used.
+	Codec Codec
+
+	// Passive clients discover peers without announcing themselves, so they
+	// can dispatch requests and calls but are never dispatched to. Tools
+	// observing a namespace should be passive.
+	Passive bool
+
+	// RefuseConflictingPeers makes the indexer refuse peers advertising routes
+	// or patterns which overlap with those of a peer with a different name
+	// that started before them. Conflicts are reported either way.
+	RefuseConflictingPeers bool
+
 	// - Nats Options -
 
 	// Servers is a configured set of servers which this client
@@ -124,6 +187,10 @@ type Options struct {
 	// Token sets the token to be used when connecting to a server.
 	Token string
 
+	// UserCredentials is the path of a chained credentials file holding the
+	// user JWT and NKey seed to authenticate with.
+	UserCredentials string
+
 	// CustomDialer allows to specify a custom dialer (not necessarily
 	// a *net.Dialer).
 	CustomDialer nats.CustomDialer
@@ -134,11 +201,11 @@ type Option func(*Options) error
 // GetDefaultOptions returns the default options for absinthe clients
 func GetDefaultOptions() Options {
 	natsOptionDefaults := nats.GetDefaultOptions()
-	interval, _ := time.ParseDuration("5s")
 
 	return Options{
-		IndexingInterval: interval,
+		IndexingInterval: DefaultIndexerAnnouceInterval,
 		Namespace:        "absinthe",
+		RequestTimeout:   DefaultRequestTimeout,
 
 		Servers:             natsOptionDefaults.Servers,
 		NoRandomize:         natsOptionDefaults.NoRandomize,
@@ -205,6 +272,9 @@ func (o Options) getNatsOptions() nats.Options {
 	natsOptions.Password = o.Password
 	natsOptions.Token = o.Token
 	natsOptions.CustomDialer = o.CustomDialer
+	if o.UserCredentials != "" {
+		nats.UserCredentials(o.UserCredentials)(&natsOptions)
+	}
 
 	return natsOptions
 }
@@ -224,13 +294,149 @@ func Version(version string) Option {
 	}
 }
 
+// Namespace is an Option to set the namespace prefixed to all absinthe
+// subjects. Namespaces may nest, such as absinthe.team.env.
 func Namespace(namespace string) Option {
 	return func(o *Options) error {
+		if err := ValidateSubject(namespace); err != nil {
+			return err
+		}
 		o.Namespace = namespace
 		return nil
 	}
 }
 
+// IndexingInterval is an Option to set how often peers are discovered.
+func IndexingInterval(t time.Duration) Option {
+	return func(o *Options) error {
+		o.IndexingInterval = t
+		return nil
+	}
+}
+
+func RequestTimeout(t time.Duration) Option {
+	return func(o *Options) error {
+		o.RequestTimeout = t
+		return nil
+	}
+}
+
+// IdentityKey is an Option to set the secret used to sign and verify forwarded
+// identities.
+func IdentityKey(key []byte) Option {
+	return func(o *Options) error {
+		o.IdentityKey = key
+		return nil
+	}
+}
+
+// SigningKey is an Option to set the key announcements are signed with.
+func SigningKey(key ed25519.PrivateKey) Option {
+	return func(o *Options) error {
+		if len(key) != ed25519.PrivateKeySize {
+			return fmt.Errorf("absinthe: signing key must be %d bytes", ed25519.PrivateKeySize)
+		}
+		o.SigningKey = key
+		return nil
+	}
+}
+
+// TrustedKeys is an Option to add keys to the set announcements must be
+// signed with.
+func TrustedKeys(keys ...ed25519.PublicKey) Option {
+	return func(o *Options) error {
+		for _, key := range keys {
+			if len(key) != ed25519.PublicKeySize {
+				return fmt.Errorf("absinthe: trusted keys must be %d bytes", ed25519.PublicKeySize)
+			}
+		}
+		o.TrustedKeys = append(o.TrustedKeys, keys...)
+		return nil
+	}
+}
+
+// EncryptPayloads is an Option to enable end-to-end payload encryption. It
+// must be combined with TrustedKeys so encryption keys are only accepted from
+// signed announcements.
+func EncryptPayloads() Option {
+	return func(o *Options) error {
+		o.EncryptPayloads = true
+		return nil
+	}
+}
+
+// UseTransport is an Option to send messages through the given Transport
+// instead of nats.
+func UseTransport(transport Transport) Option {
+	return func(o *Options) error {
+		o.Transport = transport
+		return nil
+	}
+}
+
+// Logger is an Option to set the logger the client writes its internal logs
+// to.
+func Logger(logger *slog.Logger) Option {
+	return func(o *Options) error {
+		o.Logger = logger
+		return nil
+	}
+}
+
+// TracerProvider is an Option to set the tracer provider spans are created
+// with.
+func TracerProvider(tracerProvider trace.TracerProvider) Option {
+	return func(o *Options) error {
+		o.TracerProvider = tracerProvider
+		return nil
+	}
+}
+
+// Propagator is an Option to set the propagator used to carry trace context.
+func Propagator(propagator propagation.TextMapPropagator) Option {
+	return func(o *Options) error {
+		o.Propagator = propagator
+		return nil
+	}
+}
+
+// UseMetrics is an Option to collect prometheus metrics from the client. The
+// same Metrics may be shared by several clients.
+func UseMetrics(metrics *Metrics) Option {
+	return func(o *Options) error {
+		o.Metrics = metrics
+		return nil
+	}
+}
+
+// UseCodec is an Option to set the codec typed RPC handlers and calls encode
+// their requests and responses with. Every peer exchanging typed calls must
+// use the same codec.
+func UseCodec(codec Codec) Option {
+	return func(o *Options) error {
+		o.Codec = codec
+		return nil
+	}
+}
+
+// Passive is an Option making the client discover peers without announcing
+// itself
+func Passive() Option {
+	return func(o *Options) error {
+		o.Passive = true
+		return nil
+	}
+}
+
+// RefuseConflictingPeers is an Option making the indexer refuse the later of
+// two peers with different names advertising overlapping routes or patterns
+func RefuseConflictingPeers() Option {
+	return func(o *Options) error {
+		o.RefuseConflictingPeers = true
+		return nil
+	}
+}
+
 func DontRandomize() Option {
 	return func(o *Options) error {
 		o.NoRandomize = true
@@ -378,6 +584,15 @@ func Token(token string) Option {
 	}
 }
 
+// UserCredentials is an Option to authenticate with the user JWT and NKey seed
+// in a chained credentials file
+func UserCredentials(file string) Option {
+	return func(o *Options) error {
+		o.UserCredentials = file
+		return nil
+	}
+}
+
 func SetCustomDialer(dialer nats.CustomDialer) Option {
 	return func(o *Options) error {
 		o.CustomDialer = dialer
@@ -386,3 +601,7 @@ func SetCustomDialer(dialer nats.CustomDialer) Option {
 }
 
 const DefaultURL = nats.DefaultURL
+
+// DefaultRequestTimeout is the default amount of time to wait for a peer to
+// respond to a dispatched request
+const DefaultRequestTimeout = 10 * time.Second
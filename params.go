@@ -0,0 +1,44 @@
+package absinthe
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Params are the values captured from a path by the params of the route or
+// pattern matching it
+type Params map[string]string
+
+// Int returns the value of a param as an int. It returns an error if the param
+// is absent, as an optional param may be, or is not an integer.
+func (p Params) Int(key string) (int, error) {
+	value, ok := p[key]
+	if !ok {
+		return 0, fmt.Errorf("absinthe: no param %s", key)
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("absinthe: param %s is not an integer: %v", key, err)
+	}
+	return n, nil
+}
+
+// Float returns the value of a param as a float64. It returns an error if the
+// param is absent or is not a number.
+func (p Params) Float(key string) (float64, error) {
+	value, ok := p[key]
+	if !ok {
+		return 0, fmt.Errorf("absinthe: no param %s", key)
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("absinthe: param %s is not a number: %v", key, err)
+	}
+	return n, nil
+}
+
+// Has reports whether a param is present
+func (p Params) Has(key string) bool {
+	_, ok := p[key]
+	return ok
+}
@@ -19,6 +19,15 @@ type Peer struct {
 	Name        string
 	RPCPatterns map[string]RPCPattern
 	RESTRoutes  map[string]RESTRoute
+
+	// EncryptionKey is the X25519 public key other peers use to encrypt the
+	// payloads they send to this peer. It is empty if the peer does not accept
+	// encrypted payloads.
+	EncryptionKey []byte
+
+	// Health is the result of the last health check of the peer made by this
+	// client. It is nil if the peer has not been checked.
+	Health *Health
 }
 
 func NewPeer(name string, version *semver.Version, id string) (*Peer, error) {
@@ -59,19 +68,43 @@ func (p *Peer) AddRESTRoute(route RESTRoute) {
 }
 
 func (p *Peer) HasRPCHandlerFor(path string) bool {
-	for _, knownPattern := range p.RPCPatterns {
-		if knownPattern.Match(path) {
-			return true
+	_, ok := p.FindRPCPattern(path)
+	return ok
+}
+
+func (p *Peer) HasRestHandlerFor(method, path string) bool {
+	_, ok := p.FindRESTRoute(method, path)
+	return ok
+}
+
+// FindRPCPattern returns the pattern advertised by the peer matching the given
+// rpc path. If several match, the one taking precedence is returned.
+func (p *Peer) FindRPCPattern(path string) (RPCPattern, bool) {
+	var matched *RPCPattern
+	for key := range p.RPCPatterns {
+		knownPattern := p.RPCPatterns[key]
+		if knownPattern.Match(path) && (matched == nil || knownPattern.Precedes(matched)) {
+			matched = &knownPattern
 		}
 	}
-	return false
+	if matched == nil {
+		return RPCPattern{}, false
+	}
+	return *matched, true
 }
 
-func (p *Peer) HasRestHandlerFor(method, path string) bool {
-	for _, knownRoute := range p.RESTRoutes {
-		if knownRoute.Match(method, path) {
-			return true
+// FindRESTRoute returns the route advertised by the peer matching the given
+// method and path. If several match, the one taking precedence is returned.
+func (p *Peer) FindRESTRoute(method, path string) (RESTRoute, bool) {
+	var matched *RESTRoute
+	for key := range p.RESTRoutes {
+		knownRoute := p.RESTRoutes[key]
+		if knownRoute.Match(method, path) && (matched == nil || knownRoute.Precedes(matched)) {
+			matched = &knownRoute
 		}
 	}
-	return false
+	if matched == nil {
+		return RESTRoute{}, false
+	}
+	return *matched, true
 }
@@ -0,0 +1,206 @@
+package absinthe
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ErrUnauthenticated is returned when a policy is attached to a route but the
+// request carries no identity
+var ErrUnauthenticated = errors.New("absinthe: authentication required")
+
+// ErrForbidden is returned when the identity of a request does not satisfy a
+// policy attached to the route
+var ErrForbidden = errors.New("absinthe: forbidden")
+
+// Policy describes who may call a route. Policies are advertised along with
+// the routes and patterns they are attached to, so gateways and callers can
+// enforce them before a request is forwarded. An empty Policy only requires
+// the caller to be authenticated.
+type Policy struct {
+	// Roles lists roles of which the caller must have at least one. Roles are
+	// read from the roles claim of the identity.
+	Roles []string
+
+	// Scopes lists scopes the caller must have all of. Scopes are read from the
+	// space delimited scope claim, or the scp claim, of the identity.
+	Scopes []string
+
+	// Claims maps claim names to the value they must have
+	Claims map[string]string
+
+	// ParamClaims maps param names to the claim their value must equal, such as
+	// requiring the :userID param to match the sub claim
+	ParamClaims map[string]string
+}
+
+// RequireRoles returns a Policy requiring the caller to have one of the given
+// roles
+func RequireRoles(roles ...string) Policy {
+	return Policy{Roles: roles}
+}
+
+// RequireScopes returns a Policy requiring the caller to have all of the given
+// scopes
+func RequireScopes(scopes ...string) Policy {
+	return Policy{Scopes: scopes}
+}
+
+// RequireClaim returns a Policy requiring a claim of the caller to have the
+// given value
+func RequireClaim(name, value string) Policy {
+	return Policy{Claims: map[string]string{name: value}}
+}
+
+// RequireParamClaim returns a Policy requiring a param to equal a claim of the
+// caller
+func RequireParamClaim(param, claim string) Policy {
+	return Policy{ParamClaims: map[string]string{param: claim}}
+}
+
+// Allows reports whether the policy is satisfied by the given identity and
+// route params
+func (p Policy) Allows(identity *Identity, params map[string]string) bool {
+	if identity == nil {
+		return false
+	}
+
+	if len(p.Roles) != 0 {
+		roles := identityClaimStrings(identity, "roles")
+		found := false
+		for _, role := range p.Roles {
+			if containsString(roles, role) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(p.Scopes) != 0 {
+		scopes := identityClaimStrings(identity, "scope")
+		if len(scopes) == 0 {
+			scopes = identityClaimStrings(identity, "scp")
+		}
+		for _, scope := range p.Scopes {
+			if !containsString(scopes, scope) {
+				return false
+			}
+		}
+	}
+
+	for name, value := range p.Claims {
+		if identityClaimString(identity, name) != value {
+			return false
+		}
+	}
+
+	for param, claim := range p.ParamClaims {
+		value, ok := params[param]
+		if !ok || identityClaimString(identity, claim) != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p Policy) String() string {
+	parts := make([]string, 0)
+	if len(p.Roles) != 0 {
+		parts = append(parts, "roles="+strings.Join(p.Roles, "|"))
+	}
+	if len(p.Scopes) != 0 {
+		parts = append(parts, "scopes="+strings.Join(p.Scopes, ","))
+	}
+	for _, name := range sortedKeys(p.Claims) {
+		parts = append(parts, fmt.Sprintf("claim(%s)=%s", name, p.Claims[name]))
+	}
+	for _, param := range sortedKeys(p.ParamClaims) {
+		parts = append(parts, fmt.Sprintf("param(%s)=claim(%s)", param, p.ParamClaims[param]))
+	}
+	if len(parts) == 0 {
+		return "Policy(authenticated)"
+	}
+	return "Policy(" + strings.Join(parts, " ") + ")"
+}
+
+// authorize checks each policy against the identity and params. It returns
+// ErrUnauthenticated if there is no identity, and ErrForbidden if any policy
+// is not satisfied.
+func authorize(policies []Policy, identity *Identity, params map[string]string) error {
+	if len(policies) == 0 {
+		return nil
+	}
+	if identity == nil {
+		return ErrUnauthenticated
+	}
+	for _, policy := range policies {
+		if !policy.Allows(identity, params) {
+			return ErrForbidden
+		}
+	}
+	return nil
+}
+
+func authorizationStatus(err error) int {
+	if err == ErrUnauthenticated {
+		return http.StatusUnauthorized
+	}
+	return http.StatusForbidden
+}
+
+func identityClaimString(identity *Identity, name string) string {
+	if name == "sub" && len(identity.Subject) != 0 {
+		return identity.Subject
+	}
+	value, ok := identity.Claims[name]
+	if !ok || value == nil {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(value)
+}
+
+func identityClaimStrings(identity *Identity, name string) []string {
+	switch value := identity.Claims[name].(type) {
+	case string:
+		return strings.Fields(value)
+	case []string:
+		return value
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
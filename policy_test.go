@@ -0,0 +1,52 @@
+package absinthe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var policyIdentity = &Identity{
+	Subject: "user-1",
+	Method:  "jwt",
+	Claims: map[string]interface{}{
+		"sub":    "user-1",
+		"roles":  []interface{}{"editor", "viewer"},
+		"scope":  "users:read users:write",
+		"tenant": "acme",
+		"level":  float64(3),
+	},
+}
+
+var policiesAndResults = map[string]struct {
+	policy  Policy
+	params  map[string]string
+	allowed bool
+}{
+	"authenticated":        {Policy{}, nil, true},
+	"one of roles":         {RequireRoles("admin", "editor"), nil, true},
+	"missing role":         {RequireRoles("admin"), nil, false},
+	"all scopes":           {RequireScopes("users:read", "users:write"), nil, true},
+	"missing scope":        {RequireScopes("users:read", "users:delete"), nil, false},
+	"claim":                {RequireClaim("tenant", "acme"), nil, true},
+	"numeric claim":        {RequireClaim("level", "3"), nil, true},
+	"wrong claim":          {RequireClaim("tenant", "other"), nil, false},
+	"param matches claim":  {RequireParamClaim("userID", "sub"), map[string]string{"userID": "user-1"}, true},
+	"param differs":        {RequireParamClaim("userID", "sub"), map[string]string{"userID": "user-2"}, false},
+	"param missing":        {RequireParamClaim("userID", "sub"), map[string]string{}, false},
+	"combined requirement": {Policy{Roles: []string{"viewer"}, Scopes: []string{"users:read"}}, nil, true},
+}
+
+func TestPolicyAllows(t *testing.T) {
+	for name, c := range policiesAndResults {
+		assert.Equal(t, c.allowed, c.policy.Allows(policyIdentity, c.params), "policy %s (%s)", name, c.policy)
+		assert.False(t, c.policy.Allows(nil, c.params), "policy %s should not allow a missing identity", name)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	assert.NoError(t, authorize(nil, nil, nil))
+	assert.Equal(t, ErrUnauthenticated, authorize([]Policy{{}}, nil, nil))
+	assert.Equal(t, ErrForbidden, authorize([]Policy{{}, RequireRoles("admin")}, policyIdentity, nil))
+	assert.NoError(t, authorize([]Policy{{}, RequireRoles("viewer")}, policyIdentity, nil))
+}
@@ -0,0 +1,127 @@
+package absinthe
+
+import (
+	"sort"
+	"strings"
+)
+
+// Chunk ranks used to order routes by precedence. Spanning chunks are rest
+// chunks, and those with sub-patterns able to match across separators.
+const (
+	chunkRankSpanning = iota
+	chunkRankOptional
+	chunkRankWildCard
+	chunkRankConstrainedWildCard
+	chunkRankParam
+	chunkRankConstrainedParam
+	chunkRankAlternation
+	chunkRankStatic
+)
+
+// Precedes reports whether the route takes precedence over other when both
+// match a request. Routes are compared chunk by chunk from the left, where a
+// static chunk precedes a :param with a sub-pattern or type, which precedes a
+// :param, which precedes a * with a sub-pattern or type, which precedes a *,
+// which precedes an optional chunk, which precedes a rest chunk. If all shared
+// chunks rank the same, the longer route precedes the shorter one, a route
+// matching only whole paths precedes one ending in +, and a route for a
+// single method precedes one for all methods. Remaining ties are broken by
+// pattern source so the order never depends on iteration order.
+func (r *RESTRoute) Precedes(other *RESTRoute) bool {
+	return compareRESTRoutes(r, other) < 0
+}
+
+// Precedes reports whether the pattern takes precedence over other when both
+// match a path. Patterns are ordered the same way as REST routes, with $name
+// and $ in place of :param and *, and tails in place of rest chunks.
+// Alternations precede params, but not static chunks.
+func (p *RPCPattern) Precedes(other *RPCPattern) bool {
+	return compareRPCPatterns(p, other) < 0
+}
+
+// SortRESTRoutes sorts routes so each precedes those after it
+func SortRESTRoutes(routes []RESTRoute) {
+	sort.SliceStable(routes, func(a, b int) bool {
+		return compareRESTRoutes(&routes[a], &routes[b]) < 0
+	})
+}
+
+// SortRPCPatterns sorts patterns so each precedes those after it
+func SortRPCPatterns(patterns []RPCPattern) {
+	sort.SliceStable(patterns, func(a, b int) bool {
+		return compareRPCPatterns(&patterns[a], &patterns[b]) < 0
+	})
+}
+
+// compareRESTRoutes returns a negative number if a precedes b, a positive
+// number if b precedes a, and zero if they are the same route
+func compareRESTRoutes(a, b *RESTRoute) int {
+	if c := compareChunks(a.routeChunks(), b.routeChunks()); c != 0 {
+		return c
+	}
+	if c := compareBool(a.terminated, b.terminated); c != 0 {
+		return c
+	}
+	if c := compareBool(a.Method != "all", b.Method != "all"); c != 0 {
+		return c
+	}
+	if c := strings.Compare(a.PatternSrc, b.PatternSrc); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Method, b.Method)
+}
+
+func compareRPCPatterns(a, b *RPCPattern) int {
+	if c := compareChunks(a.routeChunks(), b.routeChunks()); c != 0 {
+		return c
+	}
+	return strings.Compare(a.PatternSrc, b.PatternSrc)
+}
+
+// compareChunks orders chunks by the rank of their first differing chunk, then
+// longer chunks first. A route whose extra chunks may all be absent from a
+// path only matches the paths of the shorter route by leaving them out, so the
+// shorter route, matching those paths exactly, comes first.
+func compareChunks(a, b []routeChunk) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].rank != b[i].rank {
+			return b[i].rank - a[i].rank
+		}
+	}
+	switch {
+	case len(a) > len(b):
+		if omittable(a[len(b):]) {
+			return 1
+		}
+		return -1
+	case len(a) < len(b):
+		if omittable(b[len(a):]) {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// omittable reports whether every chunk may be absent from a path, as optional
+// chunks and rest chunks without a sub-pattern may
+func omittable(chunks []routeChunk) bool {
+	for _, chunk := range chunks {
+		if !chunk.optional && !(chunk.rest && chunk.pattern == nil) {
+			return false
+		}
+	}
+	return true
+}
+
+// compareBool orders true before false
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return -1
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,206 @@
+package absinthe
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// restRoutePrecedences maps the method and pattern of REST routes to those of
+// the routes they precede
+var restRoutePrecedences = map[string][]string{
+	"get /users/me": []string{
+		"get /users/:id",
+		"get /users/*",
+	},
+	"get /users/:id": []string{
+		"get /users/*",
+		"get /users/:id+",
+		"all /users/:id",
+		"get /users/:userID",
+	},
+	"get /users/:id(\\d+)": []string{
+		"get /users/:id",
+	},
+	"get /users/*(\\d+)": []string{
+		"get /users/*",
+	},
+	"get /users/*": []string{
+		"get /users/*(.*)",
+		"get /users/:id?",
+	},
+	"get /users/:id/posts": []string{
+		"get /users/:id",
+		"get /users/:id+",
+	},
+	"get /users/:id/*": []string{
+		"get /:resource/me",
+	},
+	"get /users": []string{
+		"get /*(.*)",
+		"get /users/:path*",
+	},
+	"get /static": []string{
+		"get /static/**",
+	},
+	"get /files": []string{
+		"get /files/:name?",
+	},
+	"delete /users/:id": []string{
+		"get /users/:id",
+	},
+	"get /users/:id<int>": []string{
+		"get /users/:id",
+	},
+	"get /users/:id?": []string{
+		"get /users/**",
+	},
+	"get /static/:path*": []string{
+		"get /:path*",
+	},
+}
+
+// rpcPatternPrecedences maps RPC patterns to the patterns they precede
+var rpcPatternPrecedences = map[string][]string{
+	"user.me.get": []string{
+		"user.$id.get",
+		"user.$.get",
+	},
+	"user.$id.get": []string{
+		"user.$.get",
+		"user.$id",
+		"$.me.get",
+		"user.$userID.get",
+	},
+	"user.$id(\\d+).get": []string{
+		"user.$id.get",
+	},
+	"user.$": []string{
+		"$([\\w\\x2e]+)",
+	},
+	"user.create": []string{
+		"user.{create,update}",
+	},
+	"user.{create,update}": []string{
+		"user.$action",
+	},
+	"user.$action{create,update}": []string{
+		"user.$action",
+	},
+	"events.user.$": []string{
+		"events.>",
+	},
+	"events.user.>": []string{
+		"events.>",
+	},
+	"events.$": []string{
+		"events.$$topic",
+	},
+}
+
+func TestRESTRoutePrecedes(t *testing.T) {
+	newRoute := func(t *testing.T, methodAndPattern string) *RESTRoute {
+		parts := strings.SplitN(methodAndPattern, " ", 2)
+		route, err := NewRESTRoute(parts[0], parts[1])
+		assert.NoError(t, err)
+		return route
+	}
+
+	for aSrc, bSrcs := range restRoutePrecedences {
+		for _, bSrc := range bSrcs {
+			t.Run(aSrc+" "+bSrc, func(t *testing.T) {
+				a := newRoute(t, aSrc)
+				b := newRoute(t, bSrc)
+				assert.True(t, a.Precedes(b), "%s should precede %s", aSrc, bSrc)
+				assert.False(t, b.Precedes(a), "%s should not precede %s", bSrc, aSrc)
+				assert.False(t, a.Precedes(a))
+			})
+		}
+	}
+}
+
+func TestRPCPatternPrecedes(t *testing.T) {
+	for aSrc, bSrcs := range rpcPatternPrecedences {
+		for _, bSrc := range bSrcs {
+			t.Run(aSrc+" "+bSrc, func(t *testing.T) {
+				a, err := NewRPCPattern(aSrc)
+				assert.NoError(t, err)
+				b, err := NewRPCPattern(bSrc)
+				assert.NoError(t, err)
+				assert.True(t, a.Precedes(b), "%s should precede %s", aSrc, bSrc)
+				assert.False(t, b.Precedes(a), "%s should not precede %s", bSrc, aSrc)
+				assert.False(t, a.Precedes(a))
+			})
+		}
+	}
+}
+
+func TestSortRESTRoutes(t *testing.T) {
+	routes := make([]RESTRoute, 0)
+	for _, pattern := range []string{"/*(.*)", "/users/*", "/users/:id", "/users/me", "/users/:id/posts", "/users+"} {
+		route, err := NewRESTRoute("get", pattern)
+		assert.NoError(t, err)
+		routes = append(routes, *route)
+	}
+	SortRESTRoutes(routes)
+
+	patterns := make([]string, 0, len(routes))
+	for _, route := range routes {
+		patterns = append(patterns, route.PatternSrc)
+	}
+	assert.Equal(t, []string{"/users/me", "/users/:id/posts", "/users/:id", "/users/*", "/users", "/*(.*)"}, patterns)
+}
+
+func TestFindMostSpecificRoute(t *testing.T) {
+	newPeer := func(id, name string, restPatterns, rpcPatterns []string) Peer {
+		peer := Peer{ID: id, Name: name, RESTRoutes: make(map[string]RESTRoute), RPCPatterns: make(map[string]RPCPattern)}
+		for _, pattern := range restPatterns {
+			route, err := NewRESTRoute("get", pattern)
+			assert.NoError(t, err)
+			peer.AddRESTRoute(*route)
+		}
+		for _, pattern := range rpcPatterns {
+			rpcPattern, err := NewRPCPattern(pattern)
+			assert.NoError(t, err)
+			peer.AddRPCPattern(*rpcPattern)
+		}
+		return peer
+	}
+	indexer := NewIndexer(nil)
+	indexer.setKnownPeer(newPeer("1", "catchall", []string{"/*(.*)", "/users/*"}, []string{"$([\\w\\x2e]+)"}))
+	indexer.setKnownPeer(newPeer("2", "users", []string{"/users/:id", "/users/:id/posts+"}, []string{"user.$id.get"}))
+	indexer.setKnownPeer(newPeer("3", "me", []string{"/users/me"}, []string{"user.me.get"}))
+
+	testCases := []struct {
+		path, peerID, pattern string
+	}{
+		{"/users/me", "3", "/users/me"},
+		{"/users/42", "2", "/users/:id"},
+		{"/users/42/posts/1", "2", "/users/:id/posts"},
+		{"/accounts/42", "1", "/*(.*)"},
+		{"user.me.get", "3", "user.me.get"},
+		{"user.42.get", "2", "user.$id.get"},
+		{"account.42.get", "1", "$([\\w\\x2e]+)"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.path, func(t *testing.T) {
+			// Repeat the lookup so a result depending on map iteration order
+			// is caught
+			for i := 0; i < 20; i++ {
+				if testCase.path[0] == '/' {
+					peer, route, ok := indexer.FindRESTPeer("get", testCase.path)
+					assert.True(t, ok)
+					assert.Equal(t, testCase.peerID, peer.ID)
+					assert.Equal(t, testCase.pattern, route.PatternSrc)
+				} else {
+					peer, pattern, ok := indexer.FindRPCPeer(testCase.path)
+					assert.True(t, ok)
+					assert.Equal(t, testCase.peerID, peer.ID)
+					assert.Equal(t, testCase.pattern, pattern.PatternSrc)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package absinthe
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// RateWindow is the window request rates are averaged over
+const RateWindow = time.Minute
+
+// RequestRate is the rate of requests dispatched or handled by a client for a
+// route or pattern, averaged over RateWindow
+type RequestRate struct {
+	Direction         string  `json:"direction"`
+	Kind              string  `json:"kind"`
+	Method            string  `json:"method,omitempty"`
+	Route             string  `json:"route"`
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	ErrorsPerSecond   float64 `json:"errorsPerSecond"`
+}
+
+type rateKey struct {
+	direction, kind, method, route string
+}
+
+// requestRates counts requests in one second buckets covering RateWindow
+type requestRates struct {
+	mu       sync.Mutex
+	counters map[rateKey]*rateCounter
+}
+
+type rateCounter struct {
+	seconds  [int(RateWindow / time.Second)]int64
+	requests [int(RateWindow / time.Second)]float64
+	errors   [int(RateWindow / time.Second)]float64
+}
+
+func (r *requestRates) add(direction, kind, method, route string, failed bool, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.counters == nil {
+		r.counters = make(map[rateKey]*rateCounter)
+	}
+	key := rateKey{direction, kind, method, route}
+	counter, ok := r.counters[key]
+	if !ok {
+		counter = &rateCounter{}
+		r.counters[key] = counter
+	}
+
+	second := now.Unix()
+	i := int(second % int64(len(counter.seconds)))
+	if counter.seconds[i] != second {
+		counter.seconds[i] = second
+		counter.requests[i] = 0
+		counter.errors[i] = 0
+	}
+	counter.requests[i]++
+	if failed {
+		counter.errors[i]++
+	}
+}
+
+func (r *requestRates) snapshot(now time.Time) []RequestRate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	windowSeconds := float64(RateWindow / time.Second)
+	oldest := now.Unix() - int64(windowSeconds)
+	rates := make([]RequestRate, 0, len(r.counters))
+	for key, counter := range r.counters {
+		rate := RequestRate{
+			Direction: key.direction,
+			Kind:      key.kind,
+			Method:    key.method,
+			Route:     key.route,
+		}
+		for i, second := range counter.seconds {
+			if second > oldest {
+				rate.RequestsPerSecond += counter.requests[i] / windowSeconds
+				rate.ErrorsPerSecond += counter.errors[i] / windowSeconds
+			}
+		}
+		if rate.RequestsPerSecond == 0 {
+			delete(r.counters, key)
+			continue
+		}
+		rates = append(rates, rate)
+	}
+	sort.Slice(rates, func(a, b int) bool {
+		if rates[a].Route != rates[b].Route {
+			return rates[a].Route < rates[b].Route
+		}
+		return rates[a].Direction+rates[a].Method < rates[b].Direction+rates[b].Method
+	})
+	return rates
+}
+
+// RequestRates returns the rates of requests dispatched and handled by the
+// client over the last RateWindow, by route
+func (c *Client) RequestRates() []RequestRate {
+	return c.rates.snapshot(time.Now())
+}
@@ -0,0 +1,351 @@
+package absinthe
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultIgnoredHeaders are headers which are expected to differ between a
+// recorded and a replayed response, and so are never compared
+var DefaultIgnoredHeaders = []string{"Date", RequestIDHeader}
+
+// ReplayOptions configure how recorded exchanges are replayed and compared
+type ReplayOptions struct {
+	// Routes selects the records to replay. Each is either a REST route, such
+	// as "GET /users/:id" or "/users/*" for any method, or an RPC pattern, such
+	// as "user.$id.get", and is matched against the URL or path of each record.
+	// If empty, every record is replayed.
+	Routes []string
+
+	// IgnoreFields are JSON body fields not compared, such as timestamps and
+	// IDs. Each is either a field name, matching the field at any depth, or a
+	// dotted path from the root of the body, such as user.createdAt.
+	IgnoreFields []string
+
+	// Headers are the response headers compared, in addition to the status,
+	// error, and body. DefaultIgnoredHeaders are never compared.
+	Headers []string
+}
+
+// ReplayDiff is a difference between a recorded and a replayed response. Path
+// is status, error, header.<name>, or body for the whole body, and
+// body.<path> for a JSON field.
+type ReplayDiff struct {
+	Path     string      `json:"path"`
+	Recorded interface{} `json:"recorded"`
+	Replayed interface{} `json:"replayed"`
+}
+
+func (d ReplayDiff) String() string {
+	recorded, _ := json.Marshal(d.Recorded)
+	replayed, _ := json.Marshal(d.Replayed)
+	return fmt.Sprintf("%s: %s -> %s", d.Path, recorded, replayed)
+}
+
+// ReplayResult is the outcome of replaying a recorded exchange
+type ReplayResult struct {
+	Record   TapRecord    `json:"record"`
+	Status   int          `json:"status"`
+	Error    string       `json:"error,omitempty"`
+	Response TapMessage   `json:"response"`
+	Diffs    []ReplayDiff `json:"diffs,omitempty"`
+}
+
+// Changed reports whether the replayed response differs from the recorded one
+func (r *ReplayResult) Changed() bool {
+	return len(r.Diffs) != 0
+}
+
+// ReadTapRecords reads records written by TapWriter
+func ReadTapRecords(r io.Reader) ([]TapRecord, error) {
+	records := make([]TapRecord, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		record := TapRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("absinthe: invalid tap record on line %d: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// Replay sends the recorded requests selected by options through the client
+// in order, and compares each response with the recorded one. REST requests
+// are dispatched as they would be by a gateway, so they are sent to whichever
+// peer the indexer of the client resolves. Headers and fields redacted when
+// recording are left out of the replayed requests, and are not compared. Records without a recorded
+// response, and records of sealed exchanges, are skipped.
+func (c *Client) Replay(ctx context.Context, records []TapRecord, options ReplayOptions) ([]ReplayResult, error) {
+	restRoutes, rpcPatterns, err := replaySelectors(options.Routes)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ReplayResult, 0)
+	for _, record := range records {
+		if record.Response == nil || record.Sealed || !replaySelected(record, restRoutes, rpcPatterns) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+
+		result := ReplayResult{Record: record}
+		switch record.Kind {
+		case RouteKindREST:
+			result.Status, result.Response = c.replayREST(ctx, record)
+		case RouteKindRPC:
+			data, err := c.CallWithContext(ctx, record.Path, replayBody(record.Request))
+			result.Status = http.StatusOK
+			if err == ErrTimeout {
+				result.Status = http.StatusGatewayTimeout
+				result.Error = err.Error()
+			} else if err != nil {
+				result.Status = http.StatusInternalServerError
+				result.Error = err.Error()
+			}
+			result.Response = newTapMessage(nil, data)
+		default:
+			continue
+		}
+		result.Diffs = diffReplay(record, result, options)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (c *Client) replayREST(ctx context.Context, record TapRecord) (int, TapMessage) {
+	req, err := http.NewRequestWithContext(ctx, record.Method, record.URL, bytes.NewReader(replayBody(record.Request)))
+	if err != nil {
+		return http.StatusBadRequest, newTapMessage(nil, []byte(err.Error()))
+	}
+	for name, values := range record.Request.Header {
+		for _, value := range values {
+			if value != Redacted {
+				req.Header.Add(name, value)
+			}
+		}
+	}
+	w := &replayResponseWriter{header: make(http.Header), status: http.StatusOK}
+	c.ServeHTTP(w, req)
+	return w.status, newTapMessage(w.header, w.body.Bytes())
+}
+
+// replayBody returns the body of a recorded request with the JSON fields
+// redacted when recording removed, so the placeholders are not sent in place
+// of the original values
+func replayBody(message TapMessage) []byte {
+	if message.Text || len(message.Body) == 0 {
+		return message.Bytes()
+	}
+	decoder := json.NewDecoder(bytes.NewReader(message.Body))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil || !removeRedacted(v) {
+		return message.Bytes()
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return message.Bytes()
+	}
+	return data
+}
+
+// removeRedacted removes the fields of objects within v whose value is
+// Redacted, and reports whether any were removed
+func removeRedacted(v interface{}) bool {
+	removed := false
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if value == Redacted {
+				delete(v, key)
+				removed = true
+			} else if removeRedacted(value) {
+				removed = true
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			if removeRedacted(value) {
+				removed = true
+			}
+		}
+	}
+	return removed
+}
+
+func replaySelectors(routes []string) ([]*RESTRoute, []*RPCPattern, error) {
+	restRoutes := make([]*RESTRoute, 0)
+	rpcPatterns := make([]*RPCPattern, 0)
+	for _, route := range routes {
+		method, pattern := "all", route
+		if i := strings.IndexByte(route, ' '); i != -1 {
+			method, pattern = route[:i], strings.TrimSpace(route[i+1:])
+		}
+		if strings.HasPrefix(pattern, "/") {
+			restRoute, err := NewRESTRoute(method, pattern)
+			if err != nil {
+				return nil, nil, err
+			}
+			restRoutes = append(restRoutes, restRoute)
+			continue
+		}
+		rpcPattern, err := NewRPCPattern(route)
+		if err != nil {
+			return nil, nil, err
+		}
+		rpcPatterns = append(rpcPatterns, rpcPattern)
+	}
+	return restRoutes, rpcPatterns, nil
+}
+
+func replaySelected(record TapRecord, restRoutes []*RESTRoute, rpcPatterns []*RPCPattern) bool {
+	if len(restRoutes) == 0 && len(rpcPatterns) == 0 {
+		return true
+	}
+	switch record.Kind {
+	case RouteKindREST:
+		path := record.URL
+		if u, err := url.ParseRequestURI(record.URL); err == nil {
+			path = u.Path
+		}
+		for _, route := range restRoutes {
+			if route.Match(record.Method, path) {
+				return true
+			}
+		}
+	case RouteKindRPC:
+		for _, pattern := range rpcPatterns {
+			if pattern.Match(record.Path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func diffReplay(record TapRecord, result ReplayResult, options ReplayOptions) []ReplayDiff {
+	diffs := make([]ReplayDiff, 0)
+	if record.Status != result.Status {
+		diffs = append(diffs, ReplayDiff{Path: "status", Recorded: record.Status, Replayed: result.Status})
+	}
+	if record.Error != result.Error {
+		diffs = append(diffs, ReplayDiff{Path: "error", Recorded: record.Error, Replayed: result.Error})
+	}
+	for _, name := range options.Headers {
+		name = http.CanonicalHeaderKey(name)
+		if containsString(DefaultIgnoredHeaders, name) {
+			continue
+		}
+		recorded := record.Response.Header.Get(name)
+		replayed := result.Response.Header.Get(name)
+		if recorded != replayed && recorded != Redacted {
+			diffs = append(diffs, ReplayDiff{Path: "header." + name, Recorded: recorded, Replayed: replayed})
+		}
+	}
+
+	var recordedBody, replayedBody interface{}
+	recordedErr := json.Unmarshal(record.Response.Body, &recordedBody)
+	replayedErr := json.Unmarshal(result.Response.Body, &replayedBody)
+	if record.Response.Text || result.Response.Text || recordedErr != nil || replayedErr != nil {
+		recordedText := string(record.Response.Bytes())
+		replayedText := string(result.Response.Bytes())
+		if recordedText != replayedText {
+			diffs = append(diffs, ReplayDiff{Path: "body", Recorded: recordedText, Replayed: replayedText})
+		}
+		return diffs
+	}
+	return append(diffs, diffJSON("body", "", recordedBody, replayedBody, options.IgnoreFields)...)
+}
+
+// diffJSON compares decoded JSON values, skipping ignored and redacted fields.
+// path is the path reported in diffs, and fieldPath is the dotted path of the
+// value from the root of the body.
+func diffJSON(path, fieldPath string, recorded, replayed interface{}, ignoreFields []string) []ReplayDiff {
+	if recorded == Redacted {
+		return nil
+	}
+	recordedObject, recordedIsObject := recorded.(map[string]interface{})
+	replayedObject, replayedIsObject := replayed.(map[string]interface{})
+	if recordedIsObject && replayedIsObject {
+		keys := make([]string, 0, len(recordedObject)+len(replayedObject))
+		for key := range recordedObject {
+			keys = append(keys, key)
+		}
+		for key := range replayedObject {
+			if _, ok := recordedObject[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		diffs := make([]ReplayDiff, 0)
+		for _, key := range keys {
+			keyPath := key
+			if fieldPath != "" {
+				keyPath = fieldPath + "." + key
+			}
+			if containsString(ignoreFields, key) || containsString(ignoreFields, keyPath) {
+				continue
+			}
+			diffs = append(diffs, diffJSON(path+"."+key, keyPath, recordedObject[key], replayedObject[key], ignoreFields)...)
+		}
+		return diffs
+	}
+
+	recordedArray, recordedIsArray := recorded.([]interface{})
+	replayedArray, replayedIsArray := replayed.([]interface{})
+	if recordedIsArray && replayedIsArray && len(recordedArray) == len(replayedArray) {
+		diffs := make([]ReplayDiff, 0)
+		for i := range recordedArray {
+			index := strconv.Itoa(i)
+			diffs = append(diffs, diffJSON(path+"."+index, fieldPath, recordedArray[i], replayedArray[i], ignoreFields)...)
+		}
+		return diffs
+	}
+
+	if !reflect.DeepEqual(recorded, replayed) {
+		return []ReplayDiff{{Path: path, Recorded: recorded, Replayed: replayed}}
+	}
+	return nil
+}
+
+// replayResponseWriter holds the response to a replayed REST request
+type replayResponseWriter struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *replayResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *replayResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+}
+
+func (w *replayResponseWriter) Write(data []byte) (int, error) {
+	w.wroteHeader = true
+	return w.body.Write(data)
+}
@@ -0,0 +1,158 @@
+package absinthe_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	absinthe "github.com/RobertWHurst/Absinthe"
+	"github.com/RobertWHurst/Absinthe/absinthetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	cluster := absinthetest.NewCluster(t)
+	connect := func(name, version string, options ...absinthe.Option) *absinthe.Client {
+		return cluster.Connect(name, append([]absinthe.Option{absinthe.Version(version)}, options...)...)
+	}
+	serve := func(client *absinthe.Client, name string, err error) {
+		assert.NoError(t, client.Get("/users/:id", func(c *absinthe.RESTContext) {
+			c.SetHeader("Content-Type", "application/json")
+			c.Write([]byte(`{"id":"` + c.Params["id"] + `","name":"` + name + `","createdAt":"` + time.Now().Format(time.RFC3339Nano) + `","token":"t"}`))
+			c.End()
+		}))
+		assert.NoError(t, client.Get("/health", func(c *absinthe.RESTContext) {
+			c.Write([]byte("ok"))
+			c.End()
+		}))
+		assert.NoError(t, client.Handle("user.$id.delete", func(c *absinthe.RPCContext) {
+			if err != nil {
+				c.Error(err)
+				return
+			}
+			c.Respond(c.Data)
+		}))
+	}
+	waitFor := func(client *absinthe.Client, peerName string) {
+		cluster.WaitForREST(client, "GET", "/users/1")
+		absinthetest.WaitFor(t, func() bool {
+			peer, _, ok := client.Indexer().FindRPCPeer("user.1.delete")
+			return ok && peer.Name == peerName
+		}, "%s to handle user.1.delete", peerName)
+	}
+
+	v1 := connect("users", "1.0.0")
+	serve(v1, "Ada", nil)
+	recorder := connect("recorder", "1.0.0", absinthe.Passive())
+	waitFor(recorder, "users")
+
+	recording := &bytes.Buffer{}
+	write := absinthe.TapWriter(recording)
+	written := &tapRecords{}
+	tap, err := recorder.Tap(absinthe.TapOptions{
+		Redactors: []absinthe.TapRedactor{absinthe.RedactFields("token")},
+	}, func(record absinthe.TapRecord) {
+		write(record)
+		written.add(record)
+	})
+	assert.NoError(t, err)
+
+	recorder.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/1", nil))
+	recorder.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+	_, err = recorder.Call("user.1.delete", []byte("reason"))
+	assert.NoError(t, err)
+	absinthetest.WaitFor(t, func() bool {
+		return len(written.get()) == 3
+	}, "tap records")
+	tap.Close()
+	v1.Close()
+
+	records, err := absinthe.ReadTapRecords(recording)
+	assert.NoError(t, err)
+	if !assert.Len(t, records, 3) {
+		return
+	}
+
+	v2 := connect("users-next", "2.0.0")
+	serve(v2, "Grace", errors.New("forbidden"))
+	replayer := connect("replayer", "1.0.0", absinthe.Passive())
+	waitFor(replayer, "users-next")
+
+	results, err := replayer.Replay(context.Background(), records, absinthe.ReplayOptions{
+		IgnoreFields: []string{"createdAt"},
+		Headers:      []string{"Content-Type", "Date"},
+	})
+	assert.NoError(t, err)
+	if !assert.Len(t, results, 3) {
+		return
+	}
+
+	assert.Equal(t, []absinthe.ReplayDiff{{Path: "body.name", Recorded: "Ada", Replayed: "Grace"}}, results[0].Diffs)
+	assert.Equal(t, `body.name: "Ada" -> "Grace"`, results[0].Diffs[0].String())
+	assert.False(t, results[1].Changed())
+	assert.Equal(t, []absinthe.ReplayDiff{
+		{Path: "status", Recorded: 200, Replayed: 500},
+		{Path: "error", Recorded: "", Replayed: "forbidden"},
+		{Path: "body", Recorded: "reason", Replayed: ""},
+	}, results[2].Diffs)
+
+	results, err = replayer.Replay(context.Background(), records, absinthe.ReplayOptions{
+		Routes:       []string{"GET /users/:id"},
+		IgnoreFields: []string{"createdAt", "name"},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.False(t, results[0].Changed())
+	}
+
+	results, err = replayer.Replay(context.Background(), records, absinthe.ReplayOptions{Routes: []string{"user.$.$"}})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "user.1.delete", results[0].Record.Path)
+	}
+}
+
+func TestReplayRedactedRequestFields(t *testing.T) {
+	cluster := absinthetest.NewCluster(t)
+	service := cluster.Connect("users")
+	recorder := cluster.Connect("recorder", absinthe.Passive())
+
+	received := make(chan string, 4)
+	assert.NoError(t, service.Post("/users", func(c *absinthe.RESTContext) {
+		received <- string(c.Body())
+		c.End()
+	}))
+	assert.NoError(t, service.Handle("user.login", func(c *absinthe.RPCContext) {
+		received <- string(c.Data)
+		c.Respond(nil)
+	}))
+	cluster.WaitForREST(recorder, "POST", "/users")
+	cluster.WaitForRPC(recorder, "user.login")
+
+	recording := &tapRecords{}
+	tap, err := recorder.Tap(absinthe.TapOptions{
+		Redactors: []absinthe.TapRedactor{absinthe.RedactFields("password")},
+	}, recording.add)
+	assert.NoError(t, err)
+	defer tap.Close()
+
+	body := `{"name":"ada","password":"hunter2","keys":[{"id":1,"password":"x"}]}`
+	recorder.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/users", strings.NewReader(body)))
+	_, err = recorder.Call("user.login", []byte(body))
+	assert.NoError(t, err)
+	assert.Equal(t, body, <-received)
+	assert.Equal(t, body, <-received)
+	absinthetest.WaitFor(t, func() bool {
+		return len(recording.get()) == 2
+	}, "tap records")
+
+	results, err := recorder.Replay(context.Background(), recording.get(), absinthe.ReplayOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.Equal(t, `{"keys":[{"id":1}],"name":"ada"}`, <-received)
+	assert.Equal(t, `{"keys":[{"id":1}],"name":"ada"}`, <-received)
+}
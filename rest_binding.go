@@ -0,0 +1,286 @@
+package absinthe
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// bindMaxMemory is the most bytes of a multipart body kept in memory by Bind,
+// the same as net/http uses for ParseMultipartForm
+const bindMaxMemory = 32 << 20
+
+// bindSources are the struct tags read by Bind, in the order they are bound.
+// Later sources overwrite fields set by earlier ones.
+var bindSources = []string{"form", "param", "query", "header"}
+
+var errRequired = errors.New("required")
+
+// Validator may be implemented by values passed to Bind to validate them once
+// they have been bound
+type Validator interface {
+	Validate() error
+}
+
+// BindError is returned by Bind when a request cannot be bound to a value,
+// because its body is malformed, a field cannot be parsed, a required field is
+// missing, or the value fails validation. RESTContext.Error answers it with
+// 400 Bad Request.
+type BindError struct {
+	// Source is where the field was bound from, one of body, form, param,
+	// query, or header, or request if the value failed validation
+	Source string
+
+	// Field is the name of the field in its source. It is empty if the error
+	// is not about a single field.
+	Field string
+
+	Err error
+}
+
+func (e *BindError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("absinthe: invalid %s: %v", e.Source, e.Err)
+	}
+	return fmt.Sprintf("absinthe: invalid %s %s: %v", e.Source, e.Field, e.Err)
+}
+
+func (e *BindError) Unwrap() error {
+	return e.Err
+}
+
+// Bind decodes the request into v, which should be a pointer to a struct. The
+// body is decoded according to its Content-Type. JSON bodies are unmarshalled
+// into v, and form and multipart bodies are bound to fields tagged with form.
+// Multipart files are bound to fields of type *multipart.FileHeader or
+// []*multipart.FileHeader, and can be opened until the response ends. Fields
+// tagged with param, query, or header are then bound from the params, query
+// string, and headers of the request.
+//
+//	type UpdateUser struct {
+//		ID    int    `param:"id"`
+//		Force bool   `query:"force"`
+//		Token string `header:"X-Token" validate:"required"`
+//		Name  string `json:"name" validate:"required"`
+//	}
+//
+// Fields tagged with validate:"required" must not be left empty, and if v
+// implements Validator it is validated last. Any failure is returned as a
+// *BindError.
+func (c *RESTContext) Bind(v interface{}) error {
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return fmt.Errorf("absinthe: cannot bind to non-pointer %T", v)
+	}
+
+	sourceValues := map[string]map[string][]string{
+		"param":  make(map[string][]string),
+		"query":  c.Query(),
+		"header": c.request.Header,
+	}
+	for key, value := range c.Params {
+		sourceValues["param"][key] = []string{value}
+	}
+	var files map[string][]*multipart.FileHeader
+
+	if len(c.request.Body) != 0 {
+		mediaType, mediaParams, err := mime.ParseMediaType(c.Header("Content-Type"))
+		if err != nil && c.Header("Content-Type") != "" {
+			return &BindError{Source: "body", Err: err}
+		}
+		switch {
+		case mediaType == "" || mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			if err := json.Unmarshal(c.request.Body, v); err != nil {
+				return &BindError{Source: "body", Err: err}
+			}
+		case mediaType == "application/x-www-form-urlencoded":
+			values, err := url.ParseQuery(string(c.request.Body))
+			if err != nil {
+				return &BindError{Source: "body", Err: err}
+			}
+			sourceValues["form"] = values
+		case mediaType == "multipart/form-data":
+			form, err := multipart.NewReader(bytes.NewReader(c.request.Body), mediaParams["boundary"]).ReadForm(bindMaxMemory)
+			if err != nil {
+				return &BindError{Source: "body", Err: err}
+			}
+			// Files spilled to disk must outlive Bind, so the handler can
+			// read them, and are removed once the response ends
+			c.onEnd(func() { form.RemoveAll() })
+			sourceValues["form"] = form.Value
+			files = form.File
+		default:
+			return &BindError{Source: "body", Err: fmt.Errorf("unsupported content type %s", mediaType)}
+		}
+	}
+
+	if target.Elem().Kind() == reflect.Struct {
+		if err := bindStruct(target.Elem(), sourceValues, files); err != nil {
+			return err
+		}
+	}
+
+	if validator, ok := v.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			var bindErr *BindError
+			if errors.As(err, &bindErr) {
+				return err
+			}
+			return &BindError{Source: "request", Err: err}
+		}
+	}
+	return nil
+}
+
+// bindStruct binds the tagged fields of a struct, including those of embedded
+// structs, and checks required fields
+func bindStruct(target reflect.Value, sourceValues map[string]map[string][]string, files map[string][]*multipart.FileHeader) error {
+	targetType := target.Type()
+	for i := 0; i < targetType.NumField(); i++ {
+		fieldType := targetType.Field(i)
+		field := target.Field(i)
+		if fieldType.Anonymous && fieldType.Type.Kind() == reflect.Struct {
+			if err := bindStruct(field, sourceValues, files); err != nil {
+				return err
+			}
+			continue
+		}
+		if !fieldType.IsExported() {
+			continue
+		}
+
+		for _, source := range bindSources {
+			name := bindTagName(fieldType.Tag.Get(source))
+			if name == "" {
+				continue
+			}
+			if source == "form" && bindFiles(field, files[name]) {
+				continue
+			}
+			values, ok := sourceValues[source][name]
+			if source == "header" {
+				values = http.Header(sourceValues[source]).Values(name)
+				ok = len(values) != 0
+			}
+			if !ok || len(values) == 0 {
+				continue
+			}
+			if err := bindField(field, values); err != nil {
+				return &BindError{Source: source, Field: name, Err: err}
+			}
+		}
+
+		if fieldType.Tag.Get("validate") == "required" && field.IsZero() {
+			source, name := "body", bindTagName(fieldType.Tag.Get("json"))
+			for _, tagSource := range bindSources {
+				if tagName := bindTagName(fieldType.Tag.Get(tagSource)); tagName != "" {
+					source, name = tagSource, tagName
+				}
+			}
+			if name == "" {
+				name = fieldType.Name
+			}
+			return &BindError{Source: source, Field: name, Err: errRequired}
+		}
+	}
+	return nil
+}
+
+// bindTagName returns the name given by a struct tag, ignoring its options
+func bindTagName(tag string) string {
+	name := strings.Split(tag, ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// bindFiles binds multipart files to a field if it is of a file type
+func bindFiles(field reflect.Value, files []*multipart.FileHeader) bool {
+	switch field.Interface().(type) {
+	case *multipart.FileHeader:
+		if len(files) != 0 {
+			field.Set(reflect.ValueOf(files[0]))
+		}
+		return true
+	case []*multipart.FileHeader:
+		if len(files) != 0 {
+			field.Set(reflect.ValueOf(files))
+		}
+		return true
+	}
+	return false
+}
+
+// bindField parses values into a field. Slices receive every value, and other
+// fields the first.
+func bindField(field reflect.Value, values []string) error {
+	if field.Kind() == reflect.Slice && !implementsTextUnmarshaler(field) {
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := bindValue(slice.Index(i), value); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+	return bindValue(field, values[0])
+}
+
+func implementsTextUnmarshaler(field reflect.Value) bool {
+	return field.CanAddr() && field.Addr().Type().Implements(reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem())
+}
+
+func bindValue(field reflect.Value, value string) error {
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			field.Set(reflect.New(field.Type().Elem()))
+		}
+		return bindValue(field.Elem(), value)
+	}
+	if implementsTextUnmarshaler(field) {
+		return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(n)
+	default:
+		return fmt.Errorf("cannot bind to field of type %s", field.Type())
+	}
+	return nil
+}
@@ -1,15 +1,174 @@
 package absinthe
 
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// RESTContext is passed to each RESTHandler. It carries the request being
+// handled and is used to build the response sent back to the gateway.
 type RESTContext struct {
-	URL    string
-	Method string
-	Params map[string]string
-	Next   func()
+	URL       string
+	Method    string
+	Params    Params
+	Identity  *Identity
+	RequestID string
+	Next      func()
+
+	ctx      context.Context
+	client   *Client
+	request  *RESTRequest
+	response *RESTResponse
+	route    *RESTRoute
+	path     string
+	query    url.Values
+	endOnce  sync.Once
+	endHooks []func()
+	done     chan struct{}
+}
+
+func newRESTContext(client *Client, request *RESTRequest) *RESTContext {
+	path := request.URL
+	query := make(url.Values)
+	if u, err := url.ParseRequestURI(request.URL); err == nil {
+		path = u.Path
+		query = u.Query()
+	}
+	return &RESTContext{
+		URL:       path,
+		Method:    request.Method,
+		Params:    make(Params),
+		RequestID: request.RequestID,
+		ctx:       context.Background(),
+		client:    client,
+		request:   request,
+		response: &RESTResponse{
+			Status: http.StatusOK,
+			Header: make(http.Header),
+		},
+		path:  path,
+		query: query,
+		done:  make(chan struct{}),
+	}
+}
+
+// Body returns the body of the request
+func (c *RESTContext) Body() []byte {
+	return c.request.Body
+}
+
+// Query returns the query string params of the request
+func (c *RESTContext) Query() url.Values {
+	return c.query
 }
 
+// Header returns the first value of a header of the request
+func (c *RESTContext) Header(name string) string {
+	return c.request.Header.Get(name)
+}
+
+// Cookie returns the named cookie sent with the request, or
+// http.ErrNoCookie if there is none
+func (c *RESTContext) Cookie(name string) (*http.Cookie, error) {
+	return (&http.Request{Header: c.request.Header}).Cookie(name)
+}
+
+// SetCookie adds a Set-Cookie header to the response. Invalid cookies are
+// dropped.
+func (c *RESTContext) SetCookie(cookie *http.Cookie) *RESTContext {
+	if value := cookie.String(); value != "" {
+		c.response.Header.Add("Set-Cookie", value)
+	}
+	return c
+}
+
+// Status sets the status code of the response
 func (c *RESTContext) Status(statusCode int) *RESTContext {
+	c.response.Status = statusCode
+	return c
+}
+
+// SetHeader sets a header on the response
+func (c *RESTContext) SetHeader(name, value string) *RESTContext {
+	c.response.Header.Set(name, value)
 	return c
 }
 
+// Write appends data to the response body
+func (c *RESTContext) Write(data []byte) (int, error) {
+	c.response.Body = append(c.response.Body, data...)
+	return len(data), nil
+}
+
+// End completes the response and sends it back to the gateway. Calling End
+// more than once has no effect.
 func (c *RESTContext) End() {
+	c.endOnce.Do(func() {
+		for _, hook := range c.endHooks {
+			hook()
+		}
+		close(c.done)
+	})
+}
+
+// Error ends the response with the status matching err. Errors from Bind are
+// answered with 400 Bad Request, ErrUnauthenticated and ErrForbidden with 401
+// and 403, and any other error with 500 Internal Server Error, whose body
+// does not include the message of the error.
+func (c *RESTContext) Error(err error) {
+	status := errorStatus(err)
+	message := err.Error()
+	if status == http.StatusInternalServerError {
+		message = http.StatusText(status)
+	}
+	c.Status(status).SetHeader("Content-Type", "text/plain; charset=utf-8")
+	c.response.Body = []byte(message)
+	c.End()
+}
+
+// errorStatus returns the HTTP status matching an error returned by a handler
+func errorStatus(err error) int {
+	var bindErr *BindError
+	switch {
+	case errors.As(err, &bindErr):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrUnauthenticated):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// onEnd registers a function called when the response ends, before it is
+// sent back to the gateway
+func (c *RESTContext) onEnd(hook func()) {
+	c.endHooks = append(c.endHooks, hook)
+}
+
+// Context returns the context of the request. It carries the trace context
+// of the caller, and the span the request is handled in.
+func (c *RESTContext) Context() context.Context {
+	return c.ctx
+}
+
+// Call makes an RPC call to another peer on behalf of the request, forwarding
+// the identity of the caller signed for the call
+func (c *RESTContext) Call(path string, data []byte) ([]byte, error) {
+	if c.client == nil {
+		return nil, ErrNoClient
+	}
+	return c.client.call(c.ctx, path, data, c.RequestID, c.Identity)
+}
+
+// Codec returns the codec of the client the context is attached to
+func (c *RESTContext) Codec() Codec {
+	if c.client == nil {
+		return JSONCodec{}
+	}
+	return c.client.Codec()
 }
@@ -0,0 +1,182 @@
+package absinthe
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRESTContextRequestAccessors(t *testing.T) {
+	router := NewRESTRouter()
+	assert.NoError(t, router.Get("/users/:id", func(c *RESTContext) {
+		assert.Equal(t, "true", c.Query().Get("full"))
+		assert.Equal(t, []string{"a", "b"}, c.Query()["tag"])
+		assert.Equal(t, "abc", c.Header("x-token"))
+
+		cookie, err := c.Cookie("session")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "s1", cookie.Value)
+		}
+		_, err = c.Cookie("missing")
+		assert.Equal(t, http.ErrNoCookie, err)
+
+		c.SetCookie(&http.Cookie{Name: "seen", Value: "1", Path: "/"})
+		c.SetCookie(&http.Cookie{Name: "bad name", Value: "1"})
+		c.End()
+	}))
+
+	req := httptest.NewRequest("GET", "/users/1?full=true&tag=a&tag=b", nil)
+	req.Header.Set("X-Token", "abc")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "s1"})
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, []string{"seen=1; Path=/"}, recorder.Header().Values("Set-Cookie"))
+}
+
+type bindTestRequest struct {
+	ID     int                   `param:"id"`
+	Force  bool                  `query:"force"`
+	Tags   []string              `query:"tag"`
+	Token  string                `header:"X-Token" validate:"required"`
+	Name   string                `json:"name" form:"name" validate:"required"`
+	Limit  *uint                 `query:"limit"`
+	Avatar *multipart.FileHeader `form:"avatar"`
+}
+
+func (r *bindTestRequest) Validate() error {
+	if r.Name == "root" {
+		return errors.New("name is reserved")
+	}
+	return nil
+}
+
+func multipartBody(t *testing.T) (string, []byte) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	assert.NoError(t, writer.WriteField("name", "ada"))
+	file, err := writer.CreateFormFile("avatar", "ada.png")
+	assert.NoError(t, err)
+	_, err = file.Write([]byte("png"))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	return writer.FormDataContentType(), body.Bytes()
+}
+
+func TestRESTContextBind(t *testing.T) {
+	multipartType, multipartData := multipartBody(t)
+	limit := uint(10)
+
+	testCases := []struct {
+		name        string
+		url         string
+		token       string
+		contentType string
+		body        []byte
+		status      int
+		expected    bindTestRequest
+	}{
+		{"json", "/users/7?force=true&tag=a&tag=b", "abc", "application/json", []byte(`{"name":"ada"}`), http.StatusOK,
+			bindTestRequest{ID: 7, Force: true, Tags: []string{"a", "b"}, Token: "abc", Name: "ada"}},
+		{"json without content type", "/users/7?limit=10", "abc", "", []byte(`{"name":"ada"}`), http.StatusOK,
+			bindTestRequest{ID: 7, Token: "abc", Name: "ada", Limit: &limit}},
+		{"form", "/users/7", "abc", "application/x-www-form-urlencoded", []byte("name=ada"), http.StatusOK,
+			bindTestRequest{ID: 7, Token: "abc", Name: "ada"}},
+		{"multipart", "/users/7", "abc", multipartType, multipartData, http.StatusOK,
+			bindTestRequest{ID: 7, Token: "abc", Name: "ada"}},
+		{"malformed json", "/users/7", "abc", "application/json", []byte(`{"name":`), http.StatusBadRequest, bindTestRequest{}},
+		{"malformed query", "/users/7?force=maybe", "abc", "application/json", []byte(`{"name":"ada"}`), http.StatusBadRequest, bindTestRequest{}},
+		{"missing header", "/users/7", "", "application/json", []byte(`{"name":"ada"}`), http.StatusBadRequest, bindTestRequest{}},
+		{"missing body", "/users/7", "abc", "", nil, http.StatusBadRequest, bindTestRequest{}},
+		{"unsupported content type", "/users/7", "abc", "text/plain", []byte("ada"), http.StatusBadRequest, bindTestRequest{}},
+		{"invalid", "/users/7", "abc", "application/json", []byte(`{"name":"root"}`), http.StatusBadRequest, bindTestRequest{}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router := NewRESTRouter()
+			assert.NoError(t, router.Post("/users/:id", func(c *RESTContext) {
+				request := bindTestRequest{}
+				if err := c.Bind(&request); err != nil {
+					c.Error(err)
+					return
+				}
+				if request.Avatar != nil {
+					assert.Equal(t, "ada.png", request.Avatar.Filename)
+					if file, err := request.Avatar.Open(); assert.NoError(t, err) {
+						data, _ := ioutil.ReadAll(file)
+						assert.Equal(t, "png", string(data))
+						file.Close()
+					}
+					request.Avatar = nil
+				}
+				assert.Equal(t, testCase.expected, request)
+				c.End()
+			}))
+
+			req := httptest.NewRequest("POST", testCase.url, bytes.NewReader(testCase.body))
+			if testCase.contentType != "" {
+				req.Header.Set("Content-Type", testCase.contentType)
+			}
+			if testCase.token != "" {
+				req.Header.Set("X-Token", testCase.token)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			assert.Equal(t, testCase.status, recorder.Code, recorder.Body.String())
+		})
+	}
+}
+
+func TestRESTContextBindError(t *testing.T) {
+	router := NewRESTRouter()
+	assert.NoError(t, router.Get("/users/:id", func(c *RESTContext) {
+		request := struct {
+			ID int `param:"id"`
+		}{}
+		err := c.Bind(&request)
+		var bindErr *BindError
+		if assert.True(t, errors.As(err, &bindErr)) {
+			assert.Equal(t, "param", bindErr.Source)
+			assert.Equal(t, "id", bindErr.Field)
+		}
+		c.Error(err)
+	}))
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/users/me", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.True(t, strings.HasPrefix(recorder.Body.String(), "absinthe: invalid param id"))
+}
+
+func TestRESTContextError(t *testing.T) {
+	testCases := []struct {
+		err    error
+		status int
+		body   string
+	}{
+		{&BindError{Source: "query", Field: "page", Err: errRequired}, http.StatusBadRequest, "absinthe: invalid query page: required"},
+		{ErrUnauthenticated, http.StatusUnauthorized, ErrUnauthenticated.Error()},
+		{ErrForbidden, http.StatusForbidden, ErrForbidden.Error()},
+		{errors.New("database is down"), http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)},
+	}
+
+	for _, testCase := range testCases {
+		router := NewRESTRouter()
+		assert.NoError(t, router.Get("/", func(c *RESTContext) {
+			c.Error(testCase.err)
+		}))
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, testCase.status, recorder.Code)
+		assert.Equal(t, testCase.body, recorder.Body.String())
+	}
+}
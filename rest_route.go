@@ -1,69 +1,103 @@
 package absinthe
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
 )
 
-var restRouteKeyPattern = regexp.MustCompile(`^:([\w\d]+)(?:\((.*)\))?$`)
-var restRouteWildCardPattern = regexp.MustCompile(`^\*(?:\((.*)\))?$`)
+var restRouteKeyPattern = regexp.MustCompile(`^:([\w\d]+)(?:<(\w+)>|\((.*)\))?([?*])?$`)
+var restRouteWildCardPattern = regexp.MustCompile(`^\*(?:<(\w+)>|\((.*)\))?(\?)?$`)
+var restRouteRestPattern = regexp.MustCompile(`^\*\*$`)
+var restRouteMethodPattern = regexp.MustCompile(`^[\w-]{1,64}$`)
 var restRouteChunkEscapePattern = regexp.MustCompile(`([\(\)\[\]\{\}\.\?\+\*\^\$\|\-\\])`)
 
+// RESTRoute matches the method and path of REST requests. Its pattern is a
+// path of chunks, each of which is one of
+//
+//	users        a static segment
+//	:id          a param matching a segment, captured as id
+//	:id(\d+)     a param matching a sub-pattern
+//	:id<int>     a param matching a type from ParamTypes
+//	:name?       an optional param, which may be absent
+//	:path*       a param matching the rest of the path, including nothing
+//	*            a wildcard matching a segment, which may also be constrained
+//	             or optional as with params
+//	**           a wildcard matching the rest of the path
+//
+// A pattern ending in + matches any path beginning with it.
 type RESTRoute struct {
 	Method     string
 	PatternSrc string
 	Pattern    *regexp.Regexp
+	Policies   []Policy
+
+	// ParamTypes maps the keys of typed params to their type
+	ParamTypes map[string]string
+
+	chunks []routeChunk
+
+	// terminated is false for routes ending in +, which match any path
+	// beginning with them
+	terminated bool
 }
 
 func NewRESTRoute(method, patternSrc string) (*RESTRoute, error) {
+	if !restRouteMethodPattern.MatchString(method) {
+		return nil, fmt.Errorf("absinthe: invalid method %q", method)
+	}
+
 	selfTerminating := true
 	if len(patternSrc) != 0 && patternSrc[len(patternSrc)-1:] == "+" {
 		patternSrc = patternSrc[:len(patternSrc)-1]
 		selfTerminating = false
 	}
 
-	patternSrcChunks := strings.Split(patternSrc, "/")
+	chunks, err := parseChunks(patternSrc, "/", parseRESTRouteChunk)
+	if err != nil {
+		return nil, err
+	}
 
-	regExpSrcChunks := make([]string, 0)
-	for _, chunk := range patternSrcChunks {
-		if len(chunk) == 0 {
-			continue
+	regExpSrc := `^`
+	paramTypes := make(map[string]string)
+	for i, chunk := range chunks {
+		separatorSrc := `/+`
+		if i == 0 {
+			separatorSrc = `/?`
 		}
-
-		var regExpChunkSrc string
-		if matches := restRouteKeyPattern.FindStringSubmatch(chunk); len(matches) == 3 {
-			key := matches[1]
-			subPattern := matches[2]
-			if len(subPattern) == 0 {
-				subPattern = `[^/]+`
-			}
-			regExpChunkSrc = "(?P<" + key + ">" + subPattern + ")"
-
-		} else if matches := restRouteWildCardPattern.FindStringSubmatch(chunk); len(matches) == 2 {
-			subPattern := matches[1]
-			if len(subPattern) == 0 {
-				subPattern = `[^/]+`
-			}
-			regExpChunkSrc = subPattern
-
-		} else {
-			regExpChunkSrc = restRouteChunkEscapePattern.ReplaceAllString(chunk, `\$1`)
+		regExpSrc += chunk.regExpSrc(separatorSrc, `[^/]+`, restRouteChunkEscapePattern)
+		if chunk.key != "" && chunk.paramType != "" {
+			paramTypes[chunk.key] = chunk.paramType
 		}
-
-		regExpSrcChunks = append(regExpSrcChunks, regExpChunkSrc)
+		// A rest chunk matches the remainder of the path, so the route is
+		// self-terminating regardless of a trailing +
+		if chunk.rest {
+			selfTerminating = true
+		}
+	}
+	if len(chunks) == 0 {
+		regExpSrc += `/?`
 	}
-	regExpSrc := `^/?` + strings.Join(regExpSrcChunks, `/+`) + `/?`
+	regExpSrc += `/?`
 	if selfTerminating {
 		regExpSrc += `$`
 	}
 
-	fmt.Println(regExpSrc)
+	pattern, err := compilePattern(patternSrc, regExpSrc)
+	if err != nil {
+		return nil, err
+	}
 
 	return &RESTRoute{
 		Method:     strings.ToLower(method),
 		PatternSrc: patternSrc,
-		Pattern:    regexp.MustCompile(regExpSrc),
+		Pattern:    pattern,
+		ParamTypes: paramTypes,
+		chunks:     newRouteChunks(chunks, "/"),
+		terminated: selfTerminating,
 	}, nil
 }
 
@@ -71,44 +105,136 @@ func (r *RESTRoute) Match(method, path string) bool {
 	return (r.Method == "all" || strings.ToLower(method) == r.Method) && r.Pattern.MatchString(path)
 }
 
+// FindParams returns the params captured from the path if the route matches
+// the method and path. Optional params absent from the path are omitted.
 func (r *RESTRoute) FindParams(method, path string) (map[string]string, bool) {
 	if !r.Match(method, path) {
 		return nil, false
 	}
+	return findParams(r.Pattern, path), true
+}
 
+// findParams returns the named groups of the pattern captured from the path
+func findParams(pattern *regexp.Regexp, path string) map[string]string {
 	params := make(map[string]string)
-	subExpNames := r.Pattern.SubexpNames()
-	subMatches := r.Pattern.FindStringSubmatch(path)
+	subExpNames := pattern.SubexpNames()
+	subMatchIndexes := pattern.FindStringSubmatchIndex(path)
 
 	for i, key := range subExpNames {
-		if len(key) == 0 {
+		if len(key) == 0 || subMatchIndexes[2*i] == -1 {
 			continue
 		}
-		params[key] = subMatches[i]
+		params[key] = path[subMatchIndexes[2*i]:subMatchIndexes[2*i+1]]
 	}
 
-	return params, true
+	return params
+}
+
+// restRouteWireVersion is the version of the encoding written by GobEncode.
+// Encoded routes begin with the version, so routes from peers running an
+// older release can still be decoded.
+const restRouteWireVersion byte = 1
+
+// restRouteWire is the encoding of a RESTRoute following its version
+type restRouteWire struct {
+	Method     string   `json:"method"`
+	PatternSrc string   `json:"patternSrc"`
+	Terminated bool     `json:"terminated"`
+	Policies   []Policy `json:"policies,omitempty"`
 }
 
 func (r *RESTRoute) GobDecode(data []byte) error {
+	if len(data) == 0 {
+		return errors.New("absinthe: invalid REST route data")
+	}
+	if data[0] != restRouteWireVersion {
+		return r.decodeLegacy(data)
+	}
+
+	wire := restRouteWire{}
+	if err := json.Unmarshal(data[1:], &wire); err != nil {
+		return fmt.Errorf("absinthe: invalid REST route data: %v", err)
+	}
+	patternSrc := wire.PatternSrc
+	if !wire.Terminated {
+		patternSrc += "+"
+	}
+	route, err := NewRESTRoute(wire.Method, patternSrc)
+	if err != nil {
+		return err
+	}
+	route.Policies = wire.Policies
+	*r = *route
+	return nil
+}
+
+// decodeLegacy decodes a route encoded by releases before the wire format was
+// versioned, in which the method is padded to 10 bytes and followed by the
+// pattern source, then optionally a NUL byte and the policies as JSON
+func (r *RESTRoute) decodeLegacy(data []byte) error {
+	var policies []Policy
+	if i := bytes.IndexByte(data, 0); i != -1 {
+		if err := json.Unmarshal(data[i+1:], &policies); err != nil {
+			return err
+		}
+		data = data[:i]
+	}
+	if len(data) < 10 {
+		return errors.New("absinthe: invalid REST route data")
+	}
 	methodData := strings.TrimSpace(string(data[:10]))
 	patternData := strings.TrimSpace(string(data[10:]))
 	route, err := NewRESTRoute(methodData, patternData)
 	if err != nil {
 		return err
 	}
-	r.Method = route.Method
-	r.Pattern = route.Pattern
-	r.PatternSrc = route.PatternSrc
+	route.Policies = policies
+	*r = *route
 	return nil
 }
 
-func (r *RESTRoute) GobEncode() ([]byte, error) {
-	method := r.Method
-	for len(method) < 10 {
-		method += " "
+// GobEncode encodes the route in the current wire format. Zero routes, which
+// have no pattern, are encoded as terminated.
+func (r RESTRoute) GobEncode() ([]byte, error) {
+	wireData, err := json.Marshal(restRouteWire{
+		Method:     r.Method,
+		PatternSrc: r.PatternSrc,
+		Terminated: r.terminated || r.Pattern == nil,
+		Policies:   r.Policies,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{restRouteWireVersion}, wireData...), nil
+}
+
+// restRouteJSON is the JSON representation of a RESTRoute
+type restRouteJSON struct {
+	Method   string   `json:"method"`
+	Pattern  string   `json:"pattern"`
+	Policies []Policy `json:"policies,omitempty"`
+}
+
+func (r RESTRoute) MarshalJSON() ([]byte, error) {
+	patternSrc := r.PatternSrc
+	if !r.terminated && r.Pattern != nil {
+		patternSrc += "+"
 	}
-	return []byte(method + r.PatternSrc), nil
+	return json.Marshal(restRouteJSON{Method: r.Method, Pattern: patternSrc, Policies: r.Policies})
+}
+
+func (r *RESTRoute) UnmarshalJSON(data []byte) error {
+	routeJSON := restRouteJSON{}
+	if err := json.Unmarshal(data, &routeJSON); err != nil {
+		return err
+	}
+	route, err := NewRESTRoute(routeJSON.Method, routeJSON.Pattern)
+	if err != nil {
+		return err
+	}
+	route.Policies = routeJSON.Policies
+	*r = *route
+	return nil
 }
 
 func (r *RESTRoute) String() string {
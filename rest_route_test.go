@@ -1,6 +1,8 @@
 package absinthe
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -203,6 +205,72 @@ var restPatternAndPaths = map[string][2][]string{
 			"/",
 		},
 	},
+	"/files/:name?": [2][]string{
+		[]string{
+			"/files",
+			"/files/",
+			"/files/a.txt",
+		},
+		[]string{
+			"/file",
+			"/files/a/b",
+		},
+	},
+	"/:lang?/about": [2][]string{
+		[]string{
+			"/about",
+			"/en/about",
+		},
+		[]string{
+			"/en",
+			"/en/fr/about",
+		},
+	},
+	"/static/**": [2][]string{
+		[]string{
+			"/static",
+			"/static/",
+			"/static/a",
+			"/static/a/b/c",
+			"/static/a/b/",
+		},
+		[]string{
+			"/stat",
+			"/statics/a",
+		},
+	},
+	"/docs/:path*": [2][]string{
+		[]string{
+			"/docs",
+			"/docs/a",
+			"/docs/a/b",
+		},
+		[]string{
+			"/doc",
+			"/doc/a",
+		},
+	},
+	"/users/:id<int>": [2][]string{
+		[]string{
+			"/users/42",
+			"/users/-1",
+		},
+		[]string{
+			"/users/me",
+			"/users/4.2",
+			"/users",
+		},
+	},
+	"/users/:id<uuid>/*<alpha>?": [2][]string{
+		[]string{
+			"/users/123e4567-e89b-12d3-a456-426614174000",
+			"/users/123e4567-e89b-12d3-a456-426614174000/posts",
+		},
+		[]string{
+			"/users/42",
+			"/users/123e4567-e89b-12d3-a456-426614174000/42",
+		},
+	},
 }
 
 func TestNewRESTRoute(t *testing.T) {
@@ -245,3 +313,182 @@ func TestRESTRouteFindParams(t *testing.T) {
 	_, ok = route.FindParams("post", "/1/one/2/two/3/three")
 	assert.False(t, ok, "A get route should not match a post request")
 }
+
+func TestRESTRouteGobPolicies(t *testing.T) {
+	route, err := NewRESTRoute("get", "/users/:userID")
+	assert.NoError(t, err)
+	route.Policies = []Policy{RequireRoles("admin"), RequireParamClaim("userID", "sub")}
+
+	data, err := route.GobEncode()
+	assert.NoError(t, err)
+
+	decodedRoute := &RESTRoute{}
+	assert.NoError(t, decodedRoute.GobDecode(data))
+	assert.Equal(t, route.Method, decodedRoute.Method)
+	assert.Equal(t, route.PatternSrc, decodedRoute.PatternSrc)
+	assert.Equal(t, route.Policies, decodedRoute.Policies)
+}
+
+func TestRESTRouteFindParamsSyntax(t *testing.T) {
+	testCases := []struct {
+		pattern, path string
+		params        map[string]string
+	}{
+		{"/files/:name?", "/files/a.txt", map[string]string{"name": "a.txt"}},
+		{"/files/:name?", "/files", map[string]string{}},
+		{"/static/:path*", "/static/css/site.css", map[string]string{"path": "css/site.css"}},
+		{"/static/:path*", "/static/css/", map[string]string{"path": "css"}},
+		{"/static/:path*", "/static", map[string]string{}},
+		{"/users/:id<int>/*<uuid>", "/users/7/123e4567-e89b-12d3-a456-426614174000", map[string]string{"id": "7"}},
+		{"/:lang?/about", "/en/about", map[string]string{"lang": "en"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.pattern+" "+testCase.path, func(t *testing.T) {
+			route, err := NewRESTRoute("get", testCase.pattern)
+			assert.NoError(t, err)
+			params, ok := route.FindParams("get", testCase.path)
+			assert.True(t, ok)
+			assert.Equal(t, testCase.params, params)
+		})
+	}
+}
+
+func TestNewRESTRouteInvalidSyntax(t *testing.T) {
+	for _, pattern := range []string{
+		"/users/:id<bigint>",
+		"/static/**/file",
+		"/static/:path*/file",
+		"/static/:path(.*)*",
+		"/users/:id([a-z)",
+		"/users/:id((\\d+))",
+		"/users/:id(a)(b)",
+		"/users/:id(a)|(?P<x>b)",
+		"/users/*(?P<x>\\d+)",
+		"/users/:id/posts/:id",
+		"/users/:id(a{1000}b{1000}c{1000}d{1000}e{1000})",
+		"/" + strings.Repeat("a", MaxPatternLength),
+		strings.Repeat("/a", MaxPatternChunks+1),
+	} {
+		_, err := NewRESTRoute("get", pattern)
+		assert.Error(t, err, "pattern %s should be invalid", pattern)
+	}
+
+	for _, method := range []string{"", "get post", "notamethod!", strings.Repeat("a", 65)} {
+		_, err := NewRESTRoute(method, "/users")
+		assert.Error(t, err, "method %q should be invalid", method)
+	}
+}
+
+func TestRESTRouteParamTypes(t *testing.T) {
+	route, err := NewRESTRoute("get", "/users/:id<int>/posts/:postID<uuid>/:slug")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"id": "int", "postID": "uuid"}, route.ParamTypes)
+
+	params, ok := route.FindParams("get", "/users/42/posts/123e4567-e89b-12d3-a456-426614174000/hello")
+	assert.True(t, ok)
+	id, err := Params(params).Int("id")
+	assert.NoError(t, err)
+	assert.Equal(t, 42, id)
+	_, err = Params(params).Int("slug")
+	assert.Error(t, err)
+	_, err = Params(params).Int("missing")
+	assert.Error(t, err)
+}
+
+func TestRESTRouteRoundTrip(t *testing.T) {
+	for _, pattern := range []string{"/files/:name?", "/static/**", "/users/:id<int>", "/api/:version<int>+"} {
+		route, err := NewRESTRoute("get", pattern)
+		assert.NoError(t, err)
+		route.Policies = []Policy{RequireRoles("admin")}
+
+		data, err := route.GobEncode()
+		assert.NoError(t, err)
+		gobRoute := &RESTRoute{}
+		assert.NoError(t, gobRoute.GobDecode(data))
+		assert.Equal(t, route.PatternSrc, gobRoute.PatternSrc)
+		assert.Equal(t, route.Pattern.String(), gobRoute.Pattern.String())
+		assert.Equal(t, route.ParamTypes, gobRoute.ParamTypes)
+		assert.Equal(t, route.Policies, gobRoute.Policies)
+
+		data, err = json.Marshal(route)
+		assert.NoError(t, err)
+		jsonRoute := &RESTRoute{}
+		assert.NoError(t, json.Unmarshal(data, jsonRoute))
+		assert.Equal(t, route.Method, jsonRoute.Method)
+		assert.Equal(t, route.Pattern.String(), jsonRoute.Pattern.String())
+		assert.Equal(t, route.ParamTypes, jsonRoute.ParamTypes)
+		assert.Equal(t, route.Policies, jsonRoute.Policies)
+	}
+}
+
+func TestRESTRouteGobWireFormat(t *testing.T) {
+	testCases := []struct {
+		method, pattern string
+	}{
+		{"get", "/users/:id+"},
+		{"get", "+"},
+		{"get", ""},
+		{"verylongmethod", "/users/:id"},
+		{"all", "/static/**+"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.method+" "+testCase.pattern, func(t *testing.T) {
+			route, err := NewRESTRoute(testCase.method, testCase.pattern)
+			assert.NoError(t, err)
+
+			data, err := route.GobEncode()
+			assert.NoError(t, err)
+			decodedRoute := &RESTRoute{}
+			assert.NoError(t, decodedRoute.GobDecode(data))
+			assert.Equal(t, route.Method, decodedRoute.Method)
+			assert.Equal(t, route.PatternSrc, decodedRoute.PatternSrc)
+			assert.Equal(t, route.Pattern.String(), decodedRoute.Pattern.String())
+		})
+	}
+}
+
+func TestRESTRouteGobDecodeLegacy(t *testing.T) {
+	route := &RESTRoute{}
+	assert.NoError(t, route.GobDecode([]byte("get       /users/:userID\x00[{\"Roles\":[\"admin\"]}]")))
+	assert.Equal(t, "get", route.Method)
+	assert.Equal(t, "/users/:userID", route.PatternSrc)
+	assert.Equal(t, []Policy{RequireRoles("admin")}, route.Policies)
+
+	for _, data := range [][]byte{nil, []byte("get"), []byte{restRouteWireVersion}, []byte{restRouteWireVersion, '{'}} {
+		assert.Error(t, (&RESTRoute{}).GobDecode(data), "data %q should be invalid", data)
+	}
+}
+
+func FuzzRESTRouteGobDecode(f *testing.F) {
+	for _, pattern := range []string{"", "/users/:id", "/users/:id(\\d+)+", "/files/:name?", "/static/**", "/users/:id<uuid>"} {
+		route, err := NewRESTRoute("get", pattern)
+		assert.NoError(f, err)
+		route.Policies = []Policy{RequireRoles("admin")}
+		data, err := route.GobEncode()
+		assert.NoError(f, err)
+		f.Add(data)
+	}
+	f.Add([]byte{})
+	f.Add([]byte("get"))
+	f.Add([]byte("get       /users/:id(a)(b)"))
+	f.Add([]byte("get       /users/:id\x00[]"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		route := &RESTRoute{}
+		if err := route.GobDecode(data); err != nil {
+			return
+		}
+		route.FindParams("get", "/users/42")
+
+		encoded, err := route.GobEncode()
+		assert.NoError(t, err)
+		decodedRoute := &RESTRoute{}
+		if assert.NoError(t, decodedRoute.GobDecode(encoded)) {
+			assert.Equal(t, route.Method, decodedRoute.Method)
+			assert.Equal(t, route.PatternSrc, decodedRoute.PatternSrc)
+			assert.Equal(t, route.Pattern.String(), decodedRoute.Pattern.String())
+		}
+	})
+}
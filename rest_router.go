@@ -1,5 +1,12 @@
 package absinthe
 
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
 type RESTRouter struct {
 	client    *Client
 	baseRoute RESTRoute
@@ -25,57 +32,168 @@ func (r *RESTRouter) Mount(path string, router *RESTRouter) error {
 		Route:  route,
 		Router: router,
 	})
+	r.lazyPublishRoutes()
 	return nil
 }
 
-func (r *RESTRouter) All(path string, middleware RESTHandler) error {
-	route, err := NewRESTRoute("all", path)
+// Use binds a middleware to every request reaching the router. Middleware is
+// not advertised to other peers, so a service using it is only sent requests
+// matching its routes.
+func (r *RESTRouter) Use(middleware RESTHandler, policies ...Policy) error {
+	route, err := NewRESTRoute("all", "+")
+	if err != nil {
+		return err
+	}
+	route.Policies = policies
+	r.layers = append(r.layers, RESTRouterLayer{
+		Route:      route,
+		Handler:    middleware,
+		middleware: true,
+	})
+	return nil
+}
+
+func (r *RESTRouter) All(path string, middleware RESTHandler, policies ...Policy) error {
+	return r.Route("all", path, middleware, policies...)
+}
+
+func (r *RESTRouter) Get(path string, handler RESTHandler, policies ...Policy) error {
+	return r.Route("get", path, handler, policies...)
+}
+
+func (r *RESTRouter) Post(path string, handler RESTHandler, policies ...Policy) error {
+	return r.Route("post", path, handler, policies...)
+}
+
+func (r *RESTRouter) Put(path string, handler RESTHandler, policies ...Policy) error {
+	return r.Route("put", path, handler, policies...)
+}
+
+func (r *RESTRouter) Patch(path string, handler RESTHandler, policies ...Policy) error {
+	return r.Route("patch", path, handler, policies...)
+}
+
+func (r *RESTRouter) Delete(path string, handler RESTHandler, policies ...Policy) error {
+	return r.Route("delete", path, handler, policies...)
+}
+
+// Route binds a handler to the given method and path. Any policies given are
+// advertised with the route and must be satisfied by the caller.
+func (r *RESTRouter) Route(method, path string, handler RESTHandler, policies ...Policy) error {
+	route, err := NewRESTRoute(method, path)
 	if err != nil {
 		return err
 	}
+	route.Policies = policies
 	r.layers = append(r.layers, RESTRouterLayer{
 		Route:   route,
-		Handler: middleware,
+		Handler: handler,
 	})
 	r.lazyPublishRoutes()
 	return nil
 }
 
 func (r *RESTRouter) Exec(context *RESTContext) {
+	parentNext := context.Next
 	currentLayerIndex := 0
 	context.Next = func() {
 		if currentLayerIndex < len(r.layers) {
 			layer := r.layers[currentLayerIndex]
 			currentLayerIndex++
 			layer.Exec(context)
+		} else if parentNext != nil {
+			parentNext()
 		} else {
 			context.Status(404).End()
 		}
 	}
+	context.Next()
 }
 
-func (r *RESTRouter) lazyPublishRoutes() {
-	// for _, layer := range r.layers {
+// ServeHTTP runs the router in process against an HTTP request, without
+// dispatching it through the transport. The identity carried by the request
+// context, if any, is passed to the handlers.
+func (r *RESTRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	context := newRESTContext(r.client, &RESTRequest{
+		Method:    req.Method,
+		URL:       req.URL.RequestURI(),
+		RequestID: requestIDFor(req),
+		Header:    req.Header,
+		Body:      body,
+	})
+	context.Identity = IdentityFromContext(req.Context())
+	context.ctx = req.Context()
+	go r.Exec(context)
 
-	// }
+	timeout := DefaultRequestTimeout
+	if r.client != nil {
+		timeout = r.client.options.RequestTimeout
+	}
+	select {
+	case <-context.done:
+		writeRESTResponse(w, context.response)
+	case <-time.After(timeout):
+		http.Error(w, http.StatusText(http.StatusGatewayTimeout), http.StatusGatewayTimeout)
+	}
+}
+
+// lazyPublishRoutes advertises the routes of the client's root router on its
+// peer. Routes of mounted routers are covered by the route they are mounted on,
+// and middleware is kept local.
+func (r *RESTRouter) lazyPublishRoutes() {
+	if r.client == nil || r.client.RESTRouter != r {
+		return
+	}
+	for _, layer := range r.layers {
+		if layer.middleware {
+			continue
+		}
+		r.client.addRESTRoute(*layer.Route)
+	}
 }
 
 type RESTRouterLayer struct {
 	Route   *RESTRoute
 	Router  *RESTRouter
 	Handler RESTHandler
+
+	// middleware is true for layers bound with Use, which are not advertised
+	middleware bool
 }
 
 func (r *RESTRouterLayer) Exec(context *RESTContext) {
-	params, ok := r.Route.FindParams(context.Method, context.URL)
+	params, ok := r.Route.FindParams(context.Method, context.path)
 	if !ok {
 		context.Next()
 		return
 	}
+	if err := authorize(r.Route.Policies, context.Identity, params); err != nil {
+		context.Status(authorizationStatus(err)).End()
+		return
+	}
 	context.Params = params
 	if r.Handler != nil {
+		context.route = r.Route
 		r.Handler(context)
-	} else {
-		r.Router.Exec(context)
+		return
+	}
+
+	path := context.path
+	next := context.Next
+	context.path = path[r.Route.Pattern.FindStringIndex(path)[1]:]
+	if !strings.HasPrefix(context.path, "/") {
+		context.path = "/" + context.path
+	}
+	context.Next = func() {
+		context.path = path
+		context.Next = next
+		next()
 	}
+	r.Router.Exec(context)
 }
@@ -0,0 +1,280 @@
+package absinthe
+
+import (
+	"regexp"
+	"strings"
+)
+
+// routeIndex is a trie of the routes or patterns advertised by peers, keyed by
+// their chunks. A lookup walks the segments of a path to find the entries
+// which may match it, so its cost depends on the length of the path rather
+// than the number of routes. Candidates are confirmed with their patterns by
+// the caller. Routes with chunks able to span separators or match nothing
+// cannot be placed in the trie, so they are candidates for every lookup.
+type routeIndex struct {
+	separator string
+	root      *routeNode
+	unindexed []routeEntry
+}
+
+// maxIndexedOptionalChunks is the most optional chunks a route may have and
+// still be placed in the trie, as it is placed once for each combination
+const maxIndexedOptionalChunks = 4
+
+// routeNode is a node of a routeIndex. Entries are routes ending at the node,
+// and prefixes are unterminated routes with a single chunk past it, as the
+// pattern of an unterminated route may match only part of its last segment.
+type routeNode struct {
+	static   map[string]*routeNode
+	dynamic  []*routeNode
+	key      string
+	pattern  *regexp.Regexp
+	entries  []routeEntry
+	prefixes []routeEntry
+}
+
+// routeEntry is a route or pattern advertised by a peer
+type routeEntry struct {
+	peerID     string
+	restRoute  *RESTRoute
+	rpcPattern *RPCPattern
+}
+
+func newRouteIndex(separator string) *routeIndex {
+	return &routeIndex{
+		separator: separator,
+		root:      &routeNode{},
+	}
+}
+
+func newRESTRouteIndex() *routeIndex {
+	return newRouteIndex("/")
+}
+
+func newRPCPatternIndex() *routeIndex {
+	return newRouteIndex(".")
+}
+
+func (x *routeIndex) addRESTRoute(peerID string, route RESTRoute) {
+	x.add(route.routeChunks(), route.terminated, routeEntry{peerID: peerID, restRoute: &route})
+}
+
+func (x *routeIndex) addRPCPattern(peerID string, pattern RPCPattern) {
+	x.add(pattern.routeChunks(), pattern.terminated, routeEntry{peerID: peerID, rpcPattern: &pattern})
+}
+
+func (x *routeIndex) removeRESTRoute(peerID string, route RESTRoute) {
+	x.remove(peerID, route.PatternSrc, route.routeChunks(), route.terminated)
+}
+
+func (x *routeIndex) removeRPCPattern(peerID string, pattern RPCPattern) {
+	x.remove(peerID, pattern.PatternSrc, pattern.routeChunks(), pattern.terminated)
+}
+
+func (x *routeIndex) add(chunks []routeChunk, terminated bool, entry routeEntry) {
+	placements, prefix, ok := routePlacements(chunks, terminated)
+	if !ok {
+		x.unindexed = append(x.unindexed, entry)
+		return
+	}
+	for _, chunks := range placements {
+		node := x.root
+		for _, chunk := range chunks {
+			node = node.child(chunk)
+		}
+		if prefix {
+			node.prefixes = appendRouteEntry(node.prefixes, entry)
+		} else {
+			node.entries = appendRouteEntry(node.entries, entry)
+		}
+	}
+}
+
+// remove removes the entries of a peer for the given pattern source, pruning
+// nodes left empty
+func (x *routeIndex) remove(peerID, patternSrc string, chunks []routeChunk, terminated bool) {
+	placements, prefix, ok := routePlacements(chunks, terminated)
+	if !ok {
+		x.unindexed = removeRouteEntries(x.unindexed, peerID, patternSrc)
+		return
+	}
+	for _, chunks := range placements {
+		x.root.remove(chunks, peerID, patternSrc, prefix)
+	}
+}
+
+// routePlacements returns the chunks leading to each node a route or pattern is
+// placed at, and whether it is placed as a prefix. Unterminated routes, and
+// routes ending in a rest chunk, are placed as prefixes without their last
+// chunk. Routes with optional chunks are placed once with and once without
+// each. It returns false if the route cannot be placed in the trie.
+func routePlacements(chunks []routeChunk, terminated bool) ([][]routeChunk, bool, bool) {
+	prefix := false
+	if len(chunks) != 0 && (!terminated || chunks[len(chunks)-1].rest) {
+		chunks = chunks[:len(chunks)-1]
+		prefix = true
+	} else if !terminated {
+		prefix = true
+	}
+
+	optional := 0
+	for _, chunk := range chunks {
+		if chunk.spans {
+			return nil, false, false
+		}
+		if chunk.optional {
+			optional++
+		}
+	}
+	if optional > maxIndexedOptionalChunks {
+		return nil, false, false
+	}
+
+	placements := [][]routeChunk{{}}
+	for _, chunk := range chunks {
+		next := make([][]routeChunk, 0, len(placements)*2)
+		for _, placement := range placements {
+			next = append(next, append(placement[:len(placement):len(placement)], chunk))
+			if chunk.optional {
+				next = append(next, placement)
+			}
+		}
+		placements = next
+	}
+	return placements, prefix, true
+}
+
+// candidates returns the entries which may match the given path
+func (x *routeIndex) candidates(path string) []routeEntry {
+	segments := make([]string, 0)
+	for _, segment := range strings.Split(path, x.separator) {
+		if len(segment) != 0 {
+			segments = append(segments, segment)
+		}
+	}
+
+	candidates := append([]routeEntry{}, x.unindexed...)
+	var walk func(node *routeNode, depth int)
+	walk = func(node *routeNode, depth int) {
+		candidates = append(candidates, node.prefixes...)
+		if depth == len(segments) {
+			candidates = append(candidates, node.entries...)
+			return
+		}
+		if child, ok := node.static[segments[depth]]; ok {
+			walk(child, depth+1)
+		}
+		for _, child := range node.dynamic {
+			if child.pattern == nil || child.pattern.MatchString(segments[depth]) {
+				walk(child, depth+1)
+			}
+		}
+	}
+	walk(x.root, 0)
+
+	// A route with optional chunks may be placed at more than one node
+	// reached by the path
+	seen := make(map[routeEntry]bool, len(candidates))
+	unique := candidates[:0]
+	for _, candidate := range candidates {
+		if !seen[candidate] {
+			seen[candidate] = true
+			unique = append(unique, candidate)
+		}
+	}
+	return unique
+}
+
+func (n *routeNode) child(chunk routeChunk) *routeNode {
+	if chunk.isStatic {
+		if n.static == nil {
+			n.static = make(map[string]*routeNode)
+		}
+		child, ok := n.static[chunk.static]
+		if !ok {
+			child = &routeNode{}
+			n.static[chunk.static] = child
+		}
+		return child
+	}
+	key := chunkKey(chunk)
+	for _, child := range n.dynamic {
+		if child.key == key {
+			return child
+		}
+	}
+	child := &routeNode{key: key, pattern: chunk.pattern}
+	n.dynamic = append(n.dynamic, child)
+	return child
+}
+
+// remove removes the entries of a peer for the given pattern source from the
+// node found by following the given chunks, and reports whether the node is
+// left empty
+func (n *routeNode) remove(chunks []routeChunk, peerID, patternSrc string, prefix bool) bool {
+	if len(chunks) == 0 {
+		if prefix {
+			n.prefixes = removeRouteEntries(n.prefixes, peerID, patternSrc)
+		} else {
+			n.entries = removeRouteEntries(n.entries, peerID, patternSrc)
+		}
+		return n.empty()
+	}
+
+	chunk := chunks[0]
+	if chunk.isStatic {
+		if child, ok := n.static[chunk.static]; ok && child.remove(chunks[1:], peerID, patternSrc, prefix) {
+			delete(n.static, chunk.static)
+		}
+		return n.empty()
+	}
+	key := chunkKey(chunk)
+	for i, child := range n.dynamic {
+		if child.key == key {
+			if child.remove(chunks[1:], peerID, patternSrc, prefix) {
+				n.dynamic = append(n.dynamic[:i], n.dynamic[i+1:]...)
+			}
+			break
+		}
+	}
+	return n.empty()
+}
+
+func (n *routeNode) empty() bool {
+	return len(n.static) == 0 && len(n.dynamic) == 0 && len(n.entries) == 0 && len(n.prefixes) == 0
+}
+
+func chunkKey(chunk routeChunk) string {
+	if chunk.pattern == nil {
+		return ""
+	}
+	return chunk.pattern.String()
+}
+
+func (e *routeEntry) patternSrc() string {
+	if e.restRoute != nil {
+		return e.restRoute.PatternSrc
+	}
+	return e.rpcPattern.PatternSrc
+}
+
+// appendRouteEntry appends an entry unless it is already present, as a route
+// with optional chunks may be placed at a node more than once
+func appendRouteEntry(entries []routeEntry, entry routeEntry) []routeEntry {
+	for _, existing := range entries {
+		if existing == entry {
+			return entries
+		}
+	}
+	return append(entries, entry)
+}
+
+func removeRouteEntries(entries []routeEntry, peerID, patternSrc string) []routeEntry {
+	kept := entries[:0]
+	for _, entry := range entries {
+		if entry.peerID != peerID || entry.patternSrc() != patternSrc {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
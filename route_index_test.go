@@ -0,0 +1,304 @@
+package absinthe
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var indexRESTPatterns = []string{
+	"/users/:id(\\d+)",
+	"/users/:id+",
+	"/users/*(\\d*)",
+	"/files/*(.*)",
+	"/files/:name(\\w+)+",
+	"/files/:a?/:b?/x",
+	"/:a?/:b?/:c?/:d?/:e?",
+	"/assets/**",
+	"/assets/:path*+",
+	"+",
+}
+
+var indexRESTPaths = []string{
+	"/users/42",
+	"/users/me",
+	"/users//42/",
+	"users/42",
+	"//users/42",
+	"/users/",
+	"/users/42abc/posts",
+	"/files/a/b/c",
+	"/files/name.txt",
+	"/files/x",
+	"/files/1/x",
+	"/files/1/2/x",
+	"/a/b/c",
+	"/assets",
+	"/assets/a/b",
+}
+
+func TestRouteIndexRESTCandidates(t *testing.T) {
+	index := newRESTRouteIndex()
+	routes := make([]*RESTRoute, 0)
+	patterns := append([]string{}, indexRESTPatterns...)
+	paths := append([]string{}, indexRESTPaths...)
+	for pattern, patternPaths := range restPatternAndPaths {
+		patterns = append(patterns, pattern)
+		paths = append(append(paths, patternPaths[0]...), patternPaths[1]...)
+	}
+	for n, pattern := range patterns {
+		route, err := NewRESTRoute("get", pattern)
+		assert.NoError(t, err)
+		routes = append(routes, route)
+		index.addRESTRoute(strconv.Itoa(n), *route)
+	}
+
+	for _, path := range paths {
+		scanned := make([]string, 0)
+		for _, route := range routes {
+			if route.Match("get", path) {
+				scanned = append(scanned, route.String())
+			}
+		}
+		indexed := make([]string, 0)
+		for _, candidate := range index.candidates(path) {
+			if candidate.restRoute.Match("get", path) {
+				indexed = append(indexed, candidate.restRoute.String())
+			}
+		}
+		sort.Strings(scanned)
+		sort.Strings(indexed)
+		assert.Equal(t, scanned, indexed, "index and scan disagree on path %q", path)
+	}
+}
+
+func TestRouteIndexRPCCandidates(t *testing.T) {
+	index := newRPCPatternIndex()
+	patterns := make([]*RPCPattern, 0)
+	paths := []string{"user.42.get", "user..get", "user.42", ".user"}
+	for patternSrc, patternPaths := range rpcPatternAndPaths {
+		pattern, err := NewRPCPattern(patternSrc)
+		assert.NoError(t, err)
+		patterns = append(patterns, pattern)
+		index.addRPCPattern("1", *pattern)
+		paths = append(append(paths, patternPaths[0]...), patternPaths[1]...)
+	}
+
+	for _, path := range paths {
+		scanned := make([]string, 0)
+		for _, pattern := range patterns {
+			if pattern.Match(path) {
+				scanned = append(scanned, pattern.String())
+			}
+		}
+		indexed := make([]string, 0)
+		for _, candidate := range index.candidates(path) {
+			if candidate.rpcPattern.Match(path) {
+				indexed = append(indexed, candidate.rpcPattern.String())
+			}
+		}
+		sort.Strings(scanned)
+		sort.Strings(indexed)
+		assert.Equal(t, scanned, indexed, "index and scan disagree on path %q", path)
+	}
+}
+
+func TestRouteIndexRemove(t *testing.T) {
+	index := newRESTRouteIndex()
+	add := func(peerID, pattern string) *RESTRoute {
+		route, err := NewRESTRoute("get", pattern)
+		assert.NoError(t, err)
+		index.addRESTRoute(peerID, *route)
+		return route
+	}
+	a := add("a", "/users/:id")
+	b := add("b", "/users/:id")
+	c := add("a", "/users/:id/posts+")
+	d := add("a", "/files/*(.*)")
+
+	// The spanning route is not in the trie, so it is always a candidate
+	assert.Len(t, index.candidates("/users/42"), 4)
+	index.removeRESTRoute("a", *a)
+	candidates := index.candidates("/users/42")
+	if assert.Len(t, candidates, 3) {
+		assert.Equal(t, "b", candidates[2].peerID)
+	}
+
+	index.removeRESTRoute("b", *b)
+	index.removeRESTRoute("a", *c)
+	index.removeRESTRoute("a", *d)
+	assert.Empty(t, index.candidates("/users/42"))
+	assert.True(t, index.root.empty())
+	assert.Empty(t, index.unindexed)
+}
+
+func TestIndexerMatchREST(t *testing.T) {
+	indexer := NewIndexer(nil)
+	for _, id := range []string{"2", "1"} {
+		peer := Peer{ID: id, Name: "users", RESTRoutes: make(map[string]RESTRoute)}
+		route, err := NewRESTRoute("get", "/users/:id")
+		assert.NoError(t, err)
+		peer.AddRESTRoute(*route)
+		indexer.setKnownPeer(peer)
+	}
+
+	match, ok := indexer.MatchREST("GET", "/users/42")
+	assert.True(t, ok)
+	assert.Equal(t, "/users/:id", match.Route.PatternSrc)
+	assert.Equal(t, map[string]string{"id": "42"}, match.Params)
+	if assert.Len(t, match.Peers, 2) {
+		assert.Equal(t, "1", match.Peers[0].ID)
+		assert.Equal(t, "2", match.Peers[1].ID)
+	}
+
+	indexer.deleteKnownPeer("1")
+	match, ok = indexer.MatchREST("GET", "/users/42")
+	assert.True(t, ok)
+	assert.Len(t, match.Peers, 1)
+
+	indexer.deleteKnownPeer("2")
+	_, ok = indexer.MatchREST("GET", "/users/42")
+	assert.False(t, ok)
+}
+
+func TestIndexerSetKnownPeerUnchanged(t *testing.T) {
+	indexer := NewIndexer(nil)
+	newPeer := func(patterns ...string) Peer {
+		peer := Peer{ID: "1", Name: "users", RESTRoutes: make(map[string]RESTRoute), RPCPatterns: make(map[string]RPCPattern)}
+		for _, pattern := range patterns {
+			route, err := NewRESTRoute("get", pattern)
+			assert.NoError(t, err)
+			peer.AddRESTRoute(*route)
+		}
+		return peer
+	}
+
+	assert.True(t, indexer.setKnownPeer(newPeer("/users/:id")))
+	entry := indexer.restIndex.candidates("/users/42")[0].restRoute
+
+	// The same announcement leaves the index as it is
+	assert.False(t, indexer.setKnownPeer(newPeer("/users/:id")))
+	candidates := indexer.restIndex.candidates("/users/42")
+	if assert.Len(t, candidates, 1) {
+		assert.True(t, entry == candidates[0].restRoute, "the route should not be re-indexed")
+	}
+
+	changed := newPeer("/users/:id")
+	route := changed.RESTRoutes[entry.String()]
+	route.Policies = []Policy{{Roles: []string{"admin"}}}
+	changed.RESTRoutes[entry.String()] = route
+	assert.True(t, indexer.setKnownPeer(changed))
+	candidates = indexer.restIndex.candidates("/users/42")
+	if assert.Len(t, candidates, 1) {
+		assert.Equal(t, route.Policies, candidates[0].restRoute.Policies)
+	}
+
+	assert.True(t, indexer.setKnownPeer(newPeer("/accounts/:id")))
+	assert.Empty(t, indexer.restIndex.candidates("/users/42"))
+	assert.Len(t, indexer.restIndex.candidates("/accounts/42"), 1)
+}
+
+// benchmarkIndexer returns an indexer with the given number of services, each
+// advertising a handful of REST routes and RPC patterns
+func benchmarkIndexer(b *testing.B, services int) Indexer {
+	indexer := NewIndexer(nil)
+	for n := 0; n < services; n++ {
+		peer := Peer{
+			ID:          fmt.Sprintf("%04d", n),
+			Name:        fmt.Sprintf("service%d", n),
+			RESTRoutes:  make(map[string]RESTRoute),
+			RPCPatterns: make(map[string]RPCPattern),
+		}
+		for _, pattern := range []string{
+			"/service%d",
+			"/service%d/:id",
+			"/service%d/:id/items",
+			"/service%d/:id/items/:itemID(\\d+)",
+			"/service%d/:id/files+",
+		} {
+			for _, method := range []string{"get", "post"} {
+				route, err := NewRESTRoute(method, fmt.Sprintf(pattern, n))
+				if err != nil {
+					b.Fatal(err)
+				}
+				peer.AddRESTRoute(*route)
+			}
+		}
+		for _, patternSrc := range []string{"service%d.$id.get", "service%d.$id.update", "service%d.$.items.$itemID"} {
+			pattern, err := NewRPCPattern(fmt.Sprintf(patternSrc, n))
+			if err != nil {
+				b.Fatal(err)
+			}
+			peer.AddRPCPattern(*pattern)
+		}
+		indexer.setKnownPeer(peer)
+	}
+	return indexer
+}
+
+// scanRESTPeer finds a peer by checking every route of every peer, as the
+// indexer did before routes were indexed
+func scanRESTPeer(indexer *Indexer, method, path string) (Peer, RESTRoute, bool) {
+	for _, peer := range indexer.knownPeers {
+		if route, ok := peer.FindRESTRoute(method, path); ok {
+			return peer, route, true
+		}
+	}
+	return Peer{}, RESTRoute{}, false
+}
+
+func scanRPCPeer(indexer *Indexer, path string) (Peer, RPCPattern, bool) {
+	for _, peer := range indexer.knownPeers {
+		if pattern, ok := peer.FindRPCPattern(path); ok {
+			return peer, pattern, true
+		}
+	}
+	return Peer{}, RPCPattern{}, false
+}
+
+func BenchmarkFindRESTPeer(b *testing.B) {
+	for _, services := range []int{10, 100, 500} {
+		indexer := benchmarkIndexer(b, services)
+		path := fmt.Sprintf("/service%d/42/items/7", services/2)
+
+		b.Run(fmt.Sprintf("index/%d", services), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				if _, _, ok := indexer.FindRESTPeer("GET", path); !ok {
+					b.Fatal("no peer found")
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("scan/%d", services), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				if _, _, ok := scanRESTPeer(&indexer, "GET", path); !ok {
+					b.Fatal("no peer found")
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFindRPCPeer(b *testing.B) {
+	for _, services := range []int{10, 100, 500} {
+		indexer := benchmarkIndexer(b, services)
+		path := fmt.Sprintf("service%d.42.items.7", services/2)
+
+		b.Run(fmt.Sprintf("index/%d", services), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				if _, _, ok := indexer.FindRPCPeer(path); !ok {
+					b.Fatal("no peer found")
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("scan/%d", services), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				if _, _, ok := scanRPCPeer(&indexer, path); !ok {
+					b.Fatal("no peer found")
+				}
+			}
+		})
+	}
+}
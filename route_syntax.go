@@ -0,0 +1,225 @@
+package absinthe
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// Limits on the patterns of REST routes and RPC patterns. Patterns announced
+// by peers are decoded with the same limits, so a peer cannot announce a
+// pattern too costly for others to compile and match.
+const (
+	// MaxPatternLength is the most bytes a pattern may have
+	MaxPatternLength = 1024
+
+	// MaxPatternChunks is the most chunks a pattern may have
+	MaxPatternChunks = 64
+
+	// MaxPatternInstructions is the most instructions the program compiled
+	// from a pattern may have, which bounds the cost of matching it
+	MaxPatternInstructions = 4096
+)
+
+// ParamTypes maps the types which may constrain a param of a REST route, as
+// in :id<int>, to the sub-pattern a value of the type must match
+var ParamTypes = map[string]string{
+	"int":   `-?\d+`,
+	"uint":  `\d+`,
+	"float": `-?\d+(?:\.\d+)?`,
+	"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+	"alpha": `[a-zA-Z]+`,
+}
+
+// chunkSyntax is a parsed chunk of a route or pattern source. Params have a
+// key, and wildcards do not. Alternations are chunks matching one of several
+// static segments. Optional chunks may be absent from a path, and rest chunks
+// match the remainder of a path, or nothing if they have no sub-pattern.
+type chunkSyntax struct {
+	static      string
+	isStatic    bool
+	key         string
+	paramType   string
+	subPattern  string
+	alternation bool
+	optional    bool
+	rest        bool
+}
+
+// chunkParser parses a chunk of a route or pattern source
+type chunkParser func(chunkSrc string) (chunkSyntax, error)
+
+func parseRESTRouteChunk(chunkSrc string) (chunkSyntax, error) {
+	if restRouteRestPattern.MatchString(chunkSrc) {
+		return chunkSyntax{rest: true}, nil
+	}
+
+	chunk := chunkSyntax{}
+	var modifier string
+	if matches := restRouteKeyPattern.FindStringSubmatch(chunkSrc); len(matches) == 5 {
+		chunk.key, chunk.paramType, chunk.subPattern, modifier = matches[1], matches[2], matches[3], matches[4]
+	} else if matches := restRouteWildCardPattern.FindStringSubmatch(chunkSrc); len(matches) == 4 {
+		chunk.paramType, chunk.subPattern, modifier = matches[1], matches[2], matches[3]
+	} else {
+		return chunkSyntax{static: chunkSrc, isStatic: true}, nil
+	}
+
+	if chunk.paramType != "" {
+		subPattern, ok := ParamTypes[chunk.paramType]
+		if !ok {
+			return chunkSyntax{}, fmt.Errorf("absinthe: unknown param type %s in chunk %s", chunk.paramType, chunkSrc)
+		}
+		chunk.subPattern = subPattern
+	}
+	switch modifier {
+	case "?":
+		chunk.optional = true
+	case "*":
+		if chunk.subPattern != "" {
+			return chunkSyntax{}, fmt.Errorf("absinthe: rest param %s cannot be constrained", chunkSrc)
+		}
+		chunk.rest = true
+	}
+	return chunk, nil
+}
+
+func parseRPCPatternChunk(chunkSrc string) (chunkSyntax, error) {
+	if matches := rpcPatternTailPattern.FindStringSubmatch(chunkSrc); len(matches) == 2 {
+		return chunkSyntax{key: matches[1], subPattern: rpcPatternTailSubPattern, rest: true}, nil
+	}
+	if matches := rpcPatternKeyPattern.FindStringSubmatch(chunkSrc); len(matches) == 4 {
+		if matches[3] != "" {
+			return alternationChunk(matches[1], matches[3], chunkSrc)
+		}
+		return chunkSyntax{key: matches[1], subPattern: matches[2]}, nil
+	}
+	if matches := rpcPatternWildCardPattern.FindStringSubmatch(chunkSrc); len(matches) == 2 {
+		return chunkSyntax{subPattern: matches[1]}, nil
+	}
+	if matches := rpcPatternAlternationPattern.FindStringSubmatch(chunkSrc); len(matches) == 2 {
+		return alternationChunk("", matches[1], chunkSrc)
+	}
+	return chunkSyntax{static: chunkSrc, isStatic: true}, nil
+}
+
+// alternationChunk returns a chunk matching one of the comma separated static
+// alternatives
+func alternationChunk(key, alternativesSrc, chunkSrc string) (chunkSyntax, error) {
+	alternatives := strings.Split(alternativesSrc, ",")
+	for i, alternative := range alternatives {
+		if alternative == "" {
+			return chunkSyntax{}, fmt.Errorf("absinthe: empty alternative in chunk %s", chunkSrc)
+		}
+		alternatives[i] = regexp.QuoteMeta(alternative)
+	}
+	return chunkSyntax{key: key, subPattern: strings.Join(alternatives, "|"), alternation: true}, nil
+}
+
+// parseChunks parses the chunks of a route or pattern source, skipping empty
+// chunks. Sub-patterns are validated on their own, so they cannot contain
+// capture groups or escape the group of their param.
+func parseChunks(patternSrc, separator string, parse chunkParser) ([]chunkSyntax, error) {
+	if len(patternSrc) > MaxPatternLength {
+		return nil, fmt.Errorf("absinthe: pattern is longer than %d bytes", MaxPatternLength)
+	}
+
+	chunks := make([]chunkSyntax, 0)
+	keys := make(map[string]bool)
+	for _, chunkSrc := range strings.Split(patternSrc, separator) {
+		if len(chunkSrc) == 0 {
+			continue
+		}
+		chunk, err := parse(chunkSrc)
+		if err != nil {
+			return nil, err
+		}
+		if len(chunks) != 0 && chunks[len(chunks)-1].rest {
+			return nil, fmt.Errorf("absinthe: rest chunk must be last in pattern %s", patternSrc)
+		}
+		if chunk.key != "" {
+			if keys[chunk.key] {
+				return nil, fmt.Errorf("absinthe: duplicate param %s in pattern %s", chunk.key, patternSrc)
+			}
+			keys[chunk.key] = true
+		}
+		if chunk.subPattern != "" {
+			if err := validateSubPattern(chunk.subPattern); err != nil {
+				return nil, fmt.Errorf("absinthe: invalid sub-pattern in chunk %s: %v", chunkSrc, err)
+			}
+		}
+		chunks = append(chunks, chunk)
+		if len(chunks) > MaxPatternChunks {
+			return nil, fmt.Errorf("absinthe: pattern has more than %d chunks", MaxPatternChunks)
+		}
+	}
+	return chunks, nil
+}
+
+// validateSubPattern returns an error if a sub-pattern is not a valid regular
+// expression, or has capture groups, which would add params to the route
+func validateSubPattern(subPattern string) error {
+	re, err := syntax.Parse(subPattern, syntax.Perl)
+	if err != nil {
+		return err
+	}
+	if re.MaxCap() != 0 {
+		return fmt.Errorf("capture groups are not allowed, use (?:...) instead")
+	}
+	return nil
+}
+
+// compilePattern compiles the regular expression of a route or pattern,
+// enforcing MaxPatternInstructions
+func compilePattern(patternSrc, regExpSrc string) (*regexp.Regexp, error) {
+	re, err := syntax.Parse(regExpSrc, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("absinthe: invalid pattern %s: %v", patternSrc, err)
+	}
+	prog, err := syntax.Compile(re.Simplify())
+	if err != nil {
+		return nil, fmt.Errorf("absinthe: invalid pattern %s: %v", patternSrc, err)
+	}
+	if len(prog.Inst) > MaxPatternInstructions {
+		return nil, fmt.Errorf("absinthe: pattern %s is too complex", patternSrc)
+	}
+	pattern, err := regexp.Compile(regExpSrc)
+	if err != nil {
+		return nil, fmt.Errorf("absinthe: invalid pattern %s: %v", patternSrc, err)
+	}
+	return pattern, nil
+}
+
+// regExpSrc returns the source of the regular expression matching the chunk
+// in a path, along with the separator before it. Params and wildcards without
+// a sub-pattern match defaultSubPattern, and static chunks are escaped with
+// escapePattern.
+func (c *chunkSyntax) regExpSrc(separatorSrc, defaultSubPattern string, escapePattern *regexp.Regexp) string {
+	var src string
+	switch {
+	case c.isStatic:
+		src = separatorSrc + escapePattern.ReplaceAllString(c.static, `\$1`)
+	case c.rest && c.subPattern != "" && c.key != "":
+		return separatorSrc + `(?P<` + c.key + `>` + c.subPattern + `)`
+	case c.rest && c.subPattern != "":
+		return separatorSrc + `(?:` + c.subPattern + `)`
+	case c.rest && c.key != "":
+		return `(?:` + separatorSrc + `(?P<` + c.key + `>.*?))?`
+	case c.rest:
+		return `(?:` + separatorSrc + `.*?)?`
+	default:
+		subPattern := c.subPattern
+		if subPattern == "" {
+			subPattern = defaultSubPattern
+		}
+		if c.key != "" {
+			src = separatorSrc + `(?P<` + c.key + `>` + subPattern + `)`
+		} else {
+			src = separatorSrc + `(?:` + subPattern + `)`
+		}
+	}
+	if c.optional {
+		return `(?:` + src + `)?`
+	}
+	return src
+}
@@ -1,4 +1,160 @@
 package absinthe
 
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrRPCHandlerFailed is sent back in place of errors returned by typed RPC
+// handlers which the caller cannot act on, so their message is not leaked
+var ErrRPCHandlerFailed = errors.New("absinthe: rpc handler failed")
+
+// rpcErrorCodes are the errors recognized in RPC error responses by their
+// code, so callers can check error responses with errors.Is
+var rpcErrorCodes = []struct {
+	code string
+	err  error
+}{
+	{"invalid_data", ErrInvalidRPCData},
+	{"no_handler", ErrNoRPCHandler},
+	{"unauthenticated", ErrUnauthenticated},
+	{"forbidden", ErrForbidden},
+	{"handler_failed", ErrRPCHandlerFailed},
+}
+
+// rpcErrorCode returns the code of the error in rpcErrorCodes matching err,
+// or an empty string if there is none
+func rpcErrorCode(err error) string {
+	for _, rpcErr := range rpcErrorCodes {
+		if errors.Is(err, rpcErr.err) {
+			return rpcErr.code
+		}
+	}
+	return ""
+}
+
+// rpcResponseError is the error returned for an RPC error response. It has
+// the message of the response, and wraps the error matching its code.
+type rpcResponseError struct {
+	message string
+	err     error
+}
+
+func (e *rpcResponseError) Error() string {
+	return e.message
+}
+
+func (e *rpcResponseError) Unwrap() error {
+	return e.err
+}
+
+// err returns the error carried by the response, or nil if it has none.
+// Responses with the message of the error matching their code return that
+// error itself.
+func (r *RPCResponse) err() error {
+	if len(r.Error) == 0 {
+		return nil
+	}
+	err := &rpcResponseError{message: r.Error}
+	for _, rpcErr := range rpcErrorCodes {
+		if r.Code != rpcErr.code {
+			continue
+		}
+		if r.Error == rpcErr.err.Error() {
+			return rpcErr.err
+		}
+		err.err = rpcErr.err
+	}
+	return err
+}
+
+// RPCContext is passed to each RPCHandler. It carries the call being handled
+// and is used to send the result back to the caller. Middleware bound with
+// RPCRouter.UseRPC calls Next to pass the call on.
 type RPCContext struct {
+	Path      string
+	Params    Params
+	Data      []byte
+	Identity  *Identity
+	RequestID string
+	Next      func()
+
+	ctx      context.Context
+	client   *Client
+	request  *RPCRequest
+	response *RPCResponse
+	pattern  *RPCPattern
+	endOnce  sync.Once
+	endHooks []func()
+	done     chan struct{}
+}
+
+func newRPCContext(client *Client, request *RPCRequest) *RPCContext {
+	return &RPCContext{
+		Path:      request.Path,
+		Params:    make(Params),
+		Data:      request.Data,
+		RequestID: request.RequestID,
+		ctx:       context.Background(),
+		client:    client,
+		request:   request,
+		response:  &RPCResponse{},
+		done:      make(chan struct{}),
+	}
+}
+
+// Respond sends data back to the caller. Only the first call to Respond or
+// Error has an effect.
+func (c *RPCContext) Respond(data []byte) {
+	c.endOnce.Do(func() {
+		c.response.Data = data
+		c.end()
+	})
+}
+
+// Error sends an error back to the caller. Only the first call to Respond or
+// Error has an effect.
+func (c *RPCContext) Error(err error) {
+	c.endOnce.Do(func() {
+		c.response.Error = err.Error()
+		c.response.Code = rpcErrorCode(err)
+		c.end()
+	})
+}
+
+func (c *RPCContext) end() {
+	for _, hook := range c.endHooks {
+		hook()
+	}
+	close(c.done)
+}
+
+// onEnd registers a function called when the call is responded to, before the
+// response is sent back to the caller
+func (c *RPCContext) onEnd(hook func()) {
+	c.endHooks = append(c.endHooks, hook)
+}
+
+// Context returns the context of the request. It carries the trace context
+// of the caller, and the span the request is handled in.
+func (c *RPCContext) Context() context.Context {
+	return c.ctx
+}
+
+// Call makes an RPC call to another peer on behalf of the caller, forwarding
+// the identity of the caller signed for the call
+func (c *RPCContext) Call(path string, data []byte) ([]byte, error) {
+	if c.client == nil {
+		return nil, ErrNoClient
+	}
+	return c.client.call(c.ctx, path, data, c.RequestID, c.Identity)
+}
+
+// Codec returns the codec of the client the context is attached to
+func (c *RPCContext) Codec() Codec {
+	if c.client == nil {
+		return JSONCodec{}
+	}
+	return c.client.Codec()
 }
@@ -1,56 +1,83 @@
 package absinthe
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"regexp"
 	"strings"
 )
 
-var rpcPatternKeyPattern = regexp.MustCompile(`^\$([\w\d]+)(?:\((.*)\))?$`)
+var rpcPatternKeyPattern = regexp.MustCompile(`^\$([\w\d]+)(?:\((.*)\)|\{([^{}]+)\})?$`)
 var rpcPatternWildCardPattern = regexp.MustCompile(`^\$(?:\((.*)\))?$`)
+var rpcPatternTailPattern = regexp.MustCompile(`^(?:\$\$([\w\d]*)|>)$`)
+var rpcPatternAlternationPattern = regexp.MustCompile(`^\{([^{}]+)\}$`)
 var rpcPatternChunkEscapePattern = regexp.MustCompile(`([\(\)\[\]\{\}\.\?\+\*\^\$\|\-\\])`)
 
+// rpcPatternTailSubPattern matches one or more segments of a path
+const rpcPatternTailSubPattern = `[^\.]+(?:\.[^\.]+)*`
+
+// RPCPattern matches the paths of RPC calls. Its pattern is a path of dot
+// separated chunks, each of which is one of
+//
+//	user               a static segment
+//	$id                a param matching a segment, captured as id
+//	$id(\d+)           a param matching a sub-pattern
+//	$                  a wildcard matching a segment, which may also have a
+//	                   sub-pattern
+//	{create,update}    one of several static segments
+//	$action{get,list}  a param matching one of several static segments
+//	$$ or >            a tail matching one or more segments, as with the >
+//	                   wildcard of NATS subjects
+//	$$rest             a tail captured as rest
+//
+// Tails must be the last chunk of a pattern, and sub-patterns and
+// alternatives cannot contain dots.
 type RPCPattern struct {
 	PatternSrc string
 	Pattern    *regexp.Regexp
+	Policies   []Policy
+
+	chunks []routeChunk
+
+	// terminated is always true, as patterns match whole paths. It is kept so
+	// patterns and REST routes are indexed and compared alike.
+	terminated bool
 }
 
 func NewRPCPattern(patternSrc string) (*RPCPattern, error) {
 	patternSrcChunks := strings.Split(patternSrc, ".")
-
-	regExpSrcChunks := make([]string, 0)
 	for _, chunk := range patternSrcChunks {
 		if len(chunk) == 0 && len(patternSrcChunks) != 1 {
 			return nil, fmt.Errorf("empty pattern chunk in pattern %s", patternSrc)
 		}
+	}
 
-		var regExpChunkSrc string
-		if matches := rpcPatternKeyPattern.FindStringSubmatch(chunk); len(matches) == 3 {
-			key := matches[1]
-			subPattern := matches[2]
-			if len(subPattern) == 0 {
-				subPattern = `[^\.]+`
-			}
-			regExpChunkSrc = "(?P<" + key + ">" + subPattern + ")"
-
-		} else if matches := rpcPatternWildCardPattern.FindStringSubmatch(chunk); len(matches) == 2 {
-			subPattern := matches[1]
-			if len(subPattern) == 0 {
-				subPattern = `[^\.]+`
-			}
-			regExpChunkSrc = subPattern
-
-		} else {
-			regExpChunkSrc = rpcPatternChunkEscapePattern.ReplaceAllString(chunk, `\$1`)
+	chunks, err := parseChunks(patternSrc, ".", parseRPCPatternChunk)
+	if err != nil {
+		return nil, err
+	}
+
+	regExpSrc := `^`
+	for i, chunk := range chunks {
+		separatorSrc := `\.`
+		if i == 0 {
+			separatorSrc = ``
 		}
+		regExpSrc += chunk.regExpSrc(separatorSrc, `[^\.]+`, rpcPatternChunkEscapePattern)
+	}
+	regExpSrc += `$`
 
-		regExpSrcChunks = append(regExpSrcChunks, regExpChunkSrc)
+	pattern, err := compilePattern(patternSrc, regExpSrc)
+	if err != nil {
+		return nil, err
 	}
-	regExpSrc := `^` + strings.Join(regExpSrcChunks, `\.`) + `$`
 
 	return &RPCPattern{
 		PatternSrc: patternSrc,
-		Pattern:    regexp.MustCompile(regExpSrc),
+		Pattern:    pattern,
+		chunks:     newRouteChunks(chunks, "."),
+		terminated: true,
 	}, nil
 }
 
@@ -58,37 +85,67 @@ func (p *RPCPattern) Match(path string) bool {
 	return p.Pattern.MatchString(path)
 }
 
+// FindParams returns the params captured from the path if the pattern matches
+// it. A named tail captures the remainder of the path, dots included.
 func (p *RPCPattern) FindParams(path string) (map[string]string, bool) {
 	if !p.Match(path) {
 		return nil, false
 	}
 
-	params := make(map[string]string)
-	subExpNames := p.Pattern.SubexpNames()
-	subMatches := p.Pattern.FindStringSubmatch(path)
-
-	for i, key := range subExpNames {
-		if len(key) == 0 {
-			continue
-		}
-		params[key] = subMatches[i]
-	}
-
-	return params, true
+	return findParams(p.Pattern, path), true
 }
 
 func (p *RPCPattern) GobDecode(data []byte) error {
+	var policies []Policy
+	if i := bytes.IndexByte(data, 0); i != -1 {
+		if err := json.Unmarshal(data[i+1:], &policies); err != nil {
+			return err
+		}
+		data = data[:i]
+	}
 	pattern, err := NewRPCPattern(string(data))
 	if err != nil {
 		return err
 	}
-	p.Pattern = pattern.Pattern
-	p.PatternSrc = pattern.PatternSrc
+	pattern.Policies = policies
+	*p = *pattern
 	return nil
 }
 
-func (p *RPCPattern) GobEncode() ([]byte, error) {
-	return []byte(p.PatternSrc), nil
+func (p RPCPattern) GobEncode() ([]byte, error) {
+	data := []byte(p.PatternSrc)
+	if len(p.Policies) != 0 {
+		policyData, err := json.Marshal(p.Policies)
+		if err != nil {
+			return nil, err
+		}
+		data = append(append(data, 0), policyData...)
+	}
+	return data, nil
+}
+
+// rpcPatternJSON is the JSON representation of an RPCPattern
+type rpcPatternJSON struct {
+	Pattern  string   `json:"pattern"`
+	Policies []Policy `json:"policies,omitempty"`
+}
+
+func (p RPCPattern) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rpcPatternJSON{Pattern: p.PatternSrc, Policies: p.Policies})
+}
+
+func (p *RPCPattern) UnmarshalJSON(data []byte) error {
+	patternJSON := rpcPatternJSON{}
+	if err := json.Unmarshal(data, &patternJSON); err != nil {
+		return err
+	}
+	pattern, err := NewRPCPattern(patternJSON.Pattern)
+	if err != nil {
+		return err
+	}
+	pattern.Policies = patternJSON.Policies
+	*p = *pattern
+	return nil
 }
 
 func (p *RPCPattern) String() string {
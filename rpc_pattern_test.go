@@ -1,6 +1,8 @@
 package absinthe
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -165,6 +167,66 @@ var rpcPatternAndPaths = map[string][2][]string{
 			"",
 		},
 	},
+	"events.>": [2][]string{
+		[]string{
+			"events.user",
+			"events.user.created",
+		},
+		[]string{
+			"events",
+			"events.",
+			"event.user",
+		},
+	},
+	"events.$$": [2][]string{
+		[]string{
+			"events.user",
+			"events.user.created",
+		},
+		[]string{
+			"events",
+			"events..user",
+		},
+	},
+	"events.$$topic": [2][]string{
+		[]string{
+			"events.user",
+			"events.user.created",
+		},
+		[]string{
+			"events",
+		},
+	},
+	">": [2][]string{
+		[]string{
+			"alpha",
+			"alpha.beta",
+		},
+		[]string{
+			"",
+		},
+	},
+	"user.{create,update}": [2][]string{
+		[]string{
+			"user.create",
+			"user.update",
+		},
+		[]string{
+			"user.delete",
+			"user.createx",
+			"user",
+		},
+	},
+	"user.$action{get,list}.$id": [2][]string{
+		[]string{
+			"user.get.1",
+			"user.list.1",
+		},
+		[]string{
+			"user.delete.1",
+			"user.get",
+		},
+	},
 }
 
 func TestNewRPCPattern(t *testing.T) {
@@ -200,3 +262,113 @@ func TestRPCPatternFindParams(t *testing.T) {
 	assert.Equal(t, "two", params["beta"])
 	assert.Equal(t, "three", params["gamma"])
 }
+
+func TestRPCPatternGobPolicies(t *testing.T) {
+	pattern, err := NewRPCPattern("user.$userID.get")
+	assert.NoError(t, err)
+	pattern.Policies = []Policy{RequireScopes("users:read")}
+
+	data, err := pattern.GobEncode()
+	assert.NoError(t, err)
+
+	decodedPattern := &RPCPattern{}
+	assert.NoError(t, decodedPattern.GobDecode(data))
+	assert.Equal(t, pattern.PatternSrc, decodedPattern.PatternSrc)
+	assert.Equal(t, pattern.Policies, decodedPattern.Policies)
+}
+
+func TestRPCPatternFindParamsSyntax(t *testing.T) {
+	testCases := []struct {
+		pattern, path string
+		params        map[string]string
+	}{
+		{"events.$$topic", "events.user.created", map[string]string{"topic": "user.created"}},
+		{"events.$source.$$topic", "events.billing.invoice.paid", map[string]string{"source": "billing", "topic": "invoice.paid"}},
+		{"events.>", "events.user.created", map[string]string{}},
+		{"user.$action{create,update}", "user.update", map[string]string{"action": "update"}},
+		{"user.{create,update}.$id", "user.create.7", map[string]string{"id": "7"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.pattern+" "+testCase.path, func(t *testing.T) {
+			pattern, err := NewRPCPattern(testCase.pattern)
+			assert.NoError(t, err)
+			params, ok := pattern.FindParams(testCase.path)
+			assert.True(t, ok)
+			assert.Equal(t, testCase.params, params)
+		})
+	}
+}
+
+func TestNewRPCPatternInvalidSyntax(t *testing.T) {
+	for _, pattern := range []string{
+		"events.>.created",
+		"events.$$topic.created",
+		"user.{create,}",
+		"user.$action{,update}",
+		"user..get",
+		"user.$id((\\d+))",
+		"user.$id(a)(b)",
+		"user.$(?P<x>\\d+)",
+		"user.$id.$id",
+		"user.$id(a{1000}b{1000}c{1000}d{1000}e{1000})",
+		strings.Repeat("a", MaxPatternLength+1),
+		strings.Repeat("a.", MaxPatternChunks) + "a",
+	} {
+		_, err := NewRPCPattern(pattern)
+		assert.Error(t, err, "pattern %s should be invalid", pattern)
+	}
+}
+
+func TestRPCPatternRoundTrip(t *testing.T) {
+	for _, patternSrc := range []string{"events.>", "events.$$topic", "user.{create,update}", "user.$action{get,list}.$id"} {
+		pattern, err := NewRPCPattern(patternSrc)
+		assert.NoError(t, err)
+		pattern.Policies = []Policy{RequireScopes("events:read")}
+
+		data, err := pattern.GobEncode()
+		assert.NoError(t, err)
+		gobPattern := &RPCPattern{}
+		assert.NoError(t, gobPattern.GobDecode(data))
+		assert.Equal(t, pattern.PatternSrc, gobPattern.PatternSrc)
+		assert.Equal(t, pattern.Pattern.String(), gobPattern.Pattern.String())
+		assert.Equal(t, pattern.Policies, gobPattern.Policies)
+
+		data, err = json.Marshal(pattern)
+		assert.NoError(t, err)
+		jsonPattern := &RPCPattern{}
+		assert.NoError(t, json.Unmarshal(data, jsonPattern))
+		assert.Equal(t, pattern.PatternSrc, jsonPattern.PatternSrc)
+		assert.Equal(t, pattern.Pattern.String(), jsonPattern.Pattern.String())
+		assert.Equal(t, pattern.Policies, jsonPattern.Policies)
+	}
+}
+
+func FuzzRPCPatternGobDecode(f *testing.F) {
+	for _, patternSrc := range []string{"", "user.$id.get", "user.$id(\\d+)", "events.$$topic", "user.{create,update}"} {
+		pattern, err := NewRPCPattern(patternSrc)
+		assert.NoError(f, err)
+		pattern.Policies = []Policy{RequireScopes("users:read")}
+		data, err := pattern.GobEncode()
+		assert.NoError(f, err)
+		f.Add(data)
+	}
+	f.Add([]byte("user.$id(a)(b)"))
+	f.Add([]byte("user\x00{"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		pattern := &RPCPattern{}
+		if err := pattern.GobDecode(data); err != nil {
+			return
+		}
+		pattern.FindParams("user.42.get")
+
+		encoded, err := pattern.GobEncode()
+		assert.NoError(t, err)
+		decodedPattern := &RPCPattern{}
+		if assert.NoError(t, decodedPattern.GobDecode(encoded)) {
+			assert.Equal(t, pattern.PatternSrc, decodedPattern.PatternSrc)
+			assert.Equal(t, pattern.Pattern.String(), decodedPattern.Pattern.String())
+		}
+	})
+}
@@ -1,9 +1,131 @@
 package absinthe
 
+import (
+	"context"
+	"time"
+)
+
 type RPCRouter struct {
 	client *Client
+	layers []RPCRouterLayer
 }
 
 func NewRPCRouter() *RPCRouter {
-	return &RPCRouter{}
+	return &RPCRouter{
+		layers: make([]RPCRouterLayer, 0),
+	}
+}
+
+// Handle binds a handler to an RPC pattern and advertises the pattern to other
+// peers. Any policies given are advertised with the pattern and must be
+// satisfied by the caller.
+func (r *RPCRouter) Handle(patternSrc string, handler RPCHandler, policies ...Policy) error {
+	pattern, err := NewRPCPattern(patternSrc)
+	if err != nil {
+		return err
+	}
+	pattern.Policies = policies
+	r.layers = append(r.layers, RPCRouterLayer{
+		Pattern: pattern,
+		Handler: handler,
+	})
+	if r.client != nil {
+		r.client.addRPCPattern(*pattern)
+	}
+	return nil
+}
+
+// UseRPC binds a middleware to every call reaching the router. Middleware
+// runs in the order it is bound, and must call Next on the context to pass the
+// call on to the handlers bound after it. It is not named Use so it does not
+// collide with RESTRouter.Use on Client.
+func (r *RPCRouter) UseRPC(middleware RPCHandler) {
+	r.layers = append(r.layers, RPCRouterLayer{
+		Handler: middleware,
+	})
+}
+
+// Exec runs the layers of the router against the context, starting with the
+// first middleware or handler with a pattern matching its path. It returns
+// false if no handler matches.
+func (r *RPCRouter) Exec(context *RPCContext) bool {
+	if !r.hasHandlerFor(context.Path) {
+		return false
+	}
+	currentLayerIndex := 0
+	context.Next = func() {
+		for currentLayerIndex < len(r.layers) {
+			layer := r.layers[currentLayerIndex]
+			currentLayerIndex++
+			if layer.Pattern == nil {
+				layer.Handler(context)
+				return
+			}
+			params, ok := layer.Pattern.FindParams(context.Path)
+			if !ok {
+				continue
+			}
+			if err := authorize(layer.Pattern.Policies, context.Identity, params); err != nil {
+				context.Error(err)
+				return
+			}
+			context.Params = params
+			context.pattern = layer.Pattern
+			layer.Handler(context)
+			return
+		}
+		context.Error(ErrNoRPCHandler)
+	}
+	context.Next()
+	return true
+}
+
+func (r *RPCRouter) hasHandlerFor(path string) bool {
+	for _, layer := range r.layers {
+		if layer.Pattern != nil && layer.Pattern.Match(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Invoke runs the router in process against an RPC call, without dispatching
+// it through the transport. The identity carried by ctx, if any, is passed to
+// the handler.
+func (r *RPCRouter) Invoke(ctx context.Context, path string, data []byte) ([]byte, error) {
+	rpcContext := newRPCContext(r.client, &RPCRequest{
+		Path:      path,
+		Data:      data,
+		RequestID: newRequestID(),
+	})
+	rpcContext.Identity = IdentityFromContext(ctx)
+	rpcContext.ctx = ctx
+	go func() {
+		if !r.Exec(rpcContext) {
+			rpcContext.Error(ErrNoRPCHandler)
+		}
+	}()
+
+	timeout := DefaultRequestTimeout
+	if r.client != nil {
+		timeout = r.client.options.RequestTimeout
+	}
+	select {
+	case <-rpcContext.done:
+	case <-time.After(timeout):
+		return nil, ErrTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if err := rpcContext.response.err(); err != nil {
+		return nil, err
+	}
+	return rpcContext.response.Data, nil
+}
+
+// RPCRouterLayer is a handler bound to a pattern, or a middleware if Pattern
+// is nil
+type RPCRouterLayer struct {
+	Pattern *RPCPattern
+	Handler RPCHandler
 }
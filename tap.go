@@ -0,0 +1,446 @@
+package absinthe
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidStatusFilter is returned by Tap when the status of its filter is
+// neither a status code, such as 404, nor a status class, such as 5xx
+var ErrInvalidStatusFilter = errors.New("absinthe: status filter must be a status code or class such as 404 or 5xx")
+
+// DefaultRedactedHeaders are the headers redacted by a Tap when no redactors
+// are given
+var DefaultRedactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization", "X-Api-Key"}
+
+// Redacted replaces the values of redacted headers and fields
+const Redacted = "[REDACTED]"
+
+// maxTapOrphans is the most responses a Tap holds while waiting for the
+// requests they answer. Further responses are dropped until some expire.
+const maxTapOrphans = 1024
+
+// TapRecord is a REST request or RPC call captured by a Tap, along with its
+// response. Calls which are not answered within the request timeout of the
+// tapping client are recorded with a 504 status. RPC calls are recorded with
+// a 200 status if they succeed and a 500 status if they fail.
+type TapRecord struct {
+	Time      time.Time     `json:"time"`
+	Duration  time.Duration `json:"duration"`
+	Kind      string        `json:"kind"`
+	PeerID    string        `json:"peerId"`
+	PeerName  string        `json:"peerName,omitempty"`
+	RequestID string        `json:"requestId,omitempty"`
+	Route     string        `json:"route,omitempty"`
+	Method    string        `json:"method,omitempty"`
+	URL       string        `json:"url,omitempty"`
+	Path      string        `json:"path,omitempty"`
+	Status    int           `json:"status"`
+	Error     string        `json:"error,omitempty"`
+
+	// Sealed is true if the payloads of the exchange are encrypted, in which
+	// case only the envelope is recorded
+	Sealed bool `json:"sealed,omitempty"`
+
+	Request  TapMessage  `json:"request"`
+	Response *TapMessage `json:"response,omitempty"`
+}
+
+// TapMessage is the header and body of a captured request or response. Bodies
+// holding JSON are recorded as is, and other bodies are recorded as strings
+// with Text set.
+type TapMessage struct {
+	Header http.Header     `json:"header,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	Text   bool            `json:"text,omitempty"`
+}
+
+// Bytes returns the body of the message as it was captured
+func (m TapMessage) Bytes() []byte {
+	if !m.Text {
+		return m.Body
+	}
+	var text string
+	if err := json.Unmarshal(m.Body, &text); err != nil {
+		return m.Body
+	}
+	return []byte(text)
+}
+
+func newTapMessage(header http.Header, body []byte) TapMessage {
+	if len(body) == 0 || json.Valid(body) {
+		return TapMessage{Header: header, Body: body}
+	}
+	text, _ := json.Marshal(string(body))
+	return TapMessage{Header: header, Body: text, Text: true}
+}
+
+// TapRedactor modifies captured records before they are handed to the handler
+// of a Tap, such as to remove credentials
+type TapRedactor func(record *TapRecord)
+
+// TapOptions configure a Tap. Only exchanges matching every set filter are
+// captured.
+type TapOptions struct {
+	// Route filters exchanges by the source of the REST route or RPC pattern
+	// they were matched by, such as /users/:id or user.$id.get
+	Route string
+
+	// Peer filters exchanges by the ID or name of the peer handling them
+	Peer string
+
+	// Status filters exchanges by their status code, such as 404, or status
+	// class, such as 5xx
+	Status string
+
+	// Redactors are applied to every captured record. If nil, the
+	// DefaultRedactedHeaders are redacted.
+	Redactors []TapRedactor
+}
+
+// Tap captures the REST requests and RPC calls made within the namespace of a
+// client, for debugging. Requests are paired with their responses, so records
+// are handed over once a response arrives or the request times out.
+type Tap struct {
+	client        *Client
+	options       TapOptions
+	handler       func(TapRecord)
+	subscriptions []Subscription
+	stopChan      chan struct{}
+	stopOnce      sync.Once
+
+	mu       sync.Mutex
+	pending  map[string]*TapRecord
+	orphans  map[string]tapOrphan
+	handleMu sync.Mutex
+}
+
+// tapOrphan is a response received before the request it answers
+type tapOrphan struct {
+	data       []byte
+	receivedAt time.Time
+}
+
+// Tap starts capturing the traffic of the namespace of the client, calling
+// handler with each captured exchange. The transport of the client must
+// support wildcard subscriptions, as nats and the memory transport do.
+// Responses are captured from the inboxes within the namespace, and those not
+// answering a captured request are ignored.
+func (c *Client) Tap(options TapOptions, handler func(TapRecord)) (*Tap, error) {
+	if options.Status != "" {
+		if _, err := statusMatcher(options.Status); err != nil {
+			return nil, err
+		}
+	}
+	if options.Redactors == nil {
+		options.Redactors = []TapRedactor{RedactHeaders(DefaultRedactedHeaders...)}
+	}
+
+	t := &Tap{
+		client:   c,
+		options:  options,
+		handler:  handler,
+		stopChan: make(chan struct{}),
+		pending:  make(map[string]*TapRecord),
+		orphans:  make(map[string]tapOrphan),
+	}
+
+	requestSubscription, err := c.transport.Subscribe(c.Namespace+".*", t.handleRequest)
+	if err != nil {
+		return nil, err
+	}
+	t.subscriptions = append(t.subscriptions, requestSubscription)
+	responseSubscription, err := c.transport.Subscribe(c.Namespace+"."+InboxToken+".>", t.handleResponse)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	t.subscriptions = append(t.subscriptions, responseSubscription)
+
+	go t.expire()
+	return t, nil
+}
+
+// Close stops capturing traffic. Exchanges awaiting a response are dropped.
+func (t *Tap) Close() error {
+	t.stopOnce.Do(func() {
+		close(t.stopChan)
+	})
+	var err error
+	for _, subscription := range t.subscriptions {
+		if unsubscribeErr := subscription.Unsubscribe(); unsubscribeErr != nil {
+			err = unsubscribeErr
+		}
+	}
+	return err
+}
+
+func (t *Tap) handleRequest(msg *Message) {
+	if msg.Reply == "" {
+		return
+	}
+	subject := strings.TrimPrefix(msg.Subject, t.client.Namespace+".")
+	record := &TapRecord{Time: time.Now()}
+	switch {
+	case strings.HasPrefix(subject, "REST-"):
+		request := &RESTRequest{}
+		if err := decode(msg.Data, request); err != nil {
+			return
+		}
+		record.Kind = RouteKindREST
+		record.PeerID = strings.TrimPrefix(subject, "REST-")
+		record.RequestID = request.RequestID
+		record.Method = request.Method
+		record.URL = request.URL
+		record.Sealed = len(request.Sealed) != 0
+		record.Request = newTapMessage(request.Header, request.Body)
+		if peer, ok := t.client.indexer.Peer(record.PeerID); ok {
+			record.PeerName = peer.Name
+			path := request.URL
+			if u, err := url.ParseRequestURI(request.URL); err == nil {
+				path = u.Path
+			}
+			if route, ok := peer.FindRESTRoute(request.Method, path); ok {
+				record.Route = route.PatternSrc
+			}
+		}
+	case strings.HasPrefix(subject, "RPC-"):
+		request := &RPCRequest{}
+		if err := decode(msg.Data, request); err != nil {
+			return
+		}
+		record.Kind = RouteKindRPC
+		record.PeerID = strings.TrimPrefix(subject, "RPC-")
+		record.RequestID = request.RequestID
+		record.Path = request.Path
+		record.Sealed = len(request.Sealed) != 0
+		record.Request = newTapMessage(nil, request.Data)
+		if peer, ok := t.client.indexer.Peer(record.PeerID); ok {
+			record.PeerName = peer.Name
+			if pattern, ok := peer.FindRPCPattern(request.Path); ok {
+				record.Route = pattern.PatternSrc
+			}
+		}
+	default:
+		return
+	}
+
+	if t.options.Route != "" && record.Route != t.options.Route {
+		return
+	}
+	if t.options.Peer != "" && record.PeerID != t.options.Peer && record.PeerName != t.options.Peer {
+		return
+	}
+
+	t.mu.Lock()
+	orphan, ok := t.orphans[msg.Reply]
+	if ok {
+		delete(t.orphans, msg.Reply)
+	} else {
+		t.pending[msg.Reply] = record
+	}
+	t.mu.Unlock()
+	if ok {
+		t.complete(record, orphan.data, orphan.receivedAt)
+	}
+}
+
+func (t *Tap) handleResponse(msg *Message) {
+	t.mu.Lock()
+	record, ok := t.pending[msg.Subject]
+	if ok {
+		delete(t.pending, msg.Subject)
+	} else if len(t.orphans) < maxTapOrphans {
+		t.orphans[msg.Subject] = tapOrphan{data: msg.Data, receivedAt: time.Now()}
+	}
+	t.mu.Unlock()
+	if ok {
+		t.complete(record, msg.Data, time.Now())
+	}
+}
+
+// complete decodes the response to a captured request, then hands the record
+// to the handler if it passes the status filter
+func (t *Tap) complete(record *TapRecord, data []byte, receivedAt time.Time) {
+	record.Duration = receivedAt.Sub(record.Time)
+	switch record.Kind {
+	case RouteKindREST:
+		response := &RESTResponse{}
+		if err := decode(data, response); err != nil {
+			return
+		}
+		record.Status = response.Status
+		message := newTapMessage(response.Header, response.Body)
+		record.Response = &message
+	case RouteKindRPC:
+		response := &RPCResponse{}
+		if err := decode(data, response); err != nil {
+			return
+		}
+		record.Status = http.StatusOK
+		if response.Error != "" {
+			record.Status = http.StatusInternalServerError
+			record.Error = response.Error
+		}
+		message := newTapMessage(nil, response.Data)
+		record.Response = &message
+	}
+	t.emit(record)
+}
+
+// expire records requests which were not responded to within the request
+// timeout of the client, and drops responses to requests which were not
+// captured
+func (t *Tap) expire() {
+	timeout := t.client.options.RequestTimeout
+	if timeout <= 0 {
+		timeout = DefaultRequestTimeout
+	}
+	ticker := time.NewTicker(timeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stopChan:
+			return
+		case now := <-ticker.C:
+			expired := make([]*TapRecord, 0)
+			t.mu.Lock()
+			for reply, record := range t.pending {
+				if now.Sub(record.Time) > timeout {
+					delete(t.pending, reply)
+					expired = append(expired, record)
+				}
+			}
+			for reply, orphan := range t.orphans {
+				if now.Sub(orphan.receivedAt) > timeout {
+					delete(t.orphans, reply)
+				}
+			}
+			t.mu.Unlock()
+			for _, record := range expired {
+				record.Duration = now.Sub(record.Time)
+				record.Status = http.StatusGatewayTimeout
+				record.Error = ErrTimeout.Error()
+				t.emit(record)
+			}
+		}
+	}
+}
+
+func (t *Tap) emit(record *TapRecord) {
+	if t.options.Status != "" {
+		matchStatus, _ := statusMatcher(t.options.Status)
+		if !matchStatus(record.Status) {
+			return
+		}
+	}
+	for _, redact := range t.options.Redactors {
+		redact(record)
+	}
+
+	t.handleMu.Lock()
+	defer t.handleMu.Unlock()
+	select {
+	case <-t.stopChan:
+		return
+	default:
+	}
+	t.handler(*record)
+}
+
+// statusMatcher parses a status code, such as 404, or status class, such as
+// 5xx, into a function matching statuses against it
+func statusMatcher(status string) (func(int) bool, error) {
+	if len(status) == 3 && strings.HasSuffix(strings.ToLower(status), "xx") && status[0] >= '1' && status[0] <= '5' {
+		class := int(status[0] - '0')
+		return func(s int) bool { return s/100 == class }, nil
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil || code < 100 || code > 599 {
+		return nil, ErrInvalidStatusFilter
+	}
+	return func(s int) bool { return s == code }, nil
+}
+
+// TapWriter returns a Tap handler writing each record to w as a line of JSON
+func TapWriter(w io.Writer) func(TapRecord) {
+	encoder := json.NewEncoder(w)
+	return func(record TapRecord) {
+		encoder.Encode(record)
+	}
+}
+
+// RedactHeaders returns a TapRedactor replacing the values of the given
+// request and response headers
+func RedactHeaders(names ...string) TapRedactor {
+	return func(record *TapRecord) {
+		redactHeader(record.Request.Header, names)
+		if record.Response != nil {
+			redactHeader(record.Response.Header, names)
+		}
+	}
+}
+
+func redactHeader(header http.Header, names []string) {
+	for _, name := range names {
+		name = http.CanonicalHeaderKey(name)
+		if values, ok := header[name]; ok {
+			redactedValues := make([]string, len(values))
+			for i := range values {
+				redactedValues[i] = Redacted
+			}
+			header[name] = redactedValues
+		}
+	}
+}
+
+// RedactFields returns a TapRedactor replacing the values of the given fields
+// wherever they appear in JSON request and response bodies
+func RedactFields(names ...string) TapRedactor {
+	return func(record *TapRecord) {
+		record.Request.Body = redactFields(record.Request.Body, names)
+		if record.Response != nil {
+			record.Response.Body = redactFields(record.Response.Body, names)
+		}
+	}
+}
+
+func redactFields(body json.RawMessage, names []string) json.RawMessage {
+	var v interface{}
+	if len(body) == 0 || json.Unmarshal(body, &v) != nil {
+		return body
+	}
+	if _, ok := v.(string); ok {
+		return body
+	}
+	data, err := json.Marshal(redactValue(v, names))
+	if err != nil {
+		return body
+	}
+	return data
+}
+
+func redactValue(v interface{}, names []string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if containsString(names, key) {
+				v[key] = Redacted
+			} else {
+				v[key] = redactValue(value, names)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactValue(value, names)
+		}
+	}
+	return v
+}
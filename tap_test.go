@@ -0,0 +1,130 @@
+package absinthe_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	absinthe "github.com/RobertWHurst/Absinthe"
+	"github.com/RobertWHurst/Absinthe/absinthetest"
+	"github.com/stretchr/testify/assert"
+)
+
+type tapRecords struct {
+	mu      sync.Mutex
+	records []absinthe.TapRecord
+}
+
+func (r *tapRecords) add(record absinthe.TapRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, record)
+}
+
+func (r *tapRecords) get() []absinthe.TapRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]absinthe.TapRecord{}, r.records...)
+}
+
+func TestTap(t *testing.T) {
+	cluster := absinthetest.NewCluster(t)
+	connect := func(name string, options ...absinthe.Option) *absinthe.Client {
+		return cluster.Connect(name, append([]absinthe.Option{
+			absinthe.Version("1.0.0"),
+			absinthe.RequestTimeout(200 * time.Millisecond),
+		}, options...)...)
+	}
+	gateway := connect("gateway")
+	service := connect("users", absinthe.RequestTimeout(5*time.Second))
+	tapper := connect("tap", absinthe.Passive())
+
+	assert.NoError(t, service.Get("/users/:id", func(c *absinthe.RESTContext) {
+		c.SetHeader("Set-Cookie", "session=secret")
+		c.SetHeader("Content-Type", "application/json")
+		c.Write([]byte(`{"id":"` + c.Params["id"] + `","password":"hunter2"}`))
+		c.End()
+	}))
+	assert.NoError(t, service.Handle("user.$id.delete", func(c *absinthe.RPCContext) {
+		c.Error(errors.New("forbidden"))
+	}))
+	assert.NoError(t, service.Handle("user.$id.wait", func(c *absinthe.RPCContext) {}))
+
+	cluster.WaitForRPC(gateway, "user.1.wait")
+	cluster.WaitForRPC(tapper, "user.1.wait")
+
+	all, failed, byPeer := &tapRecords{}, &tapRecords{}, &tapRecords{}
+	tap, err := tapper.Tap(absinthe.TapOptions{
+		Redactors: []absinthe.TapRedactor{
+			absinthe.RedactHeaders(absinthe.DefaultRedactedHeaders...),
+			absinthe.RedactFields("password"),
+		},
+	}, all.add)
+	assert.NoError(t, err)
+	defer tap.Close()
+	failedTap, err := tapper.Tap(absinthe.TapOptions{Status: "5xx", Route: "user.$id.delete"}, failed.add)
+	assert.NoError(t, err)
+	defer failedTap.Close()
+	peerTap, err := tapper.Tap(absinthe.TapOptions{Peer: "gateway"}, byPeer.add)
+	assert.NoError(t, err)
+	defer peerTap.Close()
+
+	_, err = tapper.Tap(absinthe.TapOptions{Status: "5x"}, all.add)
+	assert.Equal(t, absinthe.ErrInvalidStatusFilter, err)
+
+	req := httptest.NewRequest("GET", "/users/1?full=true", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	gateway.ServeHTTP(httptest.NewRecorder(), req)
+	_, err = gateway.Call("user.1.delete", []byte("reason"))
+	assert.EqualError(t, err, "forbidden")
+	_, err = gateway.Call("user.1.wait", nil)
+	assert.Equal(t, absinthe.ErrTimeout, err)
+
+	absinthetest.WaitFor(t, func() bool {
+		return len(all.get()) >= 3
+	}, "tap records")
+	records := all.get()
+	if !assert.Len(t, records, 3) {
+		return
+	}
+
+	rest := records[0]
+	assert.Equal(t, "rest", rest.Kind)
+	assert.Equal(t, service.ID, rest.PeerID)
+	assert.Equal(t, "users", rest.PeerName)
+	assert.Equal(t, "/users/:id", rest.Route)
+	assert.Equal(t, "GET", rest.Method)
+	assert.Equal(t, "/users/1?full=true", rest.URL)
+	assert.Equal(t, http.StatusOK, rest.Status)
+	assert.NotEmpty(t, rest.RequestID)
+	assert.Equal(t, []string{absinthe.Redacted}, rest.Request.Header["Authorization"])
+	assert.Equal(t, []string{absinthe.Redacted}, rest.Response.Header["Set-Cookie"])
+	assert.Equal(t, `{"id":"1","password":"[REDACTED]"}`, string(rest.Response.Body))
+
+	rpc := records[1]
+	assert.Equal(t, "rpc", rpc.Kind)
+	assert.Equal(t, "user.1.delete", rpc.Path)
+	assert.Equal(t, "user.$id.delete", rpc.Route)
+	assert.Equal(t, http.StatusInternalServerError, rpc.Status)
+	assert.Equal(t, "forbidden", rpc.Error)
+	assert.Equal(t, `"reason"`, string(rpc.Request.Body))
+
+	timedOut := records[2]
+	assert.Equal(t, "user.1.wait", timedOut.Path)
+	assert.Equal(t, http.StatusGatewayTimeout, timedOut.Status)
+	assert.Nil(t, timedOut.Response)
+
+	if assert.Len(t, failed.get(), 1) {
+		assert.Equal(t, "user.1.delete", failed.get()[0].Path)
+	}
+	assert.Empty(t, byPeer.get())
+
+	output := &strings.Builder{}
+	absinthe.TapWriter(output)(rpc)
+	assert.True(t, strings.HasSuffix(output.String(), "}\n"))
+	assert.Contains(t, output.String(), `"path":"user.1.delete"`)
+}
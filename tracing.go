@@ -0,0 +1,120 @@
+package absinthe
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the tracer absinthe creates its spans with
+const TracerName = "github.com/RobertWHurst/Absinthe"
+
+// Attribute keys set on the spans created by absinthe
+const (
+	AttributeRoute       = attribute.Key("absinthe.route")
+	AttributeNamespace   = attribute.Key("absinthe.namespace")
+	AttributePeerID      = attribute.Key("absinthe.peer.id")
+	AttributePeerName    = attribute.Key("absinthe.peer.name")
+	AttributePeerVersion = attribute.Key("absinthe.peer.version")
+	AttributeRequestID   = attribute.Key("absinthe.request_id")
+)
+
+// setupTracing resolves the tracer and propagator of the client from its
+// options, falling back to the global tracer provider and W3C trace context
+func (c *Client) setupTracing() {
+	tracerProvider := c.options.TracerProvider
+	if tracerProvider == nil {
+		tracerProvider = otel.GetTracerProvider()
+	}
+	c.tracer = tracerProvider.Tracer(TracerName)
+
+	c.propagator = c.options.Propagator
+	if c.propagator == nil {
+		c.propagator = propagation.TraceContext{}
+	}
+}
+
+// startSpan starts a span carrying the namespace of the client and the given
+// request ID
+func (c *Client) startSpan(ctx context.Context, name string, kind trace.SpanKind, requestID string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs,
+		AttributeNamespace.String(c.options.Namespace),
+		AttributeRequestID.String(requestID),
+	)
+	return c.tracer.Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+// injectTraceContext returns the trace context of ctx, to be carried in an
+// envelope
+func (c *Client) injectTraceContext(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	c.propagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// extractTraceContext returns a context carrying the trace context of an
+// envelope
+func (c *Client) extractTraceContext(traceContext map[string]string) context.Context {
+	return c.propagator.Extract(context.Background(), propagation.MapCarrier(traceContext))
+}
+
+// peerAttributes returns the attributes describing a peer
+func peerAttributes(peer Peer) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		AttributePeerID.String(peer.ID),
+	}
+	if len(peer.Name) != 0 {
+		attrs = append(attrs, AttributePeerName.String(peer.Name))
+	}
+	if peer.Version != nil {
+		attrs = append(attrs, AttributePeerVersion.String(peer.Version.String()))
+	}
+	return attrs
+}
+
+// endRESTSpan records the status of a REST response on its span and ends it
+func endRESTSpan(span trace.Span, status int) {
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	span.End()
+}
+
+// endSpan records the error of a dispatch or RPC call, if any, on its span
+// and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// statusWriter records the status written to a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(data)
+}
@@ -0,0 +1,101 @@
+package absinthe_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	absinthe "github.com/RobertWHurst/Absinthe"
+	"github.com/RobertWHurst/Absinthe/absinthetest"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) string {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestTracingAcrossPeers(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	cluster := absinthetest.NewCluster(t)
+	connect := func(name string) *absinthe.Client {
+		return cluster.Connect(name, absinthe.Version("1.2.3"), absinthe.TracerProvider(tracerProvider))
+	}
+	gateway := connect("gateway")
+	service := connect("service")
+	backend := connect("backend")
+
+	assert.NoError(t, service.Get("/users/:id", func(c *absinthe.RESTContext) {
+		data, err := c.Call("user."+c.Params["id"]+".get", nil)
+		assert.NoError(t, err)
+		c.Write(data)
+		c.End()
+	}))
+	assert.NoError(t, backend.Handle("user.$id.get", func(c *absinthe.RPCContext) {
+		c.Respond([]byte(trace.SpanContextFromContext(c.Context()).TraceID().String()))
+	}))
+
+	cluster.WaitForRPC(service, "user.1.get")
+	cluster.WaitForREST(gateway, "GET", "/users/1")
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("GET", "/users/1", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	gateway.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, traceID, w.Body.String())
+
+	spans := make([]sdktrace.ReadOnlySpan, 0)
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID().String() == traceID {
+			spans = append(spans, span)
+		}
+	}
+	assert.Len(t, spans, 5)
+
+	var gatewayServer, gatewayClient, serviceServer, serviceClient, backendServer sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		switch {
+		case span.Name() == "GET /users/:id" && span.SpanKind() == trace.SpanKindServer && span.Parent().IsRemote():
+			if spanAttribute(span, absinthe.AttributePeerID) == "" {
+				gatewayServer = span
+			} else {
+				serviceServer = span
+			}
+		case span.Name() == "GET /users/:id" && span.SpanKind() == trace.SpanKindClient:
+			gatewayClient = span
+		case span.Name() == "user.$id.get" && span.SpanKind() == trace.SpanKindClient:
+			serviceClient = span
+		case span.Name() == "user.$id.get" && span.SpanKind() == trace.SpanKindServer:
+			backendServer = span
+		}
+	}
+	if !assert.NotNil(t, gatewayServer) || !assert.NotNil(t, gatewayClient) || !assert.NotNil(t, serviceServer) ||
+		!assert.NotNil(t, serviceClient) || !assert.NotNil(t, backendServer) {
+		return
+	}
+
+	assert.Equal(t, gatewayServer.SpanContext().SpanID(), gatewayClient.Parent().SpanID())
+	assert.Equal(t, gatewayClient.SpanContext().SpanID(), serviceServer.Parent().SpanID())
+	assert.Equal(t, serviceServer.SpanContext().SpanID(), serviceClient.Parent().SpanID())
+	assert.Equal(t, serviceClient.SpanContext().SpanID(), backendServer.Parent().SpanID())
+
+	assert.Equal(t, "/users/:id", spanAttribute(gatewayClient, absinthe.AttributeRoute))
+	assert.Equal(t, service.ID, spanAttribute(gatewayClient, absinthe.AttributePeerID))
+	assert.Equal(t, "1.2.3", spanAttribute(gatewayClient, absinthe.AttributePeerVersion))
+	assert.Equal(t, "absinthe", spanAttribute(gatewayClient, absinthe.AttributeNamespace))
+	assert.Equal(t, "200", spanAttribute(gatewayServer, "http.response.status_code"))
+	assert.Equal(t, backend.ID, spanAttribute(serviceClient, absinthe.AttributePeerID))
+	assert.Equal(t, "user.$id.get", spanAttribute(backendServer, absinthe.AttributeRoute))
+}
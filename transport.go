@@ -0,0 +1,67 @@
+package absinthe
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrTimeout is returned by a Transport when a request receives no response
+// before its deadline
+var ErrTimeout = errors.New("absinthe: timeout")
+
+// ErrTransportClosed is returned by a Transport after it has been closed
+var ErrTransportClosed = errors.New("absinthe: transport closed")
+
+// Message is a message received from a Transport
+type Message struct {
+	Subject string
+	Reply   string
+	Data    []byte
+}
+
+// MessageHandler is called with each message received by a subscription
+type MessageHandler func(*Message)
+
+// Subscription is returned when subscribing to a Transport, and can be used
+// to stop receiving messages
+type Subscription interface {
+	Unsubscribe() error
+}
+
+// Transport moves messages between peers. Subjects given to a Transport are
+// already namespaced by Conn. Nats is used unless another Transport is set
+// with the UseTransport Option.
+type Transport interface {
+	// Publish sends data to every subscriber of the subject
+	Publish(subject string, data []byte) error
+
+	// PublishRequest sends data to every subscriber of the subject, asking for
+	// responses to be sent to the reply subject
+	PublishRequest(subject, reply string, data []byte) error
+
+	// Subscribe calls handler with every message sent to the subject. As with
+	// nats, a * token in the subject matches any one token, and a trailing >
+	// token matches one or more tokens.
+	Subscribe(subject string, handler MessageHandler) (Subscription, error)
+
+	// QueueSubscribe calls handler with messages sent to the subject. Each
+	// message is only delivered to one subscriber of the queue.
+	QueueSubscribe(subject, queue string, handler MessageHandler) (Subscription, error)
+
+	// Request sends data to the subject and waits for the first response. If
+	// the context expires first ErrTimeout is returned.
+	Request(ctx context.Context, subject string, data []byte) ([]byte, error)
+
+	// Close stops all subscriptions and releases the Transport
+	Close() error
+}
+
+// StatefulTransport is implemented by transports able to report whether they
+// are connected. Transports which do not implement it are assumed to always be
+// connected.
+type StatefulTransport interface {
+	Transport
+
+	// IsConnected reports whether the transport can currently move messages
+	IsConnected() bool
+}
@@ -0,0 +1,145 @@
+package absinthe
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// ErrInvalidRPCData is returned when the data of a typed RPC call, or of its
+// response, cannot be decoded with the configured codec
+var ErrInvalidRPCData = errors.New("absinthe: invalid rpc data")
+
+// Caller makes RPC calls with a codec for their data. It is implemented by
+// Client, and by RESTContext and RPCContext, which make calls on behalf of the
+// request they carry, and may be implemented to stub calls in tests.
+type Caller interface {
+	Call(path string, data []byte) ([]byte, error)
+	Codec() Codec
+}
+
+// HandleRPC binds a typed handler to an RPC pattern. The data of each call is
+// decoded into a Req with the codec of the client, and params of the pattern
+// are bound to fields of Req tagged with param, as with RESTContext.Bind. The
+// Res returned by the handler is encoded with the codec and sent back to the
+// caller. As with RESTContext.Error, errors from binding, ErrUnauthenticated,
+// and ErrForbidden are sent back as they are, and any other error is sent back
+// as ErrRPCHandlerFailed, without its message.
+//
+//	absinthe.HandleRPC(client.RPCRouter, "user.$id.get", func(c *absinthe.RPCContext, req GetUser) (User, error) {
+//		return users.Get(req.ID)
+//	})
+func HandleRPC[Req, Res any](router *RPCRouter, patternSrc string, handler func(*RPCContext, Req) (Res, error), policies ...Policy) error {
+	return router.Handle(patternSrc, func(c *RPCContext) {
+		codec := c.Codec()
+
+		var req Req
+		if len(c.Data) != 0 {
+			if err := codec.Unmarshal(c.Data, &req); err != nil {
+				c.Error(fmt.Errorf("%w: %v", ErrInvalidRPCData, err))
+				return
+			}
+		}
+		if target := reflect.ValueOf(&req).Elem(); target.Kind() == reflect.Struct {
+			params := make(map[string][]string)
+			for key, value := range c.Params {
+				params[key] = []string{value}
+			}
+			if err := bindStruct(target, map[string]map[string][]string{"param": params}, nil); err != nil {
+				c.Error(err)
+				return
+			}
+		}
+		if validator, ok := interface{}(&req).(Validator); ok {
+			if err := validator.Validate(); err != nil {
+				var bindErr *BindError
+				if !errors.As(err, &bindErr) {
+					err = &BindError{Source: "request", Err: err}
+				}
+				c.Error(err)
+				return
+			}
+		}
+
+		res, err := handler(c, req)
+		if err != nil {
+			c.Error(rpcHandlerError(c, err))
+			return
+		}
+		data, err := codec.Marshal(res)
+		if err != nil {
+			c.Error(rpcHandlerError(c, err))
+			return
+		}
+		c.Respond(data)
+	}, policies...)
+}
+
+// CallTyped makes an RPC call with req encoded by the codec of the caller, and
+// decodes the response into a Res. Error responses for ErrInvalidRPCData,
+// ErrNoRPCHandler, ErrUnauthenticated, ErrForbidden, or ErrRPCHandlerFailed
+// are returned as errors wrapping them.
+func CallTyped[Req, Res any](caller Caller, path string, req Req) (Res, error) {
+	var res Res
+	codec := caller.Codec()
+
+	data, err := codec.Marshal(req)
+	if err != nil {
+		return res, err
+	}
+	data, err = caller.Call(path, data)
+	if err != nil {
+		return res, err
+	}
+	if len(data) != 0 {
+		if err := codec.Unmarshal(data, &res); err != nil {
+			return res, fmt.Errorf("%w: %v", ErrInvalidRPCData, err)
+		}
+	}
+	return res, nil
+}
+
+// rpcHandlerError returns the error sent back for an error of a typed RPC
+// handler. Errors which would be answered with 500 Internal Server Error by
+// RESTContext.Error are logged and replaced with ErrRPCHandlerFailed.
+func rpcHandlerError(c *RPCContext, err error) error {
+	if errors.Is(err, ErrInvalidRPCData) || errorStatus(err) != http.StatusInternalServerError {
+		return err
+	}
+	if c.client != nil {
+		c.client.logger.Error("rpc handler failed", "request_id", c.RequestID, "path", c.Path, "error", err)
+	}
+	return ErrRPCHandlerFailed
+}
+
+// HandleREST binds a typed handler to the given method and path. Each request
+// is bound to a Req with RESTContext.Bind, and the Res returned by the handler
+// is written as JSON. Errors from binding or returned by the handler are
+// answered with RESTContext.Error, so a request which cannot be bound is
+// answered with 400 Bad Request. The handler may set the status of the
+// response, which is 200 OK otherwise.
+func HandleREST[Req, Res any](router *RESTRouter, method, path string, handler func(*RESTContext, Req) (Res, error), policies ...Policy) error {
+	return router.Route(method, path, func(c *RESTContext) {
+		var req Req
+		if err := c.Bind(&req); err != nil {
+			c.Error(err)
+			return
+		}
+
+		res, err := handler(c, req)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		data, err := json.Marshal(res)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.SetHeader("Content-Type", "application/json")
+		c.Write(data)
+		c.End()
+	}, policies...)
+}
@@ -0,0 +1,164 @@
+package absinthe_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	absinthe "github.com/RobertWHurst/Absinthe"
+	"github.com/RobertWHurst/Absinthe/absinthetest"
+	"github.com/stretchr/testify/assert"
+)
+
+type getUserRequest struct {
+	ID   int  `param:"id" json:"-"`
+	Full bool `json:"full"`
+}
+
+type user struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestHandleRPC(t *testing.T) {
+	cluster := absinthetest.NewCluster(t)
+	gateway := cluster.Connect("gateway")
+	service := cluster.Connect("service")
+
+	assert.NoError(t, absinthe.HandleRPC(service.RPCRouter, "user.$id.get", func(c *absinthe.RPCContext, req getUserRequest) (user, error) {
+		if req.ID == 0 {
+			return user{}, absinthe.ErrForbidden
+		}
+		if req.ID == 1 {
+			return user{}, errors.New("connection to users database refused")
+		}
+		name := "ada"
+		if req.Full {
+			name = "ada lovelace"
+		}
+		return user{ID: req.ID, Name: name}, nil
+	}))
+	cluster.WaitForRPC(gateway, "user.7.get")
+
+	res, err := absinthe.CallTyped[getUserRequest, user](gateway, "user.7.get", getUserRequest{Full: true})
+	assert.NoError(t, err)
+	assert.Equal(t, user{ID: 7, Name: "ada lovelace"}, res)
+
+	_, err = absinthe.CallTyped[getUserRequest, user](gateway, "user.0.get", getUserRequest{})
+	assert.True(t, errors.Is(err, absinthe.ErrForbidden), "unexpected error %v", err)
+
+	_, err = absinthe.CallTyped[getUserRequest, user](gateway, "user.1.get", getUserRequest{})
+	assert.True(t, errors.Is(err, absinthe.ErrRPCHandlerFailed), "unexpected error %v", err)
+	assert.EqualError(t, err, absinthe.ErrRPCHandlerFailed.Error())
+
+	_, err = absinthe.CallTyped[getUserRequest, user](gateway, "user.me.get", getUserRequest{})
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "invalid param id"), "unexpected error %v", err)
+
+	_, err = absinthe.CallTyped[string, user](gateway, "user.7.get", "ada")
+	assert.True(t, errors.Is(err, absinthe.ErrInvalidRPCData), "unexpected error %v", err)
+
+	_, err = absinthe.CallTyped[getUserRequest, user](gateway, "user.7.delete", getUserRequest{})
+	assert.True(t, errors.Is(err, absinthe.ErrNoRPCHandler), "unexpected error %v", err)
+}
+
+// stubCaller is a Caller answering every call with the same data
+type stubCaller struct {
+	paths []string
+	data  []byte
+}
+
+func (c *stubCaller) Call(path string, data []byte) ([]byte, error) {
+	c.paths = append(c.paths, path)
+	return c.data, nil
+}
+
+func (c *stubCaller) Codec() absinthe.Codec {
+	return absinthe.JSONCodec{}
+}
+
+func TestCallTypedStubCaller(t *testing.T) {
+	caller := &stubCaller{data: []byte(`{"id":7,"name":"ada"}`)}
+	res, err := absinthe.CallTyped[getUserRequest, user](caller, "user.7.get", getUserRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, user{ID: 7, Name: "ada"}, res)
+	assert.Equal(t, []string{"user.7.get"}, caller.paths)
+}
+
+// gobCodec is a Codec encoding values with encoding/gob
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	data := &bytes.Buffer{}
+	err := gob.NewEncoder(data).Encode(v)
+	return data.Bytes(), err
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+func TestHandleRPCCodec(t *testing.T) {
+	cluster := absinthetest.NewCluster(t)
+	gateway := cluster.Connect("gateway", absinthe.UseCodec(gobCodec{}))
+	service := cluster.Connect("service", absinthe.UseCodec(gobCodec{}))
+
+	assert.NoError(t, absinthe.HandleRPC(service.RPCRouter, "user.get", func(c *absinthe.RPCContext, req user) (user, error) {
+		req.Name = strings.ToUpper(req.Name)
+		return req, nil
+	}))
+	cluster.WaitForRPC(gateway, "user.get")
+
+	res, err := absinthe.CallTyped[user, user](gateway, "user.get", user{ID: 1, Name: "ada"})
+	assert.NoError(t, err)
+	assert.Equal(t, user{ID: 1, Name: "ADA"}, res)
+
+	data, err := gateway.Call("user.get", []byte(`{"id":1}`))
+	assert.Nil(t, data)
+	assert.True(t, errors.Is(err, absinthe.ErrInvalidRPCData), "unexpected error %v", err)
+}
+
+type updateUserRequest struct {
+	ID   int    `param:"id"`
+	Name string `json:"name" validate:"required"`
+}
+
+func TestHandleREST(t *testing.T) {
+	router := absinthe.NewRESTRouter()
+	assert.NoError(t, absinthe.HandleREST(router, "put", "/users/:id", func(c *absinthe.RESTContext, req updateUserRequest) (user, error) {
+		if req.ID == 0 {
+			return user{}, errors.New("user 0 is read only")
+		}
+		c.Status(http.StatusAccepted)
+		return user{ID: req.ID, Name: req.Name}, nil
+	}))
+
+	testCases := []struct {
+		url, body string
+		status    int
+		response  string
+	}{
+		{"/users/7", `{"name":"ada"}`, http.StatusAccepted, `{"id":7,"name":"ada"}`},
+		{"/users/me", `{"name":"ada"}`, http.StatusBadRequest, ""},
+		{"/users/7", `{}`, http.StatusBadRequest, ""},
+		{"/users/0", `{"name":"ada"}`, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)},
+	}
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest("PUT", testCase.url, strings.NewReader(testCase.body))
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		assert.Equal(t, testCase.status, recorder.Code, "%s %s", testCase.url, testCase.body)
+		if testCase.response != "" {
+			assert.Equal(t, testCase.response, recorder.Body.String())
+		}
+		if testCase.status == http.StatusAccepted {
+			assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		}
+	}
+}